@@ -0,0 +1,282 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// AsyncBufRows is the maximum number of formatted rows that can be
+// pending in an AsyncWriter before Write blocks, bounding memory use.
+var AsyncBufRows = 1024
+
+// AsyncBufSize is the size of the buffer used by an AsyncWriter
+// for writing to the underlying file.
+var AsyncBufSize = 64 * 1024
+
+// ErrAsyncClosed is returned when writing to a closed AsyncWriter
+var ErrAsyncClosed = errors.New("elog.AsyncWriter: closed")
+
+// asyncMsg is one message to the AsyncWriter goroutine: either
+// data to write, or a flush request with a channel for the result.
+type asyncMsg struct {
+	data []byte
+	ack  chan error
+}
+
+// AsyncWriter writes data to an io.Writer on a separate goroutine,
+// so that slow file systems do not hold up the caller.
+// Data is written strictly in the order of Write calls, across all
+// callers sharing the writer.  At most AsyncBufRows writes can be
+// pending, after which Write blocks until the writer catches up.
+// The first error encountered in writing is recorded and returned
+// by all subsequent Write, Flush, Close and Err calls.
+type AsyncWriter struct {
+	W           io.Writer     `desc:"the underlying writer"`
+	ch          chan asyncMsg // pending messages
+	done        chan struct{} // closed when goroutine exits
+	mu          sync.Mutex    // protects sending, closed and wroteHeader
+	closed      bool
+	header      []byte // log table headers, written once before the first row
+	wroteHeader bool
+	errMu       sync.Mutex
+	err         error
+}
+
+// NewAsyncWriter returns a new AsyncWriter writing to given writer,
+// and starts its writing goroutine.  If w is also an io.Closer,
+// it is closed by Close.
+func NewAsyncWriter(w io.Writer) *AsyncWriter {
+	aw := &AsyncWriter{W: w}
+	aw.ch = make(chan asyncMsg, AsyncBufRows)
+	aw.done = make(chan struct{})
+	go aw.run()
+	return aw
+}
+
+// run is the writing goroutine
+func (aw *AsyncWriter) run() {
+	defer close(aw.done)
+	bw := bufio.NewWriterSize(aw.W, AsyncBufSize)
+	for msg := range aw.ch {
+		if msg.data != nil && aw.Err() == nil {
+			if _, err := bw.Write(msg.data); err != nil {
+				aw.setErr(err)
+			}
+		}
+		if msg.ack != nil || len(aw.ch) == 0 { // flush when idle
+			if err := bw.Flush(); err != nil {
+				aw.setErr(err)
+			}
+		}
+		if msg.ack != nil {
+			msg.ack <- aw.Err()
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		aw.setErr(err)
+	}
+	if cl, ok := aw.W.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			aw.setErr(err)
+		}
+	}
+}
+
+// setErr records the first error
+func (aw *AsyncWriter) setErr(err error) {
+	aw.errMu.Lock()
+	if aw.err == nil {
+		aw.err = err
+	}
+	aw.errMu.Unlock()
+}
+
+// Err returns the first error encountered in writing, if any
+func (aw *AsyncWriter) Err() error {
+	aw.errMu.Lock()
+	defer aw.errMu.Unlock()
+	return aw.err
+}
+
+// Write queues given data for writing -- the data must not be
+// modified after the call.  Returns the first error encountered in
+// any prior write, or ErrAsyncClosed if the writer is closed.
+func (aw *AsyncWriter) Write(data []byte) (int, error) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.closed {
+		return 0, ErrAsyncClosed
+	}
+	if err := aw.Err(); err != nil {
+		return 0, err
+	}
+	aw.ch <- asyncMsg{data: data}
+	return len(data), nil
+}
+
+// writeRow queues given row of a log table, preceded by the log
+// table headers if this is the first row written to the file, so that
+// tables sharing the writer only write the headers once.
+func (aw *AsyncWriter) writeRow(row []byte) (int, error) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.closed {
+		return 0, ErrAsyncClosed
+	}
+	if err := aw.Err(); err != nil {
+		return 0, err
+	}
+	if !aw.wroteHeader && aw.header != nil {
+		aw.ch <- asyncMsg{data: aw.header}
+		aw.wroteHeader = true
+	}
+	aw.ch <- asyncMsg{data: row}
+	return len(row), nil
+}
+
+// Flush waits until all data queued so far has been written
+// to the underlying writer, returning any error.
+func (aw *AsyncWriter) Flush() error {
+	aw.mu.Lock()
+	if aw.closed {
+		aw.mu.Unlock()
+		return aw.Err()
+	}
+	ack := make(chan error, 1)
+	aw.ch <- asyncMsg{ack: ack}
+	aw.mu.Unlock()
+	return <-ack
+}
+
+// Close writes all pending data, closes the underlying writer
+// if it is an io.Closer, and returns any error.
+// It is safe to call Close multiple times.
+func (aw *AsyncWriter) Close() error {
+	aw.mu.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.ch)
+	}
+	aw.mu.Unlock()
+	<-aw.done
+	return aw.Err()
+}
+
+// asyncFile returns the AsyncWriter for given file name, creating the
+// file and writer if not already open, so that multiple scopes
+// logging to the same file share one writer and stay strictly ordered.
+// The header is written once before the first row, and all the scopes
+// sharing the file must have the same header, i.e., the same columns.
+func (lg *Logs) asyncFile(fnm string, header []byte) (*AsyncWriter, error) {
+	lg.asyncMu.Lock()
+	defer lg.asyncMu.Unlock()
+	if lg.asyncWriters == nil {
+		lg.asyncWriters = make(map[string]*AsyncWriter)
+	}
+	key := filepath.Clean(fnm)
+	if aw, has := lg.asyncWriters[key]; has {
+		if !bytes.Equal(aw.header, header) {
+			return nil, fmt.Errorf("elog: log file %s is already used by a log with different columns", fnm)
+		}
+		return aw, nil
+	}
+	f, err := os.Create(fnm)
+	if err != nil {
+		return nil, err
+	}
+	aw := NewAsyncWriter(f)
+	aw.header = header
+	lg.asyncWriters[key] = aw
+	return aw, nil
+}
+
+// AsyncWriters returns a copy of the map of open async log file writers,
+// keyed by file name.
+func (lg *Logs) AsyncWriters() map[string]*AsyncWriter {
+	lg.asyncMu.Lock()
+	defer lg.asyncMu.Unlock()
+	aws := make(map[string]*AsyncWriter, len(lg.asyncWriters))
+	for fnm, aw := range lg.asyncWriters {
+		aws[fnm] = aw
+	}
+	return aws
+}
+
+// closeAsyncFiles closes all async log file writers, returning the
+// first error, and removes them from the list of open writers.
+func (lg *Logs) closeAsyncFiles() error {
+	var rerr error
+	for fnm, aw := range lg.AsyncWriters() {
+		if err := aw.Close(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("elog: writing log file %s: %w", fnm, err)
+		}
+	}
+	lg.asyncMu.Lock()
+	lg.asyncWriters = nil
+	lg.asyncMu.Unlock()
+	return rerr
+}
+
+// FlushLogFiles waits until all rows logged so far have been
+// written to the async log files (see AsyncFiles), returning
+// the first error from any of them.
+func (lg *Logs) FlushLogFiles() error {
+	var rerr error
+	for fnm, aw := range lg.AsyncWriters() {
+		if err := aw.Flush(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("elog: writing log file %s: %w", fnm, err)
+		}
+	}
+	return rerr
+}
+
+// FileErr returns the first error encountered in writing any of the
+// async log files (see AsyncFiles), without waiting for pending rows.
+// Sims can check this periodically (e.g., each epoch) to stop early
+// when logs cannot be written.
+func (lg *Logs) FileErr() error {
+	for fnm, aw := range lg.AsyncWriters() {
+		if err := aw.Err(); err != nil {
+			return fmt.Errorf("elog: writing log file %s: %w", fnm, err)
+		}
+	}
+	return nil
+}
+
+// FlushOnSignal arranges for all async log files to be flushed and closed,
+// and synchronous ones synced to disk, when the process receives one of
+// the given signals (os.Interrupt and SIGTERM if none are given),
+// e.g., when a cluster job is killed.  After that, the signal is re-raised
+// with the default handling, so the process terminates as it otherwise would.
+func (lg *Logs) FlushOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, sigs...)
+	go func() {
+		sig := <-sc
+		lg.closeAsyncFiles()
+		for _, lt := range lg.Tables {
+			if f := lt.File; f != nil {
+				f.Sync()
+			}
+		}
+		signal.Reset(sigs...)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(sig)
+		}
+	}()
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+type failWriter struct {
+	n int
+}
+
+func (fw *failWriter) Write(b []byte) (int, error) {
+	fw.n++
+	if fw.n > 1 {
+		return 0, errors.New("disk full")
+	}
+	return len(b), nil
+}
+
+func TestAsyncLogFiles(t *testing.T) {
+	lg := &Logs{AsyncFiles: true}
+	lg.AddItem(&Item{
+		Name: "Row",
+		Type: etensor.INT64,
+		Write: WriteMap{
+			etime.Scopes([]etime.Modes{etime.Train, etime.Test}, []etime.Times{etime.Epoch}): func(ctx *Context) {
+				ctx.SetInt(ctx.Row)
+			}}})
+	lg.CreateTables()
+	fnm := filepath.Join(t.TempDir(), "both.tsv")
+	lg.SetLogFile(etime.Train, etime.Epoch, fnm)
+	lg.SetLogFile(etime.Test, etime.Epoch, fnm)
+	var exp []string
+	for ep := 0; ep < 5000; ep++ {
+		mode := etime.Train
+		if ep%3 == 0 {
+			mode = etime.Test
+		}
+		dt := lg.Log(mode, etime.Epoch)
+		if ep == 0 {
+			exp = append(exp, "|Row")
+		}
+		exp = append(exp, strconv.Itoa(dt.Rows-1))
+	}
+	if err := lg.FileErr(); err != nil {
+		t.Error(err)
+	}
+	if err := lg.CloseLogFiles(); err != nil {
+		t.Error(err)
+	}
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt := &etable.Table{}
+	if err := dt.OpenCSV(gi.FileName(fnm), etable.Tab); err != nil || dt.Rows != len(exp)-1 {
+		t.Errorf("shared file not readable as one table: rows: %d, err: %v", dt.Rows, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != len(exp) {
+		t.Fatalf("got %d lines, expected %d", len(lines), len(exp))
+	}
+	for i, ln := range lines {
+		if ln != exp[i] {
+			t.Errorf("line %d: got %q, expected %q", i, ln, exp[i])
+			break
+		}
+	}
+}
+
+func TestAsyncLogFilesColumns(t *testing.T) {
+	lg := &Logs{AsyncFiles: true}
+	lg.AddItem(&Item{
+		Name:  "Row",
+		Type:  etensor.INT64,
+		Write: WriteMap{etime.Scopes([]etime.Modes{etime.Train, etime.Test}, []etime.Times{etime.Epoch}): func(ctx *Context) {}}})
+	lg.AddItem(&Item{
+		Name:  "TstErr",
+		Type:  etensor.FLOAT64,
+		Write: WriteMap{etime.Scope(etime.Test, etime.Epoch): func(ctx *Context) {}}})
+	lg.CreateTables()
+	fnm := filepath.Join(t.TempDir(), "both.tsv")
+	lg.SetLogFile(etime.Train, etime.Epoch, fnm)
+	lg.SetLogFile(etime.Test, etime.Epoch, fnm)
+	if lg.TableDetails(etime.Train, etime.Epoch).Writer == nil {
+		t.Errorf("Train log file not set")
+	}
+	if lg.TableDetails(etime.Test, etime.Epoch).Writer != nil {
+		t.Errorf("expected Test log with different columns to be rejected")
+	}
+	lg.CloseLogFiles()
+}
+
+func TestAsyncWriterErr(t *testing.T) {
+	aw := NewAsyncWriter(&failWriter{})
+	aw.Write([]byte("one\n"))
+	if err := aw.Flush(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	aw.Write([]byte("two\n"))
+	if err := aw.Flush(); err == nil {
+		t.Errorf("expected write error")
+	}
+	if _, err := aw.Write([]byte("three\n")); err == nil {
+		t.Errorf("expected write error to propagate")
+	}
+	if err := aw.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected disk full error from Close, got: %v", err)
+	}
+	if _, err := aw.Write([]byte("four\n")); err != ErrAsyncClosed {
+		t.Errorf("expected ErrAsyncClosed, got: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ package elog
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/emer/emergent/emer"
 	"github.com/emer/emergent/estats"
@@ -86,6 +87,29 @@ func (ctx *Context) SetTensor(val etensor.Tensor) {
 	ctx.Table.SetCellTensor(ctx.Item.Name, ctx.Row, val)
 }
 
+// SetNaN sets the current table, item, row cell(s) to NaN, for a
+// row that is skipped according to the item Conds.  String cells are
+// set to empty, and other non-float cells are set to 0 and marked as Null.
+func (ctx *Context) SetNaN() {
+	cl := ctx.Table.ColByName(ctx.Item.Name)
+	if cl == nil || ctx.Row >= cl.Dim(0) {
+		return
+	}
+	csz := cl.Len() / cl.Dim(0)
+	st := ctx.Row * csz
+	for i := st; i < st+csz; i++ {
+		switch cl.DataType() {
+		case etensor.STRING:
+			cl.SetString1D(i, "")
+		case etensor.FLOAT32, etensor.FLOAT64:
+			cl.SetFloat1D(i, math.NaN())
+		default:
+			cl.SetFloat1D(i, 0)
+			cl.SetNull1D(i, true)
+		}
+	}
+}
+
 ///////////////////////////////////////////////////
 //  Aggregation, data access
 
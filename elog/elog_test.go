@@ -5,9 +5,15 @@
 package elog
 
 import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/emer/emergent/estats"
 	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
 	"github.com/emer/etable/etensor"
 )
 
@@ -43,3 +49,197 @@ func TestItem(t *testing.T) {
 		t.Errorf("Item has mode or time it shouldn't")
 	}
 }
+
+func TestAggRunLogs(t *testing.T) {
+	runs := make([]*etable.Table, 3)
+	for ri := range runs {
+		dt := &etable.Table{}
+		nep := 3 + ri // runs of different lengths
+		dt.SetFromSchema(etable.Schema{
+			{Name: "Epoch", Type: etensor.INT64},
+			{Name: "Err", Type: etensor.FLOAT64},
+			{Name: "Name", Type: etensor.STRING},
+		}, nep)
+		for ep := 0; ep < nep; ep++ {
+			dt.SetCellFloat("Epoch", ep, float64(ep))
+			dt.SetCellFloat("Err", ep, float64(ri+ep))
+		}
+		runs[ri] = dt
+	}
+	ag := &etable.Table{}
+	err := AggRunLogs(ag, runs, "Epoch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ag.Rows != 5 {
+		t.Errorf("expected 5 aligned rows, got: %d", ag.Rows)
+	}
+	if ag.ColByName("Name:Mean") != nil {
+		t.Errorf("string column should not be aggregated")
+	}
+	if n := ag.CellFloat("N", 0); n != 3 {
+		t.Errorf("expected N = 3 at epoch 0, got: %g", n)
+	}
+	if n := ag.CellFloat("N", 4); n != 1 {
+		t.Errorf("expected N = 1 at epoch 4, got: %g", n)
+	}
+	if m := ag.CellFloat("Err:Mean", 0); m != 1 {
+		t.Errorf("expected Err:Mean = 1 at epoch 0, got: %g", m)
+	}
+	if s := ag.CellFloat("Err:Sem", 0); math.Abs(s-1/math.Sqrt(3)) > 1.0e-8 {
+		t.Errorf("expected Err:Sem = 1/sqrt(3) at epoch 0, got: %g", s)
+	}
+	if q := ag.CellFloat("Err:Q75", 0); q != 1.5 {
+		t.Errorf("expected Err:Q75 = 1.5 at epoch 0, got: %g", q)
+	}
+	if ec := ag.MetaData["Err:Mean:ErrCol"]; ec != "Err:Sem" {
+		t.Errorf("expected ErrCol meta data, got: %s", ec)
+	}
+}
+
+func TestRunLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, fn := range []string{"Net_r0_epc.tsv", "Net_r0_tst_epc.tsv", "Net_r1_epc.tsv", "Net_r1_trl.tsv", "Other_r0_epc.tsv"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fns, err := RunLogFiles(dir, "Net", "epc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{filepath.Join(dir, "Net_r0_epc.tsv"), filepath.Join(dir, "Net_r1_epc.tsv")}
+	if strings.Join(fns, ",") != strings.Join(exp, ",") {
+		t.Errorf("epc files: %v, expected: %v", fns, exp)
+	}
+	fns, _ = RunLogFiles(dir, "Net", "tst_epc")
+	if len(fns) != 1 || filepath.Base(fns[0]) != "Net_r0_tst_epc.tsv" {
+		t.Errorf("tst_epc files: %v", fns)
+	}
+}
+
+func TestSchemaMap(t *testing.T) {
+	lg := &Logs{}
+	nop := func(ctx *Context) {}
+	sk := etime.Scope(etime.Train, etime.Epoch)
+	lg.AddItem(&Item{Name: "Epoch", Type: etensor.INT64, Write: WriteMap{sk: nop}})
+	lg.AddItem(&Item{Name: "Err", Type: etensor.FLOAT64, Plot: true, Write: WriteMap{sk: nop}})
+	lg.AddItem(&Item{Name: "Name", Type: etensor.STRING, Write: WriteMap{sk: nop}})
+	lg.CreateTables()
+	old := lg.LogSchema(sk)
+	dt := lg.TableScope(sk)
+	dt.SetNumRows(2)
+	dt.SetCellFloat("Err", 1, 0.5)
+	dt.SetCellString("Name", 1, "b")
+
+	cur := lg.LogSchema(sk)
+	cur.Items = append(cur.Items[:1], ItemSchema{Name: "Cor", Type: etensor.FLOAT32}, cur.Items[1])
+	cur.Items[0].Type = etensor.FLOAT64
+	df := CompareSchemas(old, cur)
+	if df.Compat != SchemaCompatible {
+		t.Errorf("expected Compatible, got: %s", df)
+	}
+	if len(df.Added) != 1 || len(df.Removed) != 1 || len(df.Retyped) != 1 {
+		t.Errorf("unexpected diffs: %s", df)
+	}
+	mp := &etable.Table{}
+	MapToSchema(mp, dt, cur, map[string]float64{"Cor": 1})
+	if mp.Rows != 2 || mp.NumCols() != 3 {
+		t.Fatalf("unexpected mapped table size: %d rows, %d cols", mp.Rows, mp.NumCols())
+	}
+	if v := mp.CellFloat("Cor", 1); v != 1 {
+		t.Errorf("expected default Cor = 1, got: %g", v)
+	}
+	if v := mp.CellFloat("Err", 1); v != 0.5 {
+		t.Errorf("expected Err = 0.5, got: %g", v)
+	}
+
+	cur.Items[2].Type = etensor.STRING
+	if df := CompareSchemas(old, cur); df.Compat != SchemaIncompatible {
+		t.Errorf("expected Incompatible, got: %s", df)
+	}
+}
+
+func TestItemConds(t *testing.T) {
+	lg := &Logs{}
+	stats := &estats.Stats{}
+	stats.Init()
+	lg.Context.Stats = stats
+	ncalls := 0
+	lg.AddItem(&Item{
+		Name: "Epoch",
+		Type: etensor.INT64,
+		Write: WriteMap{
+			etime.Scope(etime.Train, etime.Epoch): func(ctx *Context) {
+				ctx.SetStatInt("Epoch")
+			}}})
+	every := lg.AddItem(&Item{
+		Name: "Every3",
+		Type: etensor.FLOAT64,
+		Write: WriteMap{
+			etime.Scope(etime.AllModes, etime.Epoch): func(ctx *Context) {
+				ncalls++
+				ctx.SetFloat64(1)
+			}}})
+	every.Conds = CondMap{etime.Scope(etime.AllModes, etime.Epoch): &WriteCond{Period: 3}}
+	odd := lg.AddItem(&Item{
+		Name:     "Odd",
+		Type:     etensor.FLOAT64,
+		SkipOmit: true,
+		Write: WriteMap{
+			etime.Scope(etime.Train, etime.Epoch): func(ctx *Context) {
+				ctx.SetFloat64(2)
+			}}})
+	odd.SetCond(etime.Train, etime.Epoch, func(ctx *Context) bool {
+		return ctx.Stats.Int("Epoch")%2 == 1
+	})
+	lg.CreateTables()
+	if !every.HasMode(etime.Train) || !every.HasTime(etime.Epoch) {
+		t.Errorf("conditional item scopes not compiled")
+	}
+	fnm := filepath.Join(t.TempDir(), "conds.tsv")
+	lg.SetLogFile(etime.Train, etime.Epoch, fnm)
+	for ep := 1; ep <= 7; ep++ { // epochs start at 1, so Period must use the counter, not the row
+		stats.SetInt("Epoch", ep)
+		lg.Log(etime.Train, etime.Epoch)
+	}
+	lg.CloseLogFiles()
+	if ncalls != 2 {
+		t.Errorf("Every3 write called %d times, not 2", ncalls)
+	}
+	dt := lg.Table(etime.Train, etime.Epoch)
+	for r := 0; r < dt.Rows; r++ {
+		ep := r + 1
+		ev := dt.CellFloat("Every3", r)
+		if ep%3 == 0 && ev != 1 || ep%3 != 0 && !math.IsNaN(ev) {
+			t.Errorf("epoch %d: Every3 = %g", ep, ev)
+		}
+		ov := dt.CellFloat("Odd", r)
+		if ep%2 == 1 && ov != 2 || ep%2 == 0 && !math.IsNaN(ov) {
+			t.Errorf("epoch %d: Odd = %g", ep, ov)
+		}
+	}
+
+	// skipped Odd cells are empty in the file, and Every3 cells are NaN
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("expected header + 7 rows in file, got %d lines", len(lines))
+	}
+	if exp := "2\tNaN\t"; lines[2] != exp {
+		t.Errorf("epoch 2 row: %q, expected %q", lines[2], exp)
+	}
+	if exp := "3\t1\t2"; lines[3] != exp {
+		t.Errorf("epoch 3 row: %q, expected %q", lines[3], exp)
+	}
+
+	// a missing counter falls back to the table row
+	wc := &WriteCond{Period: 3, Counter: "Epc"}
+	lg.Context.Row = 4
+	if v := wc.CounterVal(&lg.Context); v != 4 {
+		t.Errorf("missing counter value: %d, expected row: 4", v)
+	}
+}
@@ -5,6 +5,8 @@
 package elog
 
 import (
+	"log"
+
 	"github.com/emer/emergent/etime"
 	"github.com/emer/etable/etensor"
 	"github.com/emer/etable/minmax"
@@ -20,6 +22,48 @@ const (
 // WriteMap holds log writing functions for scope keys
 type WriteMap map[etime.ScopeKey]WriteFunc
 
+// CondFunc is a predicate that determines whether an item is written
+// for the current row, given the Context.  It is called before the
+// WriteFunc, so any expensive computation in the WriteFunc is avoided
+// when it returns false.
+type CondFunc func(ctx *Context) bool
+
+// WriteCond specifies the conditions under which an item is written
+// for a given scope.  Rows where the conditions are not met are skipped:
+// the WriteFunc is not called, and the cell is set to NaN
+// (and omitted from the log file if Item.SkipOmit is set).
+type WriteCond struct {
+	Period  int      `desc:"if > 1, item is only written when the Counter % Period == 0 -- e.g., every 10th epoch"`
+	Counter string   `desc:"name of the Stats Int counter that Period applies to -- defaults to the time of the scope, e.g., Epoch -- the table row is used if the Context has no Stats"`
+	Cond    CondFunc `desc:"if non-nil, item is only written when this returns true"`
+	noCtr   bool     // counter was not found in Stats, and the error was logged
+}
+
+// CounterVal returns the value of the counter that Period applies to,
+// for the current scope in given Context.  If the counter is not in the
+// Stats, the table row is used, and an error is logged the first time.
+func (wc *WriteCond) CounterVal(ctx *Context) int {
+	if ctx.Stats == nil {
+		return ctx.Row
+	}
+	nm := wc.Counter
+	if nm == "" {
+		_, nm = ctx.Scope.ModeAndTimeStr()
+	}
+	val, has := ctx.Stats.Ints[nm]
+	if !has {
+		if !wc.noCtr {
+			log.Printf("elog.WriteCond: Period counter: %s not found in Stats for scope: %s -- using the table row\n", nm, ctx.Scope)
+			wc.noCtr = true
+		}
+		return ctx.Row
+	}
+	return val
+}
+
+// CondMap holds write conditions for scope keys
+type CondMap map[etime.ScopeKey]*WriteCond
+
 // Item describes one item to be logged -- has all the info
 // for this item, across all scopes where it is relevant.
 type Item struct {
@@ -35,6 +79,8 @@ type Item struct {
 	ErrCol    string       `desc:"Name of other item that has the error bar values for this item -- for plotting"`
 	TensorIdx int          `desc:"index of tensor to plot -- defaults to 0 -- use -1 to plot all"`
 	Color     string       `desc:"specific color for plot -- uses default ordering of colors if empty"`
+	Conds     CondMap      `desc:"optional conditions for writing this item in different scopes -- scope keys are specified as in Write -- scopes without an entry are always written"`
+	SkipOmit  bool         `desc:"if true, cells of rows skipped according to Conds are also marked as Null, and are left empty in the log file instead of being written as NaN -- they are read back as missing"`
 
 	// following are updated in final Process step
 	Modes map[string]bool `desc:"map of eval modes that this item has a Write function for"`
@@ -70,9 +116,50 @@ func (item *Item) SetWriteFunc(mode etime.Modes, time etime.Times, theFunc Write
 	item.SetWriteFuncOver([]etime.Modes{mode}, []etime.Times{time}, theFunc)
 }
 
+// SetCondOver sets the write condition over range of modes and times
+func (item *Item) SetCondOver(modes []etime.Modes, times []etime.Times, cond *WriteCond) {
+	if item.Conds == nil {
+		item.Conds = CondMap{}
+	}
+	for _, mode := range modes {
+		for _, time := range times {
+			item.Conds[etime.Scope(mode, time)] = cond
+		}
+	}
+}
+
+// SetCond sets a predicate function that determines whether
+// the item is written for one mode, time
+func (item *Item) SetCond(mode etime.Modes, time etime.Times, cond CondFunc) {
+	item.SetCondOver([]etime.Modes{mode}, []etime.Times{time}, &WriteCond{Cond: cond})
+}
+
+// SetPeriod sets the item to only be written every period counts
+// of the time counter for one mode, time -- e.g., every 10 epochs.
+func (item *Item) SetPeriod(mode etime.Modes, time etime.Times, period int) {
+	item.SetCondOver([]etime.Modes{mode}, []etime.Times{time}, &WriteCond{Period: period})
+}
+
+// ShouldWrite returns true if the item should be written for the current
+// scope and row in given Context, according to any Conds for that scope.
+// Returns true if there are no conditions for the scope.
+func (item *Item) ShouldWrite(ctx *Context) bool {
+	wc, has := item.Conds[ctx.Scope]
+	if !has || wc == nil {
+		return true
+	}
+	if wc.Period > 1 && wc.CounterVal(ctx)%wc.Period != 0 {
+		return false
+	}
+	if wc.Cond != nil && !wc.Cond(ctx) {
+		return false
+	}
+	return true
+}
+
 // SetEachScopeKey updates the Write map so that it only contains entries
 // for a unique Mode,Time pair, where multiple modes and times may have
-// originally been specified.
+// originally been specified.  The Conds map is updated in the same way.
 func (item *Item) SetEachScopeKey() {
 	newWrite := WriteMap{}
 	doReplace := false
@@ -92,6 +179,19 @@ func (item *Item) SetEachScopeKey() {
 	if doReplace {
 		item.Write = newWrite
 	}
+	if len(item.Conds) == 0 {
+		return
+	}
+	newConds := CondMap{}
+	for sk, c := range item.Conds {
+		modes, times := sk.ModesAndTimes()
+		for _, m := range modes {
+			for _, t := range times {
+				newConds[etime.ScopeStr(m, t)] = c
+			}
+		}
+	}
+	item.Conds = newConds
 }
 
 // CompileScopes compiles maps of modes and times where this item appears.
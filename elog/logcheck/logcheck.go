@@ -0,0 +1,36 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// logcheck reports the compatibility of the columns of two elog log files,
+// going from an old to a new one, using their schema sidecar files
+// if present, or otherwise their column headers.
+// Exits with status 1 if the logs are incompatible.
+//
+// Example:
+//
+//	logcheck RA25_Base_000_epc.tsv RA25_Base_001_epc.tsv
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/emer/emergent/elog"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: logcheck <old.tsv> <new.tsv>")
+		os.Exit(2)
+	}
+	df, err := elog.CheckLogFiles(os.Args[1], os.Args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Print(df.String())
+	if df.Compat == elog.SchemaIncompatible {
+		os.Exit(1)
+	}
+}
@@ -5,11 +5,13 @@
 package elog
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/emer/emergent/emer"
 	"github.com/emer/emergent/estats"
@@ -41,6 +43,11 @@ type Logs struct {
 	Times      map[string]bool  `view:"-" desc:"All the timescales that appear in any of the items of this log."`
 	ItemIdxMap map[string]int   `view:"-" desc:"map of item indexes by name, for rapid access to items if they need to be modified after adding."`
 	TableOrder []etime.ScopeKey `view:"-" desc:"sorted order of table scopes"`
+	Streamer   *Streamer        `view:"-" desc:"if non-nil, publishes each new row of selected scopes to remote subscribers -- see StartStream"`
+	AsyncFiles bool             `desc:"if true, log files opened by SetLogFile are written asynchronously on a separate goroutine, so slow file systems do not hold up the sim -- check FileErr for write errors, and call CloseLogFiles at the end to flush all rows"`
+
+	asyncMu      sync.Mutex              // protects asyncWriters
+	asyncWriters map[string]*AsyncWriter // async writers by file name
 }
 
 // AddItem adds an item to the list.  The items are stored in the order
@@ -261,6 +268,9 @@ func (lg *Logs) LogRowScope(sk etime.ScopeKey, row int) *etable.Table {
 	lg.WriteItems(sk, row)
 	lt.ResetIdxViews() // dirty that so it is regenerated later when needed
 	lg.WriteLastRowToFile(lt)
+	if lg.Streamer != nil {
+		lg.Streamer.Publish(sk, dt, row)
+	}
 	return dt
 }
 
@@ -299,30 +309,50 @@ func (lg *Logs) MPIGatherTableRows(mode etime.Modes, time etime.Times, comm *mpi
 	lt.ResetIdxViews()
 }
 
-// SetLogFile sets the log filename for given scope
+// SetLogFile sets the log filename for given scope.
+// Also saves a LogSchema sidecar file next to the log file
+// (see SchemaFileName), recording the columns of the log.
+// If AsyncFiles is set, the file is written asynchronously, and
+// multiple scopes with the same columns can log to the same file name,
+// sharing one writer and one header line -- a scope with different
+// columns is an error, and is not logged to the file.
 func (lg *Logs) SetLogFile(mode etime.Modes, time etime.Times, fnm string) {
 	lt := lg.TableDetails(mode, time)
 	if LogDir != "" {
 		fnm = filepath.Join(LogDir, fnm)
 	}
 	var err error
-	lt.File, err = os.Create(fnm)
+	if lg.AsyncFiles {
+		var hdr bytes.Buffer
+		lt.Table.WriteCSVHeaders(&hdr, etable.Tab)
+		lt.Writer, err = lg.asyncFile(fnm, hdr.Bytes())
+	} else {
+		lt.File, err = os.Create(fnm)
+	}
 	if err != nil {
 		log.Println(err)
 		lt.File = nil
+		lt.Writer = nil
 	} else {
 		fmt.Printf("Saving log to: %s\n", fnm)
+		if err := lg.SaveSchema(etime.Scope(mode, time), fnm); err != nil {
+			log.Println(err)
+		}
 	}
 }
 
-// CloseLogFiles closes all open log files
-func (lg *Logs) CloseLogFiles() {
+// CloseLogFiles closes all open log files, waiting for any
+// pending async rows to be written, and returns the first error
+// encountered in writing async log files.
+func (lg *Logs) CloseLogFiles() error {
 	for _, lt := range lg.Tables {
 		if lt.File != nil {
 			lt.File.Close()
 			lt.File = nil
 		}
+		lt.Writer = nil
 	}
+	return lg.closeAsyncFiles()
 }
 
 ///////////////////////////////////////////////////////////////////////////
@@ -331,20 +361,37 @@ func (lg *Logs) CloseLogFiles() {
 // WriteItems calls all item Write functions within given scope
 // providing the relevant Context for the function.
 // Items are processed in the order added, to enable sequential
-// dependencies to be used.
+// dependencies to be used.  Items whose Conds are not met for
+// this row are skipped, and set to NaN (and omitted from the file
+// if SkipOmit is set).
 func (lg *Logs) WriteItems(sk etime.ScopeKey, row int) {
-	lg.Context.SetTable(sk, lg.Tables[sk], row)
+	lt := lg.Tables[sk]
+	lg.Context.SetTable(sk, lt, row)
+	lt.omit = nil
 	for _, item := range lg.Items {
 		fun, ok := item.Write[sk]
 		if ok {
 			lg.Context.Item = item
+			if !item.ShouldWrite(&lg.Context) {
+				lg.Context.SetNaN()
+				if item.SkipOmit {
+					lt.omitCell(item.Name, row)
+				}
+				continue
+			}
 			fun(&lg.Context)
 		}
 	}
 }
 
-// WriteLastRowToFile writes the last row of table to file, if File != nil
+// WriteLastRowToFile writes the last row of table to file, if File != nil,
+// or to the async Writer, if Writer != nil.  For the async Writer, the row
+// is formatted here and the actual writing happens on another goroutine.
 func (lg *Logs) WriteLastRowToFile(lt *LogTable) {
+	if lt.Writer != nil {
+		lg.writeLastRowAsync(lt)
+		return
+	}
 	if lt.File == nil {
 		return
 	}
@@ -353,7 +400,16 @@ func (lg *Logs) WriteLastRowToFile(lt *LogTable) {
 		dt.WriteCSVHeaders(lt.File, etable.Tab)
 		lt.WroteHeaders = true
 	}
-	dt.WriteCSVRow(lt.File, dt.Rows-1, etable.Tab)
+	lt.writeRow(lt.File, dt.Rows-1)
+}
+
+// writeLastRowAsync formats the last row of table and queues it on the
+// async Writer, which writes the headers before the first row of the file.
+// Errors are reported by FileErr and CloseLogFiles.
+func (lg *Logs) writeLastRowAsync(lt *LogTable) {
+	var b bytes.Buffer
+	lt.writeRow(&b, lt.Table.Rows-1)
+	lt.Writer.writeRow(b.Bytes())
 }
 
 // ProcessItems is called in CreateTables, after all items have been added.
@@ -392,34 +448,48 @@ func (lg *Logs) CompileAllScopes() {
 }
 
 // ItemBindAllScopes translates the AllModes or AllTimes scopes into
-// a concrete list of actual Modes and Times used across all items
+// a concrete list of actual Modes and Times used across all items,
+// for both the Write and Conds maps.
 func (lg *Logs) ItemBindAllScopes(item *Item) {
 	newMap := WriteMap{}
 	for sk, c := range item.Write {
-		newsk := sk
-		useAllModes := false
-		useAllTimes := false
-		modes, times := sk.ModesAndTimesMap()
-		for m := range modes {
-			if m == "AllModes" {
-				useAllModes = true
-			}
-		}
-		for t := range times {
-			if t == "AllTimes" {
-				useAllTimes = true
-			}
+		newMap[lg.BindAllScope(sk)] = c
+	}
+	item.Write = newMap
+	if len(item.Conds) == 0 {
+		return
+	}
+	newConds := CondMap{}
+	for sk, c := range item.Conds {
+		newConds[lg.BindAllScope(sk)] = c
+	}
+	item.Conds = newConds
+}
+
+// BindAllScope returns the scope key with any AllModes or AllTimes
+// replaced by the concrete list of Modes and Times used across all items.
+func (lg *Logs) BindAllScope(sk etime.ScopeKey) etime.ScopeKey {
+	useAllModes := false
+	useAllTimes := false
+	modes, times := sk.ModesAndTimesMap()
+	for m := range modes {
+		if m == "AllModes" {
+			useAllModes = true
 		}
-		if useAllModes && useAllTimes {
-			newsk = etime.ScopesMap(lg.Modes, lg.Times)
-		} else if useAllModes {
-			newsk = etime.ScopesMap(lg.Modes, times)
-		} else if useAllTimes {
-			newsk = etime.ScopesMap(modes, lg.Times)
+	}
+	for t := range times {
+		if t == "AllTimes" {
+			useAllTimes = true
 		}
-		newMap[newsk] = c
 	}
-	item.Write = newMap
+	if useAllModes && useAllTimes {
+		return etime.ScopesMap(lg.Modes, lg.Times)
+	} else if useAllModes {
+		return etime.ScopesMap(lg.Modes, times)
+	} else if useAllTimes {
+		return etime.ScopesMap(modes, lg.Times)
+	}
+	return sk
 }
 
 // NewTable returns a new table configured for given mode, time scope
@@ -0,0 +1,264 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// RunAggQuantiles are the default quantiles computed by AggRunLogs,
+// giving the median and an inter-quartile band.
+var RunAggQuantiles = []float64{0.25, 0.5, 0.75}
+
+// RunLogModePrefixes are the mode prefixes of log names, as in
+// ecmd.LogFileName("tst_epc", ...), which RunLogFiles excludes from the
+// run name, so that, e.g., the "epc" logs do not include the "tst_epc" logs.
+var RunLogModePrefixes = []string{"trn", "tst", "val"}
+
+// RunLogFiles returns the list of per-run log files in given directory
+// for given network and log names, matching the ecmd.LogFileName
+// convention of netName_runName_logName.tsv, sorted by name.
+// Files whose run name ends in one of the RunLogModePrefixes are
+// excluded, as they are the logs of another mode (e.g., tst_epc for epc).
+// If dir is empty, LogDir is used.
+func RunLogFiles(dir, netName, logName string) ([]string, error) {
+	if dir == "" {
+		dir = LogDir
+	}
+	fns, err := filepath.Glob(filepath.Join(dir, netName+"_*_"+logName+".tsv"))
+	if err != nil {
+		return nil, err
+	}
+	runs := fns[:0]
+	for _, fn := range fns {
+		run := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(fn), netName+"_"), "_"+logName+".tsv")
+		if !isModeRunName(run) {
+			runs = append(runs, fn)
+		}
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// isModeRunName returns true if given run name segment of a log file
+// name ends in one of the RunLogModePrefixes
+func isModeRunName(run string) bool {
+	for _, mp := range RunLogModePrefixes {
+		if run == mp || strings.HasSuffix(run, "_"+mp) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenRunLogs opens given list of tab-separated log files, as written
+// by Logs.SetLogFile, returning one table per file.  Each table has its
+// "name" meta data set to the file name.
+func OpenRunLogs(files ...string) ([]*etable.Table, error) {
+	runs := make([]*etable.Table, 0, len(files))
+	for _, fn := range files {
+		dt := &etable.Table{}
+		err := dt.OpenCSV(gi.FileName(fn), etable.Tab)
+		if err != nil {
+			return runs, fmt.Errorf("elog.OpenRunLogs: %s: %w", fn, err)
+		}
+		dt.SetMetaData("name", filepath.Base(fn))
+		runs = append(runs, dt)
+	}
+	return runs, nil
+}
+
+// AggRunLogs computes summary statistics across runs for each column in
+// cols, aligning the rows of each run table on the alignCol counter
+// (e.g., "Epoch"), so that row i of the result summarizes all runs that
+// have that counter value.  Runs of different length are fine: N records
+// the number of runs contributing to each row.  If cols is empty, all
+// scalar numeric columns other than alignCol are used.
+// The result is written into dt with columns alignCol, N, and then
+// for each col: col:Mean, col:Sem, and col:Q<pct> for each quantile in qs
+// (RunAggQuantiles if nil).  The Sem column is set as the ErrCol
+// of the Mean column in the meta data, for plotting with error bands.
+func AggRunLogs(dt *etable.Table, runs []*etable.Table, alignCol string, qs []float64, cols ...string) error {
+	if len(runs) == 0 {
+		return fmt.Errorf("elog.AggRunLogs: no run tables")
+	}
+	if qs == nil {
+		qs = RunAggQuantiles
+	}
+	if len(cols) == 0 {
+		cols = RunAggCols(runs[0], alignCol)
+	}
+	for ri, rt := range runs {
+		if _, err := rt.ColByNameTry(alignCol); err != nil {
+			return fmt.Errorf("elog.AggRunLogs: run %d: %w", ri, err)
+		}
+	}
+
+	// rows[val] has the row index in each run with that counter value, -1 if none
+	rows := make(map[float64][]int)
+	for ri, rt := range runs {
+		ac := rt.ColByName(alignCol)
+		for r := 0; r < rt.Rows; r++ {
+			av := ac.FloatVal1D(r)
+			rr, has := rows[av]
+			if !has {
+				rr = make([]int, len(runs))
+				for i := range rr {
+					rr[i] = -1
+				}
+				rows[av] = rr
+			}
+			rr[ri] = r // last row wins if counter repeats
+		}
+	}
+	avals := make([]float64, 0, len(rows))
+	for av := range rows {
+		avals = append(avals, av)
+	}
+	sort.Float64s(avals)
+
+	sch := etable.Schema{
+		{Name: alignCol, Type: etensor.FLOAT64},
+		{Name: "N", Type: etensor.INT64},
+	}
+	for _, cn := range cols {
+		sch = append(sch, etable.Column{Name: cn + ":Mean", Type: etensor.FLOAT64})
+		sch = append(sch, etable.Column{Name: cn + ":Sem", Type: etensor.FLOAT64})
+		for _, q := range qs {
+			sch = append(sch, etable.Column{Name: RunAggQuantileName(cn, q), Type: etensor.FLOAT64})
+		}
+	}
+	dt.SetFromSchema(sch, len(avals))
+	dt.SetMetaData("name", "RunAgg")
+	dt.SetMetaData("desc", "Aggregated statistics across runs, aligned on "+alignCol)
+	dt.SetMetaData("read-only", "true")
+	dt.SetMetaData("precision", strconv.Itoa(LogPrec))
+	for _, cn := range cols {
+		dt.SetMetaData(cn+":Mean:ErrCol", cn+":Sem")
+	}
+
+	vals := make([]float64, 0, len(runs))
+	for row, av := range avals {
+		rr := rows[av]
+		dt.SetCellFloat(alignCol, row, av)
+		n := 0
+		for _, r := range rr {
+			if r >= 0 {
+				n++
+			}
+		}
+		dt.SetCellFloat("N", row, float64(n))
+		for _, cn := range cols {
+			vals = vals[:0]
+			for ri, rt := range runs {
+				r := rr[ri]
+				if r < 0 {
+					continue
+				}
+				cl := rt.ColByName(cn)
+				if cl == nil || cl.IsNull1D(r) {
+					continue
+				}
+				v := cl.FloatVal1D(r)
+				if math.IsNaN(v) {
+					continue
+				}
+				vals = append(vals, v)
+			}
+			mean, sem := MeanSem(vals)
+			dt.SetCellFloat(cn+":Mean", row, mean)
+			dt.SetCellFloat(cn+":Sem", row, sem)
+			qv := Quantiles(vals, qs)
+			for qi, q := range qs {
+				dt.SetCellFloat(RunAggQuantileName(cn, q), row, qv[qi])
+			}
+		}
+	}
+	return nil
+}
+
+// RunAggCols returns the names of the scalar numeric columns in given
+// table other than alignCol, for use in AggRunLogs.
+func RunAggCols(dt *etable.Table, alignCol string) []string {
+	var cols []string
+	for ci, cl := range dt.Cols {
+		nm := dt.ColNames[ci]
+		if nm == alignCol || cl.DataType() == etensor.STRING || cl.NumDims() > 1 {
+			continue
+		}
+		cols = append(cols, nm)
+	}
+	return cols
+}
+
+// RunAggQuantileName returns the column name for given column and quantile,
+// as col:Q<percent>, e.g., Err:Q25 for the .25 quantile.
+func RunAggQuantileName(col string, q float64) string {
+	return col + ":Q" + strconv.FormatFloat(q*100, 'g', -1, 64)
+}
+
+// MeanSem returns the mean and standard error of the mean of given values,
+// using the unbiased (n-1) variance.  Returns NaN for the mean if no values,
+// and 0 for the sem if fewer than 2 values.
+func MeanSem(vals []float64) (mean, sem float64) {
+	n := len(vals)
+	if n == 0 {
+		return math.NaN(), 0
+	}
+	for _, v := range vals {
+		mean += v
+	}
+	mean /= float64(n)
+	if n < 2 {
+		return mean, 0
+	}
+	var ss float64
+	for _, v := range vals {
+		d := v - mean
+		ss += d * d
+	}
+	sem = math.Sqrt(ss/float64(n-1)) / math.Sqrt(float64(n))
+	return
+}
+
+// Quantiles returns the given quantiles (0-1) of given values,
+// using linear interpolation, as in etable agg.Quantiles.
+// Values are sorted in place.  Returns NaN values if no values.
+func Quantiles(vals []float64, qs []float64) []float64 {
+	rvs := make([]float64, len(qs))
+	n := len(vals)
+	if n == 0 {
+		for i := range rvs {
+			rvs[i] = math.NaN()
+		}
+		return rvs
+	}
+	sort.Float64s(vals)
+	sz := n - 1
+	for i, q := range qs {
+		qi := q * float64(sz)
+		lwi := math.Floor(qi)
+		lwii := int(lwi)
+		switch {
+		case lwii >= sz:
+			rvs[i] = vals[sz]
+		case lwii < 0:
+			rvs[i] = vals[0]
+		default:
+			phi := qi - lwi
+			rvs[i] = (1-phi)*vals[lwii] + phi*vals[lwii+1]
+		}
+	}
+	return rvs
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// runagg aggregates per-run log files, as saved by separate jobs per run
+// using the ecmd.LogFileName naming convention, into one summary table
+// with mean, sem and quantiles for each column, aligned on a counter.
+//
+// Example:
+//
+//	runagg -net RA25 -log epc -align Epoch -cols PctErr,UnitErr -o RA25_epc_agg.tsv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/emer/emergent/elog"
+	"github.com/emer/etable/etable"
+	"github.com/goki/gi/gi"
+)
+
+func main() {
+	var dir, netName, logName, align, cols, qstr, out string
+	flag.StringVar(&dir, "dir", ".", "directory containing the per-run log files")
+	flag.StringVar(&netName, "net", "", "network name used in log file names (netName_runName_logName.tsv)")
+	flag.StringVar(&logName, "log", "epc", "log name used in log file names, e.g., epc, run, tst_epc")
+	flag.StringVar(&align, "align", "Epoch", "counter column to align runs on")
+	flag.StringVar(&cols, "cols", "", "comma-separated list of columns to aggregate -- all scalar numeric columns if empty")
+	flag.StringVar(&qstr, "q", "0.25,0.5,0.75", "comma-separated list of quantiles (0-1) to compute")
+	flag.StringVar(&out, "o", "", "output file name -- defaults to netName_logName_agg.tsv in dir")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		if netName == "" {
+			fmt.Fprintln(os.Stderr, "runagg: must specify -net or list files to aggregate")
+			flag.Usage()
+			os.Exit(1)
+		}
+		var err error
+		files, err = elog.RunLogFiles(dir, netName, logName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "runagg: no log files found for net: %s log: %s in: %s\n", netName, logName, dir)
+		os.Exit(1)
+	}
+	qs, err := parseQuantiles(qstr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var cnms []string
+	if cols != "" {
+		cnms = strings.Split(cols, ",")
+	}
+	runs, err := elog.OpenRunLogs(files...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	dt := &etable.Table{}
+	err = elog.AggRunLogs(dt, runs, align, qs, cnms...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if out == "" {
+		nm := netName
+		if nm == "" {
+			nm = "runs"
+		}
+		out = filepath.Join(dir, nm+"_"+logName+"_agg.tsv")
+	}
+	err = dt.SaveCSV(gi.FileName(out), etable.Tab, etable.Headers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Aggregated %d runs, %d rows, to: %s\n", len(runs), dt.Rows, out)
+}
+
+func parseQuantiles(qstr string) ([]float64, error) {
+	if qstr == "" {
+		return []float64{}, nil
+	}
+	sp := strings.Split(qstr, ",")
+	qs := make([]float64, len(sp))
+	for i, s := range sp {
+		q, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("runagg: invalid quantile: %q -- must be 0-1", s)
+		}
+		qs[i] = q
+	}
+	return qs, nil
+}
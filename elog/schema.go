@@ -0,0 +1,390 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/minmax"
+	"github.com/goki/gi/gi"
+)
+
+// SchemaVersion is the current version of the LogSchema format
+const SchemaVersion = 1
+
+// SchemaExt is the extension of the schema sidecar file written next to
+// each log file, replacing the .tsv extension of the log file.
+const SchemaExt = ".schema.json"
+
+// ItemSchema records the schema for one column of a log table,
+// including the Item plotting properties.
+type ItemSchema struct {
+	Name      string       `desc:"name of column"`
+	Type      etensor.Type `desc:"data type"`
+	CellShape []int        `desc:"shape of a single cell in the column -- nil for scalars"`
+	DimNames  []string     `desc:"names of the dimensions within the CellShape"`
+	Plot      bool         `desc:"Whether or not to plot it"`
+	Range     minmax.F64   `desc:"The minimum and maximum values, for plotting"`
+	FixMin    bool         `desc:"Whether to fix the minimum in the display"`
+	FixMax    bool         `desc:"Whether to fix the maximum in the display"`
+	ErrCol    string       `desc:"Name of other item that has the error bar values for this item"`
+	TensorIdx int          `desc:"index of tensor to plot"`
+	Color     string       `desc:"specific color for plot"`
+}
+
+// SameProps returns true if the plotting properties are the same as other
+func (is *ItemSchema) SameProps(oi *ItemSchema) bool {
+	return is.Plot == oi.Plot && is.Range == oi.Range && is.FixMin == oi.FixMin && is.FixMax == oi.FixMax && is.ErrCol == oi.ErrCol && is.TensorIdx == oi.TensorIdx && is.Color == oi.Color
+}
+
+// LogSchema is a versioned record of the columns of a log table,
+// saved as a JSON sidecar file next to log files, so that logs from
+// different versions of a sim can be checked for compatibility and
+// mapped onto the current schema.
+type LogSchema struct {
+	Version int            `desc:"version of the LogSchema format -- SchemaVersion"`
+	Scope   etime.ScopeKey `desc:"scope of the log table"`
+	Props   bool           `desc:"true if plotting properties were recorded from the Items -- false if inferred from log file headers"`
+	Items   []ItemSchema   `desc:"schema for each column, in table order"`
+}
+
+// ItemByName returns the ItemSchema for given column name, false if not found
+func (ls *LogSchema) ItemByName(name string) (*ItemSchema, bool) {
+	for i := range ls.Items {
+		if ls.Items[i].Name == name {
+			return &ls.Items[i], true
+		}
+	}
+	return nil, false
+}
+
+// SaveJSON saves the schema to a JSON file
+func (ls *LogSchema) SaveJSON(filename string) error {
+	b, err := json.MarshalIndent(ls, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+// OpenJSON opens the schema from a JSON file
+func (ls *LogSchema) OpenJSON(filename string) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, ls)
+	if err != nil {
+		return err
+	}
+	if ls.Version > SchemaVersion {
+		return fmt.Errorf("elog.LogSchema: %s has version %d, newer than supported version %d", filename, ls.Version, SchemaVersion)
+	}
+	return nil
+}
+
+// Schema returns the etable.Schema for creating a table with this schema
+func (ls *LogSchema) Schema() etable.Schema {
+	sch := make(etable.Schema, len(ls.Items))
+	for i, it := range ls.Items {
+		sch[i] = etable.Column{Name: it.Name, Type: it.Type, CellShape: it.CellShape, DimNames: it.DimNames}
+	}
+	return sch
+}
+
+// SchemaFromTable returns a LogSchema with the columns of given table,
+// without any plotting properties.  This is used for log files that
+// do not have a schema sidecar file.
+func SchemaFromTable(dt *etable.Table) *LogSchema {
+	ls := &LogSchema{Version: SchemaVersion}
+	for _, cl := range dt.Schema() {
+		ls.Items = append(ls.Items, ItemSchema{Name: cl.Name, Type: cl.Type, CellShape: cl.CellShape, DimNames: cl.DimNames})
+	}
+	return ls
+}
+
+// LogSchema returns the schema for the log table at given scope,
+// with plotting properties from the corresponding Items.
+func (lg *Logs) LogSchema(sk etime.ScopeKey) *LogSchema {
+	lt, has := lg.Tables[sk]
+	if !has {
+		return nil
+	}
+	ls := SchemaFromTable(lt.Table)
+	ls.Scope = sk
+	ls.Props = true
+	for i := range ls.Items {
+		is := &ls.Items[i]
+		itm, has := lg.ItemByName(is.Name)
+		if !has {
+			continue
+		}
+		is.Plot = itm.Plot
+		is.Range = itm.Range
+		is.FixMin = itm.FixMin
+		is.FixMax = itm.FixMax
+		is.ErrCol = itm.ErrCol
+		is.TensorIdx = itm.TensorIdx
+		is.Color = itm.Color
+	}
+	return ls
+}
+
+// SchemaFileName returns the schema sidecar file name for given log file name
+func SchemaFileName(logFile string) string {
+	return strings.TrimSuffix(logFile, filepath.Ext(logFile)) + SchemaExt
+}
+
+// SaveSchema saves the schema sidecar file for given scope next to
+// given log file name.  Called automatically by SetLogFile.
+func (lg *Logs) SaveSchema(sk etime.ScopeKey, logFile string) error {
+	ls := lg.LogSchema(sk)
+	if ls == nil {
+		return fmt.Errorf("elog.SaveSchema: scope not found: %s", sk)
+	}
+	return ls.SaveJSON(SchemaFileName(logFile))
+}
+
+// OpenLogSchema returns the schema for given log file, from its schema
+// sidecar file if it exists, or otherwise from the column headers of the
+// log file itself.
+func OpenLogSchema(logFile string) (*LogSchema, error) {
+	ls := &LogSchema{}
+	err := ls.OpenJSON(SchemaFileName(logFile))
+	if err == nil {
+		return ls, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	dt := &etable.Table{}
+	err = dt.OpenCSV(gi.FileName(logFile), etable.Tab)
+	if err != nil {
+		return nil, err
+	}
+	return SchemaFromTable(dt), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+//   Compatibility
+
+// SchemaCompat is the level of compatibility between two log schemas
+type SchemaCompat int
+
+const (
+	// SchemaSame means the columns are identical, including plot properties
+	SchemaSame SchemaCompat = iota
+
+	// SchemaCompatible means all common columns have the same shape and
+	// numeric or string type, but columns have been added or removed,
+	// changed between numeric types, or plot properties changed.
+	// Old logs can be mapped onto the new schema using MapToSchema.
+	SchemaCompatible
+
+	// SchemaIncompatible means that at least one column with the same name
+	// has a different shape, or changed between string and numeric type.  Such columns are still mapped by
+	// MapToSchema where possible, but values may be lost.
+	SchemaIncompatible
+)
+
+func (sc SchemaCompat) String() string {
+	switch sc {
+	case SchemaSame:
+		return "Same"
+	case SchemaCompatible:
+		return "Compatible"
+	default:
+		return "Incompatible"
+	}
+}
+
+// SchemaDiff reports the differences between an old and a new schema
+type SchemaDiff struct {
+	Compat    SchemaCompat `desc:"overall level of compatibility"`
+	Added     []string     `desc:"columns in new that are not in old"`
+	Removed   []string     `desc:"columns in old that are not in new"`
+	Changed   []string     `desc:"columns whose shape changed, or changed between string and numeric type -- with description"`
+	Retyped   []string     `desc:"columns that changed between numeric types (e.g., float32 to float64), which is compatible -- with description"`
+	PlotProps []string     `desc:"columns whose plotting properties changed"`
+}
+
+// CompareSchemas returns the differences in going from old to new schema.
+func CompareSchemas(old, cur *LogSchema) *SchemaDiff {
+	df := &SchemaDiff{}
+	for _, ni := range cur.Items {
+		oi, has := old.ItemByName(ni.Name)
+		if !has {
+			df.Added = append(df.Added, ni.Name)
+			continue
+		}
+		switch {
+		case oi.Type != ni.Type && (oi.Type == etensor.STRING || ni.Type == etensor.STRING):
+			df.Changed = append(df.Changed, fmt.Sprintf("%s: type %s -> %s", ni.Name, oi.Type, ni.Type))
+		case !sameInts(oi.CellShape, ni.CellShape):
+			df.Changed = append(df.Changed, fmt.Sprintf("%s: shape %v -> %v", ni.Name, oi.CellShape, ni.CellShape))
+		case oi.Type != ni.Type:
+			df.Retyped = append(df.Retyped, fmt.Sprintf("%s: type %s -> %s", ni.Name, oi.Type, ni.Type))
+		}
+		if old.Props && cur.Props && !oi.SameProps(&ni) {
+			df.PlotProps = append(df.PlotProps, ni.Name)
+		}
+	}
+	for _, oi := range old.Items {
+		if _, has := cur.ItemByName(oi.Name); !has {
+			df.Removed = append(df.Removed, oi.Name)
+		}
+	}
+	switch {
+	case len(df.Changed) > 0:
+		df.Compat = SchemaIncompatible
+	case len(df.Added) > 0 || len(df.Removed) > 0 || len(df.Retyped) > 0 || len(df.PlotProps) > 0:
+		df.Compat = SchemaCompatible
+	default:
+		df.Compat = SchemaSame
+	}
+	return df
+}
+
+// String returns a human-readable report of the differences
+func (df *SchemaDiff) String() string {
+	var b strings.Builder
+	b.WriteString("Schema: " + df.Compat.String() + "\n")
+	if len(df.Added) > 0 {
+		b.WriteString("  Added: " + strings.Join(df.Added, ", ") + "\n")
+	}
+	if len(df.Removed) > 0 {
+		b.WriteString("  Removed: " + strings.Join(df.Removed, ", ") + "\n")
+	}
+	for _, ch := range df.Changed {
+		b.WriteString("  Changed: " + ch + "\n")
+	}
+	for _, ch := range df.Retyped {
+		b.WriteString("  Retyped: " + ch + "\n")
+	}
+	if len(df.PlotProps) > 0 {
+		b.WriteString("  Plot props changed: " + strings.Join(df.PlotProps, ", ") + "\n")
+	}
+	return b.String()
+}
+
+// CheckLogFiles reports the compatibility of two log files,
+// going from the old to the new one, using their schema sidecar files
+// if present, or otherwise their column headers.
+func CheckLogFiles(oldFile, newFile string) (*SchemaDiff, error) {
+	old, err := OpenLogSchema(oldFile)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := OpenLogSchema(newFile)
+	if err != nil {
+		return nil, err
+	}
+	return CompareSchemas(old, cur), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+//   Mapping
+
+// MapToSchema configures dt to have the given schema, with the same number
+// of rows as the old table, and copies all the columns of old with the same
+// name.  Columns of a different type are converted via float or string
+// values, and tensor cells of a different shape are copied up to the
+// smaller size.  Columns not in old are set to the value in defaults if
+// present, otherwise NaN for numeric columns and "" for strings.
+func MapToSchema(dt, old *etable.Table, ls *LogSchema, defaults map[string]float64) {
+	dt.SetFromSchema(ls.Schema(), old.Rows)
+	dt.CopyMetaDataFrom(old)
+	for ci, cl := range dt.Cols {
+		nm := dt.ColNames[ci]
+		ocl := old.ColByName(nm)
+		if ocl == nil {
+			if cl.DataType() == etensor.STRING {
+				continue
+			}
+			def, has := defaults[nm]
+			if !has {
+				def = math.NaN()
+			}
+			for i := 0; i < cl.Len(); i++ {
+				cl.SetFloat1D(i, def)
+			}
+			continue
+		}
+		mapCol(cl, ocl, old.Rows)
+	}
+}
+
+// mapCol copies values from old column to new column, for given rows
+func mapCol(cl, ocl etensor.Tensor, rows int) {
+	if rows == 0 {
+		return
+	}
+	if cl.DataType() == etensor.STRING || ocl.DataType() == etensor.STRING {
+		if cl.NumDims() > 1 || ocl.NumDims() > 1 {
+			return
+		}
+		for r := 0; r < rows; r++ {
+			if cl.DataType() == etensor.STRING {
+				cl.SetString1D(r, ocl.StringVal1D(r))
+			} else {
+				cl.SetFloat1D(r, ocl.FloatVal1D(r))
+			}
+		}
+		return
+	}
+	csz := cl.Len() / rows
+	osz := ocl.Len() / rows
+	n := csz
+	if osz < n {
+		n = osz
+	}
+	for r := 0; r < rows; r++ {
+		for i := 0; i < csz; i++ {
+			if i < n {
+				cl.SetFloat1D(r*csz+i, ocl.FloatVal1D(r*osz+i))
+			} else {
+				cl.SetFloat1D(r*csz+i, math.NaN())
+			}
+		}
+	}
+}
+
+// OpenLogMapped opens given log file and maps it onto given schema
+// using MapToSchema, returning the resulting table and the differences
+// between the schema of the file and the given schema.
+func OpenLogMapped(logFile string, ls *LogSchema, defaults map[string]float64) (*etable.Table, *SchemaDiff, error) {
+	old := &etable.Table{}
+	err := old.OpenCSV(gi.FileName(logFile), etable.Tab)
+	if err != nil {
+		return nil, nil, err
+	}
+	osc, err := OpenLogSchema(logFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	dt := &etable.Table{}
+	MapToSchema(dt, old, ls, defaults)
+	return dt, CompareSchemas(osc, ls), nil
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,489 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// StreamBufSize is the number of rows buffered for each stream subscriber.
+// If a subscriber falls further behind than this, rows are dropped for
+// that subscriber, so that a slow viewer never blocks the simulation.
+var StreamBufSize = 256
+
+// StreamTensors determines how tensor columns are sent to a stream subscriber
+type StreamTensors string
+
+const (
+	// StreamTensorsOmit does not send tensor columns at all (default)
+	StreamTensorsOmit StreamTensors = "omit"
+
+	// StreamTensorsFull sends all values of tensor columns, as a flat list
+	StreamTensorsFull StreamTensors = "full"
+
+	// StreamTensorsDown sends tensor columns down-sampled to at most
+	// StreamRequest.MaxVals values, by averaging over contiguous blocks
+	StreamTensorsDown StreamTensors = "down"
+)
+
+// StreamRequest is sent by a subscriber as the first line of JSON
+// on a socket connection, or as URL query parameters for server-sent
+// events (scope=Train%26Epoch&scope=...&tensors=down&max=64), to select
+// what is sent.
+type StreamRequest struct {
+	Scopes  []etime.ScopeKey `desc:"scopes to receive rows for -- all published scopes if empty"`
+	Tensors StreamTensors    `desc:"how to send tensor columns: omit (default), full, or down"`
+	MaxVals int              `desc:"maximum number of values per tensor cell for Tensors = down"`
+}
+
+// StreamRow is one row of log data as sent to subscribers,
+// as one line of JSON (newline-delimited).
+type StreamRow struct {
+	Scope  etime.ScopeKey         `desc:"scope of the log table"`
+	Row    int                    `desc:"row number in the log table"`
+	Values map[string]interface{} `desc:"column values by name: StreamFloat, string, or []StreamFloat for tensors"`
+}
+
+// Streamer publishes each new row of selected log scopes to subscribers,
+// as newline-delimited JSON over a TCP or Unix socket, or as
+// HTTP server-sent events.  It is attached to Logs via StartStream or
+// StartStreamSSE, and rows are published automatically in LogRow.
+// Sending happens on separate goroutines, and subscribers that do not
+// keep up have rows dropped, so the simulation is never blocked.
+type Streamer struct {
+	Scopes map[etime.ScopeKey]bool `desc:"scopes that are published -- all scopes if empty -- use AddScopes to add scopes while streaming"`
+
+	mu       sync.Mutex
+	subs     map[*streamSub]bool
+	listener net.Listener
+	server   *http.Server
+}
+
+// streamSub is one subscriber connection
+type streamSub struct {
+	req    StreamRequest
+	scopes map[etime.ScopeKey]bool
+	rows   chan []byte
+	drops  int
+}
+
+// NewStreamer returns a new Streamer that publishes given scopes,
+// or all scopes if none given.
+func NewStreamer(scopes ...etime.ScopeKey) *Streamer {
+	st := &Streamer{}
+	st.Scopes = make(map[etime.ScopeKey]bool)
+	for _, sk := range scopes {
+		st.Scopes[sk] = true
+	}
+	st.subs = make(map[*streamSub]bool)
+	return st
+}
+
+// Listen starts accepting socket subscribers on given network
+// ("tcp", "unix") and address, e.g., "localhost:5555" or "/tmp/sim.sock".
+// Each subscriber first sends one line of JSON encoding a StreamRequest
+// (an empty line or {} gets defaults) and then receives one line of JSON
+// per StreamRow.
+func (st *Streamer) Listen(network, addr string) error {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.listener = ln
+	st.mu.Unlock()
+	go st.accept(ln)
+	return nil
+}
+
+// Addr returns the address of the socket listener, or nil if not listening.
+// This is useful for getting the actual port when listening on port 0.
+func (st *Streamer) Addr() net.Addr {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.listener == nil {
+		return nil
+	}
+	return st.listener.Addr()
+}
+
+// ListenSSE starts an HTTP server on given address, serving
+// server-sent events for any path (see ServeHTTP).
+func (st *Streamer) ListenSSE(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: st}
+	st.mu.Lock()
+	st.server = srv
+	st.mu.Unlock()
+	go srv.Serve(ln)
+	return nil
+}
+
+// Close stops listening and disconnects all subscribers.
+func (st *Streamer) Close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.listener != nil {
+		st.listener.Close()
+		st.listener = nil
+	}
+	if st.server != nil {
+		st.server.Close()
+		st.server = nil
+	}
+	for sb := range st.subs {
+		close(sb.rows)
+		delete(st.subs, sb)
+	}
+}
+
+// AddScopes adds given scopes to those that are published
+func (st *Streamer) AddScopes(scopes ...etime.ScopeKey) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, sk := range scopes {
+		st.Scopes[sk] = true
+	}
+}
+
+// Publish sends given row of given table to all subscribers for that scope.
+// Called automatically by Logs.LogRow when the Logs has a Streamer.
+func (st *Streamer) Publish(sk etime.ScopeKey, dt *etable.Table, row int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.Scopes) > 0 && !st.Scopes[sk] {
+		return
+	}
+	if len(st.subs) == 0 {
+		return
+	}
+	enc := make(map[streamEnc][]byte) // encode once per distinct request
+	for sb := range st.subs {
+		if len(sb.scopes) > 0 && !sb.scopes[sk] {
+			continue
+		}
+		key := streamEnc{sb.req.Tensors, sb.req.MaxVals}
+		b, has := enc[key]
+		if !has {
+			var err error
+			b, err = json.Marshal(NewStreamRow(sk, dt, row, sb.req.Tensors, sb.req.MaxVals))
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			enc[key] = b
+		}
+		select {
+		case sb.rows <- b:
+		default:
+			sb.drops++
+		}
+	}
+}
+
+// streamEnc is the key for caching row encodings
+type streamEnc struct {
+	tensors StreamTensors
+	maxVals int
+}
+
+// NewStreamRow returns a StreamRow for given row of table,
+// with tensor columns handled according to tensors and maxVals.
+func NewStreamRow(sk etime.ScopeKey, dt *etable.Table, row int, tensors StreamTensors, maxVals int) *StreamRow {
+	sr := &StreamRow{Scope: sk, Row: row}
+	sr.Values = make(map[string]interface{}, len(dt.Cols))
+	for ci, cl := range dt.Cols {
+		nm := dt.ColNames[ci]
+		switch {
+		case cl.NumDims() > 1:
+			if tensors != StreamTensorsFull && tensors != StreamTensorsDown {
+				continue
+			}
+			var vals []float64
+			dt.CellTensorIdx(ci, row).Floats(&vals)
+			if tensors == StreamTensorsDown {
+				vals = DownSample(vals, maxVals)
+			}
+			svals := make([]StreamFloat, len(vals))
+			for i, v := range vals {
+				svals[i] = StreamFloat(v)
+			}
+			sr.Values[nm] = svals
+		case cl.DataType() == etensor.STRING:
+			sr.Values[nm] = cl.StringVal1D(row)
+		default:
+			sr.Values[nm] = StreamFloat(cl.FloatVal1D(row))
+		}
+	}
+	return sr
+}
+
+// StreamFloat is a float64 that encodes values that are not valid JSON
+// numbers distinctly, so subscribers can tell them apart from real data:
+// NaN (e.g., a cell that was not written -- see Context.SetNaN) as null,
+// and Inf as the strings "+Inf" and "-Inf".
+type StreamFloat float64
+
+func (sf StreamFloat) MarshalJSON() ([]byte, error) {
+	f := float64(sf)
+	switch {
+	case math.IsNaN(f):
+		return []byte("null"), nil
+	case math.IsInf(f, 0):
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+// DownSample returns given values averaged over contiguous blocks so that
+// there are at most n values.  Returns vals unchanged if n <= 0 or
+// len(vals) <= n.
+func DownSample(vals []float64, n int) []float64 {
+	if n <= 0 || len(vals) <= n {
+		return vals
+	}
+	ds := make([]float64, n)
+	nv := len(vals)
+	for i := range ds {
+		st := (i * nv) / n
+		ed := ((i + 1) * nv) / n
+		sum := 0.0
+		for j := st; j < ed; j++ {
+			sum += vals[j]
+		}
+		ds[i] = sum / float64(ed-st)
+	}
+	return ds
+}
+
+// Drops returns the total number of rows dropped across current subscribers
+// because they were not reading fast enough.
+func (st *Streamer) Drops() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := 0
+	for sb := range st.subs {
+		n += sb.drops
+	}
+	return n
+}
+
+// NSubs returns the number of current subscribers
+func (st *Streamer) NSubs() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.subs)
+}
+
+// addSub adds a new subscriber for given request
+func (st *Streamer) addSub(req StreamRequest) *streamSub {
+	sb := &streamSub{req: req}
+	sb.scopes = make(map[etime.ScopeKey]bool)
+	for _, sk := range req.Scopes {
+		sb.scopes[sk] = true
+	}
+	sb.rows = make(chan []byte, StreamBufSize)
+	st.mu.Lock()
+	st.subs[sb] = true
+	st.mu.Unlock()
+	return sb
+}
+
+// removeSub removes given subscriber, if not already removed by Close
+func (st *Streamer) removeSub(sb *streamSub) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, has := st.subs[sb]; has {
+		delete(st.subs, sb)
+		close(sb.rows)
+	}
+}
+
+// accept accepts socket connections until the listener is closed
+func (st *Streamer) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go st.serveConn(conn)
+	}
+}
+
+// serveConn reads the request from a socket connection and then sends rows
+func (st *Streamer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	line, err := rd.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req StreamRequest
+	if ln := strings.TrimSpace(string(line)); ln != "" {
+		if err := json.Unmarshal([]byte(ln), &req); err != nil {
+			fmt.Fprintf(conn, "{\"Error\": %q}\n", err.Error())
+			return
+		}
+	}
+	sb := st.addSub(req)
+	defer st.removeSub(sb)
+	go func() { // detect client closing
+		rd.ReadBytes(0)
+		st.removeSub(sb)
+	}()
+	bw := bufio.NewWriter(conn)
+	for b := range sb.rows {
+		bw.Write(b)
+		bw.WriteByte('\n')
+		if len(sb.rows) == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ServeHTTP serves server-sent events, one "data:" event of JSON per row,
+// according to StreamRequest query parameters: scope (repeatable),
+// tensors (omit, full, down) and max.
+func (st *Streamer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	var req StreamRequest
+	for _, sc := range q["scope"] {
+		req.Scopes = append(req.Scopes, etime.ScopeKey(sc))
+	}
+	req.Tensors = StreamTensors(q.Get("tensors"))
+	if mx := q.Get("max"); mx != "" {
+		req.MaxVals, _ = strconv.Atoi(mx)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fl.Flush()
+
+	sb := st.addSub(req)
+	defer st.removeSub(sb)
+	done := r.Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case b, ok := <-sb.rows:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return
+			}
+			fl.Flush()
+		}
+	}
+}
+
+// DialStream connects to a Streamer socket at given network and address,
+// sends the given request, and returns a channel of rows received,
+// which is closed when the connection ends, along with the connection
+// which can be closed to stop receiving.
+func DialStream(network, addr string, req StreamRequest) (<-chan *StreamRow, net.Conn, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	b = append(b, '\n')
+	if _, err := conn.Write(b); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	rows := make(chan *StreamRow, StreamBufSize)
+	go func() {
+		defer close(rows)
+		sc := bufio.NewScanner(conn)
+		sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for sc.Scan() {
+			sr := &StreamRow{}
+			if err := json.Unmarshal(sc.Bytes(), sr); err != nil {
+				log.Println(err)
+				continue
+			}
+			rows <- sr
+		}
+	}()
+	return rows, conn, nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+//   Logs API
+
+// StartStream starts publishing new rows of given scopes (all if none)
+// to subscribers on given network ("tcp", "unix") and address,
+// as newline-delimited JSON.  See Streamer for details.
+func (lg *Logs) StartStream(network, addr string, scopes ...etime.ScopeKey) error {
+	st := lg.streamer(scopes)
+	err := st.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Streaming logs on: %s %s\n", network, st.Addr())
+	return nil
+}
+
+// StartStreamSSE starts publishing new rows of given scopes (all if none)
+// as HTTP server-sent events on given address.  See Streamer for details.
+func (lg *Logs) StartStreamSSE(addr string, scopes ...etime.ScopeKey) error {
+	st := lg.streamer(scopes)
+	err := st.ListenSSE(addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Streaming logs as server-sent events on: %s\n", addr)
+	return nil
+}
+
+// StopStream closes the Streamer, if active.
+func (lg *Logs) StopStream() {
+	if lg.Streamer == nil {
+		return
+	}
+	lg.Streamer.Close()
+	lg.Streamer = nil
+}
+
+// streamer returns the existing Streamer or makes a new one
+// for given scopes, adding the scopes to an existing one.
+func (lg *Logs) streamer(scopes []etime.ScopeKey) *Streamer {
+	if lg.Streamer == nil {
+		lg.Streamer = NewStreamer(scopes...)
+		return lg.Streamer
+	}
+	lg.Streamer.AddScopes(scopes...)
+	return lg.Streamer
+}
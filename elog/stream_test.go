@@ -0,0 +1,79 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+func TestStreamer(t *testing.T) {
+	dt := &etable.Table{}
+	dt.SetFromSchema(etable.Schema{
+		{Name: "Epoch", Type: etensor.INT64},
+		{Name: "Name", Type: etensor.STRING},
+		{Name: "Act", Type: etensor.FLOAT32, CellShape: []int{2, 4}},
+	}, 2)
+	for r := 0; r < 2; r++ {
+		dt.SetCellFloat("Epoch", r, float64(r))
+		dt.SetCellString("Name", r, "trl")
+		for i := 0; i < 8; i++ {
+			dt.SetCellTensorFloat1D("Act", r, i, float64(i))
+		}
+	}
+	trn := etime.Scope(etime.Train, etime.Epoch)
+	tst := etime.Scope(etime.Test, etime.Epoch)
+
+	st := NewStreamer()
+	if err := st.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	rows, conn, err := DialStream("tcp", st.Addr().String(), StreamRequest{Scopes: []etime.ScopeKey{trn}, Tensors: StreamTensorsDown, MaxVals: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for st.NSubs() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	st.Publish(tst, dt, 0) // not subscribed
+	st.Publish(trn, dt, 1)
+
+	select {
+	case sr := <-rows:
+		if sr.Scope != trn || sr.Row != 1 {
+			t.Errorf("got wrong row: %v %d", sr.Scope, sr.Row)
+		}
+		if ep := sr.Values["Epoch"].(float64); ep != 1 {
+			t.Errorf("Epoch: got %g, expected 1", ep)
+		}
+		if nm := sr.Values["Name"].(string); nm != "trl" {
+			t.Errorf("Name: got %s, expected trl", nm)
+		}
+		act := sr.Values["Act"].([]interface{})
+		if len(act) != 2 || act[0].(float64) != 1.5 || act[1].(float64) != 5.5 {
+			t.Errorf("Act: expected down-sampled [1.5 5.5], got: %v", act)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for row")
+	}
+}
+
+func TestStreamFloat(t *testing.T) {
+	b, err := json.Marshal([]StreamFloat{1.5, StreamFloat(math.NaN()), StreamFloat(math.Inf(-1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[1.5,null,"-Inf"]` {
+		t.Errorf("got: %s, expected: [1.5,null,\"-Inf\"]", b)
+	}
+}
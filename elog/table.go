@@ -5,6 +5,9 @@
 package elog
 
 import (
+	"bytes"
+	"encoding/csv"
+	"io"
 	"os"
 
 	"github.com/emer/etable/etable"
@@ -17,7 +20,11 @@ type LogTable struct {
 	IdxView      *etable.IdxView            `view:"-" desc:"Index View of the table -- automatically updated when a new row of data is logged to the table."`
 	NamedViews   map[string]*etable.IdxView `view:"-" desc:"named index views onto the table that can be saved and used across multiple items -- these are reset to nil after a new row is written -- see NamedIdxView funtion for more details."`
 	File         *os.File                   `view:"-" desc:"File to store the log into."`
+	Writer       *AsyncWriter               `view:"-" desc:"asynchronous writer for the log file, used instead of File when Logs.AsyncFiles is set -- may be shared with other tables writing to the same file"`
 	WroteHeaders bool                       `view:"-" desc:"true if headers for File have already been written"`
+
+	omit    map[string]bool // columns omitted from the file on omitRow, for Item.SkipOmit
+	omitRow int             // row that omit applies to
 }
 
 // NewLogTable returns a new LogTable entry for given table, initializing values
@@ -62,3 +69,55 @@ func (lt *LogTable) ResetIdxViews() {
 		lt.NamedViews[nm] = nil
 	}
 }
+
+// omitCell marks the cell(s) of given column at given row as Null, and
+// records that they are left empty when the row is written to the log
+// file, for Item.SkipOmit
+func (lt *LogTable) omitCell(col string, row int) {
+	cl := lt.Table.ColByName(col)
+	if cl == nil || row >= cl.Dim(0) {
+		return
+	}
+	_, csz := cl.RowCellSize()
+	for i := row * csz; i < (row+1)*csz; i++ {
+		cl.SetNull1D(i, true)
+	}
+	if lt.omit == nil || lt.omitRow != row {
+		lt.omit = make(map[string]bool)
+		lt.omitRow = row
+	}
+	lt.omit[col] = true
+}
+
+// writeRow writes given row of the table to given log file writer,
+// leaving the fields of cells marked by omitCell empty
+func (lt *LogTable) writeRow(w io.Writer, row int) {
+	dt := lt.Table
+	if len(lt.omit) == 0 || row != lt.omitRow {
+		dt.WriteCSVRow(w, row, etable.Tab)
+		return
+	}
+	var b bytes.Buffer
+	dt.WriteCSVRow(&b, row, etable.Tab)
+	cr := csv.NewReader(bytes.NewReader(b.Bytes()))
+	cr.Comma = etable.Tab.Rune()
+	rec, err := cr.Read()
+	if err != nil {
+		w.Write(b.Bytes())
+		return
+	}
+	fi := 0
+	for ci, cl := range dt.Cols {
+		_, csz := cl.RowCellSize()
+		if lt.omit[dt.ColNames[ci]] {
+			for i := fi; i < fi+csz && i < len(rec); i++ {
+				rec[i] = ""
+			}
+		}
+		fi += csz
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = etable.Tab.Rune()
+	cw.Write(rec)
+	cw.Flush()
+}
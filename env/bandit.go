@@ -0,0 +1,103 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etensor"
+)
+
+// Bandit is an RLTask with NArms choices (arms), each giving a reward
+// of Mags (default 1) with probability Probs, which can optionally
+// drift over trials (restless bandit), or be reversed at a given trial
+// (reversal learning).  The observation is a one-hot [NArms] pattern of
+// the previous choice within the episode (all 0 on the first trial).
+// Bandit episodes never terminate, so set RLEnv.MaxSteps.
+type Bandit struct {
+	Probs     []float32 `desc:"probability of reward for each arm"`
+	Mags      []float32 `desc:"magnitude of reward for each arm -- 1 if nil"`
+	Drift     float32   `desc:"standard deviation of gaussian random walk of Probs each trial, clipped to 0-1 -- 0 = stationary"`
+	Reversal  int       `desc:"if > 0, the Probs are reversed (last arm to first) after this many trials in each episode"`
+	InitProbs []float32 `view:"-" desc:"probabilities at start of each episode -- set from Probs on first Reset"`
+	Prev      int       `inactive:"+" desc:"previous choice in this episode, -1 if none"`
+	NTrials   int       `inactive:"+" desc:"number of choices made in this episode"`
+}
+
+// Config configures the bandit with given reward probabilities
+func (bd *Bandit) Config(probs ...float32) {
+	bd.Probs = append([]float32(nil), probs...)
+	bd.InitProbs = nil
+}
+
+// Validate checks that there are Probs, and Mags for each arm if set
+func (bd *Bandit) Validate() error {
+	if len(bd.Probs) == 0 {
+		return fmt.Errorf("Bandit has no Probs")
+	}
+	if bd.Mags != nil && len(bd.Mags) != len(bd.Probs) {
+		return fmt.Errorf("Bandit has %d Mags for %d Probs", len(bd.Mags), len(bd.Probs))
+	}
+	return nil
+}
+
+func (bd *Bandit) NActions() int { return len(bd.Probs) }
+
+func (bd *Bandit) ObsShape() ([]int, []string) {
+	return []int{len(bd.Probs)}, []string{"Arm"}
+}
+
+// Reset restores the initial Probs, so episodes are independent
+func (bd *Bandit) Reset(rnd erand.Rand) {
+	if bd.InitProbs == nil {
+		bd.InitProbs = append([]float32(nil), bd.Probs...)
+	} else {
+		copy(bd.Probs, bd.InitProbs)
+	}
+	bd.Prev = -1
+	bd.NTrials = 0
+}
+
+func (bd *Bandit) Act(action int, rnd erand.Rand) (float32, bool) {
+	if bd.Reversal > 0 && bd.NTrials == bd.Reversal {
+		n := len(bd.Probs)
+		for i := 0; i < n/2; i++ {
+			bd.Probs[i], bd.Probs[n-1-i] = bd.Probs[n-1-i], bd.Probs[i]
+		}
+	}
+	bd.NTrials++
+	bd.Prev = action
+	var rew float32
+	if erand.BoolP32(bd.Probs[action], -1, rnd) {
+		rew = 1
+		if bd.Mags != nil {
+			rew = bd.Mags[action]
+		}
+	}
+	if bd.Drift > 0 {
+		for i, p := range bd.Probs {
+			p += bd.Drift * float32(rnd.NormFloat64(-1))
+			switch {
+			case p < 0:
+				p = 0
+			case p > 1:
+				p = 1
+			}
+			bd.Probs[i] = p
+		}
+	}
+	return rew, false
+}
+
+func (bd *Bandit) Observe(obs *etensor.Float32) {
+	obs.SetZeros()
+	if bd.Prev >= 0 {
+		obs.Values[bd.Prev] = 1
+	}
+}
+
+// Compile-time check that implements RLTask interface
+var _ RLTask = (*Bandit)(nil)
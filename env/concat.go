@@ -0,0 +1,183 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/etable/etensor"
+)
+
+// ConcatEnv is an Env that presents a sequential concatenation of other
+// Envs: each Env in turn is presented for Trials[i] trials, or if that is
+// 0, for one of its own epochs (until its Epoch counter changes), and then
+// the next Env.  If the Env's Step returns false (e.g., at the end of an
+// episode), its segment ends early, and that step is not presented.  The ConcatEnv has its own
+// Run / Epoch / Trial counters, where one epoch is a pass through all the
+// Envs, and Counter for other time scales returns those of the current Env.
+type ConcatEnv struct {
+	Nm     string `desc:"name of this environment"`
+	Dsc    string `desc:"description of this environment"`
+	Envs   []Env  `desc:"the environments to present, in order"`
+	Trials []int  `desc:"number of trials to present from each Env -- 0 or missing = one epoch of the Env"`
+	Run    Ctr    `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch  Ctr    `view:"inline" desc:"number of times through all the Envs"`
+	Trial  Ctr    `view:"inline" desc:"current trial within the epoch"`
+	Cur    int    `inactive:"+" desc:"index of the current Env"`
+	CurTrl int    `inactive:"+" desc:"trial within the current Env's segment"`
+
+	primed []bool // Env has already been stepped to the first trial of its next segment
+}
+
+func (ce *ConcatEnv) Name() string { return ce.Nm }
+func (ce *ConcatEnv) Desc() string { return ce.Dsc }
+
+func (ce *ConcatEnv) Validate() error {
+	if len(ce.Envs) == 0 {
+		return fmt.Errorf("env.ConcatEnv: %v has no Envs", ce.Nm)
+	}
+	for _, ev := range ce.Envs {
+		if err := ev.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Init initializes the ConcatEnv and all the Envs with given run
+func (ce *ConcatEnv) Init(run int) {
+	ce.Run.Scale = Run
+	ce.Epoch.Scale = Epoch
+	ce.Trial.Scale = Trial
+	ce.Run.Init()
+	ce.Epoch.Init()
+	ce.Trial.Init()
+	ce.Run.Cur = run
+	ce.Trial.Cur = -1 // init state -- key so that first Step() = 0
+	ce.Cur = 0
+	ce.CurTrl = -1
+	ce.primed = make([]bool, len(ce.Envs))
+	for _, ev := range ce.Envs {
+		ev.Init(run)
+	}
+}
+
+// CurEnv returns the current Env
+func (ce *ConcatEnv) CurEnv() Env {
+	return ce.Envs[ce.Cur]
+}
+
+// SegTrials returns the number of trials for given Env, 0 = one epoch
+func (ce *ConcatEnv) SegTrials(idx int) int {
+	if idx < len(ce.Trials) {
+		return ce.Trials[idx]
+	}
+	return 0
+}
+
+// nextEnv moves on to the next Env, returning true if that starts
+// a new epoch
+func (ce *ConcatEnv) nextEnv() bool {
+	ce.Cur++
+	ce.CurTrl = -1
+	if ce.Cur >= len(ce.Envs) {
+		ce.Cur = 0
+		return true
+	}
+	return false
+}
+
+// stepEnv steps the current Env to the next trial of its segment,
+// returning false if its segment is done
+func (ce *ConcatEnv) stepEnv() bool {
+	ev := ce.CurEnv()
+	ntrl := ce.SegTrials(ce.Cur)
+	if ntrl > 0 && ce.CurTrl+1 >= ntrl {
+		return false
+	}
+	if ce.primed[ce.Cur] {
+		ce.primed[ce.Cur] = false
+		ce.CurTrl++
+		return true
+	}
+	if !ev.Step() { // e.g., end of an episode: segment is done
+		return false
+	}
+	if ntrl == 0 {
+		if _, _, chg := ev.Counter(Epoch); chg && ce.CurTrl >= 0 {
+			ce.primed[ce.Cur] = true // this is the first trial of its next epoch
+			return false
+		}
+	}
+	ce.CurTrl++
+	return true
+}
+
+// Step steps the current Env, moving on to the next one at the end of
+// its segment.  Returns false if no Env has any trials.
+func (ce *ConcatEnv) Step() bool {
+	ce.Epoch.Same() // good idea to just reset all non-inner-most counters at start
+	newEpc := false
+	for i := 0; i <= len(ce.Envs); i++ {
+		if ce.stepEnv() {
+			break
+		}
+		if i == len(ce.Envs) {
+			return false
+		}
+		if ce.nextEnv() {
+			newEpc = true
+		}
+	}
+	if newEpc {
+		ce.Epoch.Incr()
+		ce.Trial.Prv = ce.Trial.Cur
+		ce.Trial.Cur = 0
+		ce.Trial.Chg = true
+	} else {
+		ce.Trial.Incr()
+	}
+	return true
+}
+
+func (ce *ConcatEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return ce.Run.Query()
+	case Epoch:
+		return ce.Epoch.Query()
+	case Trial:
+		return ce.Trial.Query()
+	}
+	return ce.CurEnv().Counter(scale)
+}
+
+func (ce *ConcatEnv) State(element string) etensor.Tensor {
+	return ce.CurEnv().State(element)
+}
+
+func (ce *ConcatEnv) Action(element string, input etensor.Tensor) {
+	ce.CurEnv().Action(element, input)
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*ConcatEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (ce *ConcatEnv) Counters() []TimeScales {
+	return []TimeScales{Run, Epoch, Trial}
+}
+
+// States returns the States of the first Env, if it implements EnvDesc
+func (ce *ConcatEnv) States() Elements {
+	return envStates(ce.Envs[0])
+}
+
+// Actions returns the Actions of the first Env, if it implements EnvDesc
+func (ce *ConcatEnv) Actions() Elements {
+	return envActions(ce.Envs[0])
+}
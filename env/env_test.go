@@ -0,0 +1,34 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// testTable returns a view of a table of n rows for testing the table envs,
+// with a Name column of prefix + row number, an Input [2] column and a Freq
+// column both = row+1, and a Group column cycling through given groups.
+func testTable(prefix string, n int, groups ...string) *etable.IdxView {
+	dt := etable.New(etable.Schema{
+		{Name: "Name", Type: etensor.STRING},
+		{Name: "Group", Type: etensor.STRING},
+		{Name: "Input", Type: etensor.FLOAT32, CellShape: []int{2}},
+		{Name: "Freq", Type: etensor.FLOAT64},
+	}, n)
+	for r := 0; r < n; r++ {
+		dt.SetCellString("Name", r, fmt.Sprintf("%s%d", prefix, r))
+		if len(groups) > 0 {
+			dt.SetCellString("Group", r, groups[r%len(groups)])
+		}
+		dt.CellTensor("Input", r).SetFloat1D(0, float64(r+1))
+		dt.CellTensor("Input", r).SetFloat1D(1, float64(r+1))
+		dt.SetCellFloat("Freq", r, float64(r+1))
+	}
+	return etable.NewIdxView(dt)
+}
@@ -4,7 +4,10 @@
 
 package env
 
-import "github.com/emer/emergent/etime"
+import (
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+)
 
 // Envs is a map of environments organized according
 // to the evaluation mode string (recommended key value)
@@ -30,3 +33,37 @@ func (es *Envs) Add(evs ...Env) {
 func (es *Envs) ByMode(mode etime.Modes) Env {
 	return (*es)[mode.String()]
 }
+
+// ConfigSplits configures FixedTable envs for the etime.Train, Validate
+// and Test modes to use the given table views (e.g., from TrainValidTest
+// or KFold), skipping any that are nil.  An existing FixedTable under the
+// mode is reconfigured, and otherwise a new one is added, named by the mode,
+// with Sequential order for Validate and Test.
+func (es *Envs) ConfigSplits(trn, val, tst *etable.IdxView) {
+	es.Init()
+	views := []*etable.IdxView{trn, val, tst}
+	for i, mode := range []etime.Modes{etime.Train, etime.Validate, etime.Test} {
+		if views[i] == nil {
+			continue
+		}
+		ft, ok := es.ByMode(mode).(*FixedTable)
+		if !ok {
+			ft = &FixedTable{Nm: mode.String(), Sequential: mode != etime.Train}
+			es.Add(ft)
+		}
+		ft.Config(views[i])
+	}
+}
+
+// SplitTable splits the given table view into stratified Train, Validate
+// and Test views using TrainValidTest (keyed by run), and configures the
+// envs for those modes using ConfigSplits.  Call at the start of each run
+// for a new split.
+func (es *Envs) SplitTable(ix *etable.IdxView, col string, validate, test float64, run int) error {
+	trn, val, tst, err := TrainValidTest(ix, col, validate, test, run)
+	if err != nil {
+		return err
+	}
+	es.ConfigSplits(trn, val, tst)
+	return nil
+}
@@ -6,6 +6,7 @@ package env
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"math"
 
@@ -24,21 +25,25 @@ import (
 // It uses an IdxView indexed view of the Table, so a single shared table
 // can be used across different environments, with each having its own unique view.
 type FreqTable struct {
-	Nm         string          `desc:"name of this environment"`
-	Dsc        string          `desc:"description of this environment"`
-	Table      *etable.IdxView `desc:"this is an indexed view of the table with the set of patterns to output -- the indexes are used for the *sequential* view so you can easily sort / split / filter the patterns to be presented using this view -- we then add the random permuted Order on top of those if !sequential"`
-	NSamples   float64         `desc:"number of samples to use in constructing the list of items to present according to frequency -- number per epoch ~ NSamples * Freq -- see RndSamp option"`
-	RndSamp    bool            `desc:"if true, use random sampling of items NSamples times according to given Freq probability value -- otherwise just directly add NSamples * Freq items to the list"`
-	Sequential bool            `desc:"present items from the table in sequential order (i.e., according to the indexed view on the Table)?  otherwise permuted random order.  All repetitions of given item will be sequential if Sequential"`
-	Order      []int           `desc:"list of items to present, with repetitions -- updated every time through the list"`
-	Run        Ctr             `view:"inline" desc:"current run of model as provided during Init"`
-	Epoch      Ctr             `view:"inline" desc:"number of times through entire set of patterns"`
-	Trial      Ctr             `view:"inline" desc:"current ordinal item in Table -- if Sequential then = row number in table, otherwise is index in Order list that then gives row number in Table"`
-	TrialName  CurPrvString    `desc:"if Table has a Name column, this is the contents of that"`
-	GroupName  CurPrvString    `desc:"if Table has a Group column, this is contents of that"`
-	NameCol    string          `desc:"name of the Name column -- defaults to 'Name'"`
-	GroupCol   string          `desc:"name of the Group column -- defaults to 'Group'"`
-	FreqCol    string          `desc:"name of the Freq column -- defaults to 'Freq'"`
+	Nm         string           `desc:"name of this environment"`
+	Dsc        string           `desc:"description of this environment"`
+	Table      *etable.IdxView  `desc:"this is an indexed view of the table with the set of patterns to output -- the indexes are used for the *sequential* view so you can easily sort / split / filter the patterns to be presented using this view -- we then add the random permuted Order on top of those if !sequential"`
+	NSamples   float64          `desc:"number of samples to use in constructing the list of items to present according to frequency -- number per epoch ~ NSamples * Freq -- see RndSamp option"`
+	RndSamp    bool             `desc:"if true, use random sampling of items NSamples times according to given Freq probability value -- otherwise just directly add NSamples * Freq items to the list"`
+	Sequential bool             `desc:"present items from the table in sequential order (i.e., according to the indexed view on the Table)?  otherwise permuted random order.  All repetitions of given item will be sequential if Sequential"`
+	Order      []int            `desc:"list of items to present, with repetitions -- updated every time through the list"`
+	Run        Ctr              `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch      Ctr              `view:"inline" desc:"number of times through entire set of patterns"`
+	Trial      Ctr              `view:"inline" desc:"current ordinal item in Table -- if Sequential then = row number in table, otherwise is index in Order list that then gives row number in Table"`
+	TrialName  CurPrvString     `desc:"if Table has a Name column, this is the contents of that"`
+	GroupName  CurPrvString     `desc:"if Table has a Group column, this is contents of that"`
+	NameCol    string           `desc:"name of the Name column -- defaults to 'Name'"`
+	GroupCol   string           `desc:"name of the Group column -- defaults to 'Group'"`
+	OwnRand    bool             `desc:"use a separate random number source for the Order, seeded with RndSeed + run in Init, so its position can be saved by SaveState to resume a run exactly -- otherwise uses the global random source"`
+	RndSeed    int64            `desc:"random seed for OwnRand: the source is seeded with RndSeed + run in Init"`
+	Rand       erand.SysRand    `view:"-" desc:"random number source -- the global source unless OwnRand"`
+	RandSrc    *erand.PosSource `view:"-" desc:"random number source for OwnRand, which records its position"`
+	FreqCol    string           `desc:"name of the Freq column -- defaults to 'Freq'"`
 }
 
 func (ft *FreqTable) Name() string { return ft.Nm }
@@ -75,6 +80,12 @@ func (ft *FreqTable) Init(run int) {
 	ft.Epoch.Init()
 	ft.Trial.Init()
 	ft.Run.Cur = run
+	if ft.OwnRand {
+		ft.RandSrc = erand.NewPosRand(&ft.Rand, ft.RndSeed+int64(run))
+	} else {
+		ft.Rand.Rand = nil
+		ft.RandSrc = nil
+	}
 	ft.Sample()
 	ft.Trial.Max = len(ft.Order)
 	ft.Trial.Cur = -1 // init state -- key so that first Step() = 0
@@ -99,7 +110,7 @@ func (ft *FreqTable) Sample() {
 		if ft.RndSamp {
 			n := int(ft.NSamples)
 			for i := 0; i < n; i++ {
-				if erand.BoolP(frq, -1) {
+				if erand.BoolP(frq, -1, &ft.Rand) {
 					ft.Order = append(ft.Order, ri)
 				}
 			}
@@ -111,7 +122,7 @@ func (ft *FreqTable) Sample() {
 		}
 	}
 	if !ft.Sequential {
-		erand.PermuteInts(ft.Order)
+		erand.PermuteInts(ft.Order, &ft.Rand)
 	}
 }
 
@@ -121,6 +132,11 @@ func (ft *FreqTable) Row() int {
 	return ft.Table.Idxs[ft.Order[ft.Trial.Cur]]
 }
 
+// EpochTrials returns the number of trials in the current epoch, for EpochTrialer
+func (ft *FreqTable) EpochTrials() int {
+	return len(ft.Order)
+}
+
 func (ft *FreqTable) SetTrialName() {
 	if nms := ft.Table.Table.ColByName(ft.NameCol); nms != nil {
 		rw := ft.Row()
@@ -195,3 +211,33 @@ func (ft *FreqTable) States() Elements {
 func (ft *FreqTable) Actions() Elements {
 	return nil
 }
+
+/////////////////////////////////////////////////////
+// StateSaver
+
+// stateVars returns pointers to the state variables, for the StateSaver methods
+func (ft *FreqTable) stateVars() *tableStateVars {
+	return &tableStateVars{typ: "FreqTable", nm: ft.Nm, order: &ft.Order, run: &ft.Run, epoch: &ft.Epoch, trial: &ft.Trial, trialName: &ft.TrialName, groupName: &ft.GroupName, nrows: ft.Table.Len(), randSrc: ft.RandSrc, random: ft.RndSamp || !ft.Sequential}
+}
+
+// TableState returns the current state, for SaveState
+func (ft *FreqTable) TableState() *TableState {
+	return ft.stateVars().state()
+}
+
+// SaveState saves the counters, Order, names and random number
+// source position (if OwnRand) as JSON.  Returns an error if the env
+// uses random sampling or order without OwnRand, as the global random number
+// source cannot be saved, so the resumed run would differ.
+func (ft *FreqTable) SaveState(w io.Writer) error {
+	return ft.stateVars().save(w)
+}
+
+// LoadState loads the state saved by SaveState -- the env must have the
+// same Table and OwnRand, and have been initialized with Init.
+func (ft *FreqTable) LoadState(r io.Reader) error {
+	return ft.stateVars().load(r)
+}
+
+// Compile-time check that implements StateSaver interface
+var _ StateSaver = (*FreqTable)(nil)
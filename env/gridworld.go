@@ -0,0 +1,155 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/emergent/evec"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/ki/kit"
+)
+
+// GridActions are the actions in a GridWorld
+type GridActions int
+
+//go:generate stringer -type=GridActions
+
+var KiT_GridActions = kit.Enums.AddEnum(GridActionsN, kit.NotBitFlag, nil)
+
+func (ev GridActions) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *GridActions) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// The grid world actions
+const (
+	GridUp GridActions = iota
+	GridDown
+	GridLeft
+	GridRight
+	GridActionsN
+)
+
+// GridWorld is an RLTask where the agent moves in a 2D grid, one cell
+// per action (Up, Down, Left, Right), from the Start position to the Goal,
+// avoiding Walls.  The observation is a one-hot [Y][X] map of the agent
+// position.  Each move costs StepReward (typically negative), reaching
+// the Goal ends the episode with GoalReward, and moving into a wall
+// or the edge leaves the agent in place with BumpReward.
+type GridWorld struct {
+	Size       evec.Vec2i   `desc:"size of the grid"`
+	Start      evec.Vec2i   `desc:"starting position"`
+	RndStart   bool         `desc:"start each episode at a random free position other than the Goal, instead of Start"`
+	Goal       evec.Vec2i   `desc:"goal position"`
+	Walls      []evec.Vec2i `desc:"positions that cannot be entered"`
+	GoalReward float32      `def:"1" desc:"reward for reaching the goal"`
+	StepReward float32      `def:"0" desc:"reward for each move (e.g., a negative cost)"`
+	BumpReward float32      `def:"0" desc:"reward for moving into a wall or the edge"`
+	Pos        evec.Vec2i   `inactive:"+" desc:"current position"`
+}
+
+// Defaults sets default parameters
+func (gw *GridWorld) Defaults() {
+	gw.GoalReward = 1
+	gw.StepReward = 0
+	gw.BumpReward = 0
+}
+
+// Config configures a grid of given size, with start and goal positions,
+// and default rewards
+func (gw *GridWorld) Config(size, start, goal evec.Vec2i) {
+	gw.Defaults()
+	gw.Size = size
+	gw.Start = start
+	gw.Goal = goal
+}
+
+// IsWall returns true if given position is a wall or off the grid
+func (gw *GridWorld) IsWall(pos evec.Vec2i) bool {
+	if pos.X < 0 || pos.Y < 0 || pos.X >= gw.Size.X || pos.Y >= gw.Size.Y {
+		return true
+	}
+	for _, w := range gw.Walls {
+		if w == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the grid has a size, and a free start position:
+// Start, or, if RndStart, at least one cell other than the Goal
+func (gw *GridWorld) Validate() error {
+	if gw.Size.X < 1 || gw.Size.Y < 1 {
+		return fmt.Errorf("GridWorld Size: %v must be at least 1 x 1", gw.Size)
+	}
+	if !gw.RndStart {
+		if gw.IsWall(gw.Start) {
+			return fmt.Errorf("GridWorld Start: %v is a wall or off the grid", gw.Start)
+		}
+		return nil
+	}
+	for y := 0; y < gw.Size.Y; y++ {
+		for x := 0; x < gw.Size.X; x++ {
+			pos := evec.Vec2i{X: x, Y: y}
+			if pos != gw.Goal && !gw.IsWall(pos) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("GridWorld has no free cells other than the Goal for RndStart")
+}
+
+func (gw *GridWorld) NActions() int { return int(GridActionsN) }
+
+func (gw *GridWorld) ObsShape() ([]int, []string) {
+	return []int{gw.Size.Y, gw.Size.X}, []string{"Y", "X"}
+}
+
+// Reset starts at Start, or at a random free cell other than the Goal
+// if RndStart -- see Validate
+func (gw *GridWorld) Reset(rnd erand.Rand) {
+	if !gw.RndStart {
+		gw.Pos = gw.Start
+		return
+	}
+	for {
+		pos := evec.Vec2i{X: rnd.Intn(gw.Size.X, -1), Y: rnd.Intn(gw.Size.Y, -1)}
+		if pos != gw.Goal && !gw.IsWall(pos) {
+			gw.Pos = pos
+			return
+		}
+	}
+}
+
+func (gw *GridWorld) Act(action int, rnd erand.Rand) (float32, bool) {
+	np := gw.Pos
+	switch GridActions(action) {
+	case GridUp:
+		np.Y++
+	case GridDown:
+		np.Y--
+	case GridLeft:
+		np.X--
+	case GridRight:
+		np.X++
+	}
+	if gw.IsWall(np) {
+		return gw.BumpReward, false
+	}
+	gw.Pos = np
+	if np == gw.Goal {
+		return gw.GoalReward, true
+	}
+	return gw.StepReward, false
+}
+
+func (gw *GridWorld) Observe(obs *etensor.Float32) {
+	obs.SetZeros()
+	obs.Values[gw.Pos.Y*gw.Size.X+gw.Pos.X] = 1
+}
+
+// Compile-time check that implements RLTask interface
+var _ RLTask = (*GridWorld)(nil)
@@ -0,0 +1,100 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+)
+
+// GymServer is an environment served to a RemoteEnv by ServeGym,
+// following the Gymnasium API.  Observation and action values are those
+// decoded from or encoded to JSON: float64 for numbers, []interface{}
+// or []float64 for lists, and map[string]interface{} for Dict spaces.
+type GymServer interface {
+	// Spaces returns the observation and action spaces
+	Spaces() (obs, act *GymSpace)
+
+	// Reset starts a new episode, using given seed if non-nil,
+	// and returns the first observation
+	Reset(seed *int64) (obs interface{}, err error)
+
+	// Step performs given action, and returns the next observation,
+	// the reward, and whether the episode terminated or was truncated
+	Step(action interface{}) (obs interface{}, reward float64, term, trunc bool, err error)
+}
+
+// ServeGym serves given environment over given connection, using the
+// RemoteEnv protocol (newline-delimited JSON GymRequest / GymResponse),
+// until a close request or the end of the input.  It is a reference
+// implementation for servers in other languages, and is used for testing.
+func ServeGym(rw io.ReadWriter, gs GymServer) error {
+	rd := bufio.NewReader(rw)
+	enc := json.NewEncoder(rw) // Encode adds the newline
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(line) == 0 {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		req := &GymRequest{}
+		resp := &GymResponse{}
+		if err := json.Unmarshal(line, req); err != nil {
+			resp.Error = err.Error()
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+			continue
+		}
+		switch req.Cmd {
+		case "spaces":
+			resp.ObsSpace, resp.ActSpace = gs.Spaces()
+		case "reset":
+			resp.Obs, err = gs.Reset(req.Seed)
+		case "step":
+			resp.Obs, resp.Reward, resp.Terminated, resp.Truncated, err = gs.Step(req.Action)
+		case "close":
+		default:
+			err = fmt.Errorf("unknown command: %q", req.Cmd)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+		if req.Cmd == "close" {
+			return nil
+		}
+	}
+}
+
+// ListenGym listens on a Unix socket at given path, and serves a new
+// GymServer from newServer for each connection, until the listener is
+// closed.  It returns the listener so it can be closed.
+func ListenGym(path string, newServer func() GymServer) (net.Listener, error) {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ServeGym(conn, newServer())
+			}()
+		}
+	}()
+	return ln, nil
+}
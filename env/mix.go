@@ -0,0 +1,170 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etensor"
+)
+
+// MixEnv is an Env that presents a probabilistic mixture of other Envs,
+// e.g., 80% from env A and 20% from env B: on each Step, one of the Envs
+// is chosen at random according to Probs, and stepped, and its State
+// is presented (and Action sent to it).  The MixEnv has its own
+// Run / Epoch / Trial counters, with Trials per epoch, counting only
+// the trials presented, and Counter for other time scales returns those
+// of the current Env.
+type MixEnv struct {
+	Nm      string        `desc:"name of this environment"`
+	Dsc     string        `desc:"description of this environment"`
+	Envs    []Env         `desc:"the environments to mix"`
+	Probs   []float64     `desc:"probability of choosing each of the Envs on each trial -- normalized to sum to 1"`
+	Trials  int           `desc:"number of trials per epoch -- 0 = no epochs"`
+	RndSeed int64         `desc:"random seed: the random number source is seeded with RndSeed + run in Init, so each run is reproducible"`
+	Rand    erand.SysRand `view:"-" desc:"random number source"`
+	Run     Ctr           `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch   Ctr           `view:"inline" desc:"number of times through Trials"`
+	Trial   Ctr           `view:"inline" desc:"current trial within the epoch"`
+	Cur     int           `inactive:"+" desc:"index of the Env chosen on the current trial"`
+
+	probs []float64 // normalized Probs
+}
+
+func (me *MixEnv) Name() string { return me.Nm }
+func (me *MixEnv) Desc() string { return me.Dsc }
+
+func (me *MixEnv) Validate() error {
+	if len(me.Envs) == 0 {
+		return fmt.Errorf("env.MixEnv: %v has no Envs", me.Nm)
+	}
+	if len(me.Probs) != len(me.Envs) {
+		return fmt.Errorf("env.MixEnv: %v has %d Probs for %d Envs", me.Nm, len(me.Probs), len(me.Envs))
+	}
+	sum := 0.0
+	for _, p := range me.Probs {
+		if p < 0 {
+			return fmt.Errorf("env.MixEnv: %v has negative Probs", me.Nm)
+		}
+		sum += p
+	}
+	if sum == 0 {
+		return fmt.Errorf("env.MixEnv: %v Probs sum to 0", me.Nm)
+	}
+	for _, ev := range me.Envs {
+		if err := ev.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Init initializes the MixEnv and all the Envs with given run
+func (me *MixEnv) Init(run int) {
+	me.Rand.NewRand(me.RndSeed + int64(run))
+	me.Run.Scale = Run
+	me.Epoch.Scale = Epoch
+	me.Trial.Scale = Trial
+	me.Run.Init()
+	me.Epoch.Init()
+	me.Trial.Init()
+	me.Run.Cur = run
+	me.Trial.Max = me.Trials
+	me.Trial.Cur = -1 // init state -- key so that first Step() = 0
+	me.Cur = 0
+	sum := 0.0
+	for _, p := range me.Probs {
+		sum += p
+	}
+	me.probs = make([]float64, len(me.Probs))
+	for i, p := range me.Probs {
+		me.probs[i] = p / sum
+	}
+	for _, ev := range me.Envs {
+		ev.Init(run)
+	}
+}
+
+// CurEnv returns the Env chosen on the current trial
+func (me *MixEnv) CurEnv() Env {
+	return me.Envs[me.Cur]
+}
+
+// Step chooses an Env according to Probs and steps it,
+// returning its Step value.  If it returns false (e.g., at the end of
+// an episode), no trial is presented, and the Trial and Epoch counters
+// are not incremented.
+func (me *MixEnv) Step() bool {
+	me.Epoch.Same() // good idea to just reset all non-inner-most counters at start
+	me.Cur = erand.PChoose64(me.probs, -1, &me.Rand)
+	if !me.CurEnv().Step() {
+		return false
+	}
+	if me.Trial.Incr() {
+		me.Epoch.Incr()
+	}
+	return true
+}
+
+// Counter returns the Run, Epoch and Trial counters of the MixEnv, and
+// for other time scales, those of the current Env, which can change
+// on every trial, so these values (and chg) are those of whichever Env
+// was chosen, and do not count across the Envs.
+func (me *MixEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return me.Run.Query()
+	case Epoch:
+		return me.Epoch.Query()
+	case Trial:
+		return me.Trial.Query()
+	}
+	return me.CurEnv().Counter(scale)
+}
+
+func (me *MixEnv) State(element string) etensor.Tensor {
+	return me.CurEnv().State(element)
+}
+
+func (me *MixEnv) Action(element string, input etensor.Tensor) {
+	me.CurEnv().Action(element, input)
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*MixEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (me *MixEnv) Counters() []TimeScales {
+	return []TimeScales{Run, Epoch, Trial}
+}
+
+// States returns the States of the first Env, if it implements EnvDesc
+func (me *MixEnv) States() Elements {
+	return envStates(me.Envs[0])
+}
+
+// Actions returns the Actions of the first Env, if it implements EnvDesc
+func (me *MixEnv) Actions() Elements {
+	return envActions(me.Envs[0])
+}
+
+// envStates returns the States of given Env if it implements EnvDesc
+func envStates(ev Env) Elements {
+	if ed, ok := ev.(EnvDesc); ok {
+		return ed.States()
+	}
+	return nil
+}
+
+// envActions returns the Actions of given Env if it implements EnvDesc
+func envActions(ev Env) Elements {
+	if ed, ok := ev.(EnvDesc); ok {
+		return ed.Actions()
+	}
+	return nil
+}
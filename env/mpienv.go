@@ -0,0 +1,177 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/emer/empi/mpi"
+	"github.com/emer/etable/etensor"
+)
+
+// EpochTrialer is an optional interface for an Env that can report the
+// number of trials in its current epoch, used by MPIEnv to allocate
+// trials across MPI procs.  It is called on the first trial of each epoch.
+type EpochTrialer interface {
+	// EpochTrials returns the number of trials in the current epoch
+	EpochTrials() int
+}
+
+// MPIEnv is an Env that wraps any other Env to distribute its trials
+// across MPI procs, as MPIFixedTable does for FixedTable: each epoch of
+// the wrapped Env is divided into NProcs equal, non-overlapping blocks of
+// trials, and this proc presents only the block for its Rank, stepping
+// the wrapped Env through all the other trials without presenting them.
+// Thus, all procs must use the same random seed for the wrapped Env so it
+// remains synchronized, and the trials presented across all procs are
+// exactly those of the wrapped Env, preserving e.g., the frequency
+// weighting of FreqTable (which should not be Sequential, as each proc
+// would then get different items).  The number of trials per epoch is
+// from the EpochTrialer interface if the wrapped Env implements it, and
+// otherwise Trials.  If it is not evenly divisible by NProcs, the
+// remaining trials at the end of the epoch are skipped, so all procs
+// have the same number of trials.
+type MPIEnv struct {
+	Nm      string `desc:"name of this environment -- defaults to the name of the wrapped Env"`
+	Dsc     string `desc:"description of this environment"`
+	Env     Env    `desc:"the wrapped environment"`
+	Rank    int    `desc:"rank of this MPI proc -- see ConfigMPI"`
+	NProcs  int    `desc:"number of MPI procs -- see ConfigMPI"`
+	Trials  int    `desc:"number of trials per epoch, if the wrapped Env does not implement EpochTrialer"`
+	Epoch   Ctr    `view:"inline" desc:"epoch of the wrapped Env on the current trial"`
+	Trial   Ctr    `view:"inline" desc:"index of the current trial within the epoch of the wrapped Env -- runs from TrialSt to TrialEd-1 on this proc"`
+	TrialSt int    `inactive:"+" desc:"trial we start each epoch on"`
+	TrialEd int    `inactive:"+" desc:"trial number we end each epoch before"`
+	NTrials int    `inactive:"+" desc:"number of trials in the current epoch of the wrapped Env"`
+
+	envTrial int // index of the wrapped Env's current trial within its epoch
+}
+
+func (me *MPIEnv) Name() string {
+	if me.Nm == "" && me.Env != nil {
+		return me.Env.Name()
+	}
+	return me.Nm
+}
+
+func (me *MPIEnv) Desc() string { return me.Dsc }
+
+func (me *MPIEnv) Validate() error {
+	if me.Env == nil {
+		return fmt.Errorf("env.MPIEnv: %v has no Env", me.Nm)
+	}
+	if me.NProcs < 1 || me.Rank < 0 || me.Rank >= me.NProcs {
+		return fmt.Errorf("env.MPIEnv: %v has invalid Rank: %d for NProcs: %d", me.Nm, me.Rank, me.NProcs)
+	}
+	if _, ok := me.Env.(EpochTrialer); !ok && me.Trials < me.NProcs {
+		return fmt.Errorf("env.MPIEnv: %v Env does not implement EpochTrialer, and Trials: %d < NProcs: %d", me.Nm, me.Trials, me.NProcs)
+	}
+	return me.Env.Validate()
+}
+
+// ConfigMPI sets the Rank and NProcs from the MPI world
+func (me *MPIEnv) ConfigMPI() {
+	me.Rank = mpi.WorldRank()
+	me.NProcs = mpi.WorldSize()
+}
+
+// Init initializes the wrapped Env with given run
+func (me *MPIEnv) Init(run int) {
+	if me.NProcs < 1 {
+		me.NProcs = 1
+	}
+	me.Epoch.Scale = Epoch
+	me.Trial.Scale = Trial
+	me.Epoch.Init()
+	me.Trial.Init()
+	me.Trial.Cur = -1
+	me.envTrial = -1
+	me.Env.Init(run)
+}
+
+// epochTrials returns the number of trials in the current epoch of the Env
+func (me *MPIEnv) epochTrials() int {
+	if et, ok := me.Env.(EpochTrialer); ok {
+		return et.EpochTrials()
+	}
+	return me.Trials
+}
+
+// Step steps the wrapped Env until the next trial allocated to this proc,
+// returning the result of its Step
+func (me *MPIEnv) Step() bool {
+	me.Epoch.Same()
+	for skip := 0; ; skip++ {
+		ok := me.Env.Step()
+		epc, _, chg := me.Env.Counter(Epoch)
+		if chg || me.envTrial < 0 || (me.NTrials > 0 && me.envTrial+1 >= me.NTrials) {
+			me.envTrial = 0
+			me.NTrials = me.epochTrials()
+			per := me.NTrials / me.NProcs
+			me.TrialSt = per * me.Rank
+			me.TrialEd = me.TrialSt + per
+			if per == 0 {
+				log.Printf("env.MPIEnv: %v: epoch has %d trials, fewer than NProcs: %d\n", me.Nm, me.NTrials, me.NProcs)
+				return false
+			}
+		} else {
+			me.envTrial++
+		}
+		if me.envTrial >= me.TrialSt && me.envTrial < me.TrialEd {
+			me.Epoch.Set(epc)
+			me.Trial.Prv = me.Trial.Cur
+			me.Trial.Cur = me.envTrial
+			me.Trial.Chg = true
+			return ok
+		}
+		if skip > me.NTrials { // only possible if the Env epochs are shorter than reported
+			log.Printf("env.MPIEnv: %v: no trials for Rank: %d in epoch\n", me.Nm, me.Rank)
+			return false
+		}
+	}
+}
+
+// Counter returns the Epoch and Trial counters of the MPIEnv, and those of
+// the wrapped Env for other time scales
+func (me *MPIEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Epoch:
+		return me.Epoch.Query()
+	case Trial:
+		return me.Trial.Query()
+	}
+	return me.Env.Counter(scale)
+}
+
+func (me *MPIEnv) State(element string) etensor.Tensor {
+	return me.Env.State(element)
+}
+
+func (me *MPIEnv) Action(element string, input etensor.Tensor) {
+	me.Env.Action(element, input)
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*MPIEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+// Counters returns the Counters of the wrapped Env, if it implements EnvDesc
+func (me *MPIEnv) Counters() []TimeScales {
+	if ed, ok := me.Env.(EnvDesc); ok {
+		return ed.Counters()
+	}
+	return []TimeScales{Run, Epoch, Trial}
+}
+
+func (me *MPIEnv) States() Elements {
+	return envStates(me.Env)
+}
+
+func (me *MPIEnv) Actions() Elements {
+	return envActions(me.Env)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// mpiEpochs runs 3 epochs of the given env, returning the sorted trial names
+// of each epoch, starting from the same global random seed
+func mpiEpochs(ev Env, ft *FreqTable) []string {
+	rand.Seed(1)
+	ev.Init(0)
+	epcs := make([][]string, 3)
+	for {
+		ev.Step()
+		epc, _, _ := ev.Counter(Epoch)
+		if epc >= 3 {
+			break
+		}
+		epcs[epc] = append(epcs[epc], ft.TrialName.Cur)
+	}
+	strs := make([]string, len(epcs))
+	for i, ep := range epcs {
+		sort.Strings(ep)
+		strs[i] = strings.Join(ep, " ")
+	}
+	return strs
+}
+
+func TestMPIEnv(t *testing.T) {
+	// items of freq 1, 2, 3 and 4, for 10 trials per epoch
+	newFreq := func() *FreqTable {
+		return &FreqTable{Nm: "Freq", Table: testTable("f", 4), NSamples: 1, FreqCol: "Freq"}
+	}
+	ft := newFreq()
+	all := mpiEpochs(ft, ft)
+	for _, nprocs := range []int{2, 3} {
+		var nms [3][]string
+		for rank := 0; rank < nprocs; rank++ {
+			ft := newFreq()
+			me := &MPIEnv{Env: ft, Rank: rank, NProcs: nprocs}
+			if err := me.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			for ep, epc := range mpiEpochs(me, ft) {
+				if n := len(strings.Fields(epc)); n != 10/nprocs {
+					t.Errorf("nprocs %d rank %d epoch %d: %d trials, expected %d", nprocs, rank, ep, n, 10/nprocs)
+				}
+				nms[ep] = append(nms[ep], strings.Fields(epc)...)
+			}
+		}
+		for ep := range all {
+			sort.Strings(nms[ep])
+			// with 3 procs, one trial is skipped per epoch
+			if got := strings.Join(nms[ep], " "); nprocs == 2 && got != all[ep] {
+				t.Errorf("nprocs 2 epoch %d: ranks presented %s, expected %s", ep, got, all[ep])
+			}
+		}
+	}
+}
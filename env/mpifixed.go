@@ -6,8 +6,8 @@ package env
 
 import (
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
 
 	"github.com/emer/emergent/erand"
 	"github.com/emer/empi/empi"
@@ -27,20 +27,24 @@ import (
 // evenly divisible by number of MPI procs!
 // If all nodes start with the same seed, it should remain synchronized.
 type MPIFixedTable struct {
-	Nm         string          `desc:"name of this environment"`
-	Dsc        string          `desc:"description of this environment"`
-	Table      *etable.IdxView `desc:"this is an indexed view of the table with the set of patterns to output -- the indexes are used for the *sequential* view so you can easily sort / split / filter the patterns to be presented using this view -- we then add the random permuted Order on top of those if !sequential"`
-	Sequential bool            `desc:"present items from the table in sequential order (i.e., according to the indexed view on the Table)?  otherwise permuted random order"`
-	Order      []int           `desc:"permuted order of items to present if not sequential -- updated every time through the list"`
-	Run        Ctr             `view:"inline" desc:"current run of model as provided during Init"`
-	Epoch      Ctr             `view:"inline" desc:"number of times through entire set of patterns"`
-	Trial      Ctr             `view:"inline" desc:"current ordinal item in Table -- if Sequential then = row number in table, otherwise is index in Order list that then gives row number in Table"`
-	TrialName  CurPrvString    `desc:"if Table has a Name column, this is the contents of that"`
-	GroupName  CurPrvString    `desc:"if Table has a Group column, this is contents of that"`
-	NameCol    string          `desc:"name of the Name column -- defaults to 'Name'"`
-	GroupCol   string          `desc:"name of the Group column -- defaults to 'Group'"`
-	TrialSt    int             `desc:"for MPI, trial we start each epoch on, as index into Order"`
-	TrialEd    int             `desc:"for MPI, trial number we end each epoch before (i.e., when ctr gets to Ed, restarts)"`
+	Nm         string           `desc:"name of this environment"`
+	Dsc        string           `desc:"description of this environment"`
+	Table      *etable.IdxView  `desc:"this is an indexed view of the table with the set of patterns to output -- the indexes are used for the *sequential* view so you can easily sort / split / filter the patterns to be presented using this view -- we then add the random permuted Order on top of those if !sequential"`
+	Sequential bool             `desc:"present items from the table in sequential order (i.e., according to the indexed view on the Table)?  otherwise permuted random order"`
+	Order      []int            `desc:"permuted order of items to present if not sequential -- updated every time through the list"`
+	Run        Ctr              `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch      Ctr              `view:"inline" desc:"number of times through entire set of patterns"`
+	Trial      Ctr              `view:"inline" desc:"current ordinal item in Table -- if Sequential then = row number in table, otherwise is index in Order list that then gives row number in Table"`
+	TrialName  CurPrvString     `desc:"if Table has a Name column, this is the contents of that"`
+	GroupName  CurPrvString     `desc:"if Table has a Group column, this is contents of that"`
+	NameCol    string           `desc:"name of the Name column -- defaults to 'Name'"`
+	GroupCol   string           `desc:"name of the Group column -- defaults to 'Group'"`
+	OwnRand    bool             `desc:"use a separate random number source for the Order, seeded with RndSeed + run in Init, so its position can be saved by SaveState to resume a run exactly -- otherwise uses the global random source"`
+	RndSeed    int64            `desc:"random seed for OwnRand: the source is seeded with RndSeed + run in Init"`
+	Rand       erand.SysRand    `view:"-" desc:"random number source -- the global source unless OwnRand"`
+	RandSrc    *erand.PosSource `view:"-" desc:"random number source for OwnRand, which records its position"`
+	TrialSt    int              `desc:"for MPI, trial we start each epoch on, as index into Order"`
+	TrialEd    int              `desc:"for MPI, trial number we end each epoch before (i.e., when ctr gets to Ed, restarts)"`
 }
 
 func (ft *MPIFixedTable) Name() string { return ft.Nm }
@@ -70,6 +74,12 @@ func (ft *MPIFixedTable) Init(run int) {
 	ft.Epoch.Init()
 	ft.Trial.Init()
 	ft.Run.Cur = run
+	if ft.OwnRand {
+		ft.RandSrc = erand.NewPosRand(&ft.Rand, ft.RndSeed+int64(run))
+	} else {
+		ft.Rand.Rand = nil
+		ft.RandSrc = nil
+	}
 	ft.NewOrder()
 	ft.Trial.Cur = ft.TrialSt - 1 // init state -- key so that first Step() = ft.TrialSt
 }
@@ -77,7 +87,7 @@ func (ft *MPIFixedTable) Init(run int) {
 // NewOrder sets a new random Order based on number of rows in the table.
 func (ft *MPIFixedTable) NewOrder() {
 	np := ft.Table.Len()
-	ft.Order = rand.Perm(np) // always start with new one so random order is identical
+	ft.Order = ft.Rand.Perm(np, -1) // always start with new one so random order is identical
 	// and always maintain Order so random number usage is same regardless, and if
 	// user switches between Sequential and random at any point, it all works..
 	ft.TrialSt, ft.TrialEd, _ = empi.AllocN(np)
@@ -85,9 +95,9 @@ func (ft *MPIFixedTable) NewOrder() {
 }
 
 // PermuteOrder permutes the existing order table to get a new random sequence of inputs
-// just calls: erand.PermuteInts(ft.Order)
+// just calls: erand.PermuteInts(ft.Order, &ft.Rand)
 func (ft *MPIFixedTable) PermuteOrder() {
-	erand.PermuteInts(ft.Order)
+	erand.PermuteInts(ft.Order, &ft.Rand)
 }
 
 // Row returns the current row number in table, based on Sequential / perumuted Order and
@@ -170,3 +180,33 @@ func (ft *MPIFixedTable) Action(element string, input etensor.Tensor) {
 
 // Compile-time check that implements Env interface
 var _ Env = (*MPIFixedTable)(nil)
+
+/////////////////////////////////////////////////////
+// StateSaver
+
+// stateVars returns pointers to the state variables, for the StateSaver methods
+func (ft *MPIFixedTable) stateVars() *tableStateVars {
+	return &tableStateVars{typ: "MPIFixedTable", nm: ft.Nm, order: &ft.Order, run: &ft.Run, epoch: &ft.Epoch, trial: &ft.Trial, trialName: &ft.TrialName, groupName: &ft.GroupName, nrows: ft.Table.Len(), randSrc: ft.RandSrc, random: !ft.Sequential}
+}
+
+// TableState returns the current state, for SaveState
+func (ft *MPIFixedTable) TableState() *TableState {
+	return ft.stateVars().state()
+}
+
+// SaveState saves the counters, Order, names and random number
+// source position (if OwnRand) as JSON.  Returns an error if the env
+// uses random order without OwnRand, as the global random number
+// source cannot be saved, so the resumed run would differ.
+func (ft *MPIFixedTable) SaveState(w io.Writer) error {
+	return ft.stateVars().save(w)
+}
+
+// LoadState loads the state saved by SaveState -- the env must have the
+// same Table and OwnRand, and have been initialized with Init.
+func (ft *MPIFixedTable) LoadState(r io.Reader) error {
+	return ft.stateVars().load(r)
+}
+
+// Compile-time check that implements StateSaver interface
+var _ StateSaver = (*MPIFixedTable)(nil)
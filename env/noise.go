@@ -0,0 +1,168 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etensor"
+)
+
+// NoiseEnv is an Env that wraps another Env, and adds Gaussian noise,
+// random dropout of values, and / or occlusion of a random rectangular
+// region to the State of the given Elements (all numeric States if none
+// given -- string States are never modified).  All other methods pass
+// through to the wrapped Env, including its counters.  The modified
+// states are generated once per Step, so repeated State calls return
+// the same values.
+type NoiseEnv struct {
+	Nm       string        `desc:"name of this environment -- defaults to the name of the wrapped Env"`
+	Dsc      string        `desc:"description of this environment"`
+	Env      Env           `desc:"the wrapped environment"`
+	Elements []string      `desc:"names of the State elements to modify -- all numeric (non-string) States if empty"`
+	Noise    float64       `desc:"standard deviation of Gaussian noise added to each value -- 0 = none"`
+	Dropout  float64       `min:"0" max:"1" desc:"probability of setting each value to 0 -- 0 = none"`
+	Occlude  float64       `min:"0" max:"1" desc:"size of an occluded region, where values are set to 0, as a proportion of each of the last two dimensions (the only one for 1D), at a random position on each trial -- applies to all outer dimensions -- 0 = none"`
+	RndSeed  int64         `desc:"random seed: the random number source is seeded with RndSeed + run in Init, so each run is reproducible"`
+	Rand     erand.SysRand `view:"-" desc:"random number source"`
+
+	states map[string]*etensor.Float32 // modified states
+	gen    map[string]bool             // states generated for the current Step
+}
+
+func (ne *NoiseEnv) Name() string {
+	if ne.Nm == "" && ne.Env != nil {
+		return ne.Env.Name()
+	}
+	return ne.Nm
+}
+
+func (ne *NoiseEnv) Desc() string { return ne.Dsc }
+
+func (ne *NoiseEnv) Validate() error {
+	if ne.Env == nil {
+		return fmt.Errorf("env.NoiseEnv: %v has no Env", ne.Nm)
+	}
+	return ne.Env.Validate()
+}
+
+// Init initializes the NoiseEnv and the wrapped Env with given run
+func (ne *NoiseEnv) Init(run int) {
+	ne.Rand.NewRand(ne.RndSeed + int64(run))
+	ne.states = make(map[string]*etensor.Float32)
+	ne.gen = make(map[string]bool)
+	ne.Env.Init(run)
+}
+
+func (ne *NoiseEnv) Step() bool {
+	for el := range ne.gen {
+		delete(ne.gen, el)
+	}
+	return ne.Env.Step()
+}
+
+func (ne *NoiseEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	return ne.Env.Counter(scale)
+}
+
+// HasElement returns true if given State element is modified
+func (ne *NoiseEnv) HasElement(element string) bool {
+	if len(ne.Elements) == 0 {
+		return true
+	}
+	for _, el := range ne.Elements {
+		if el == element {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns the State of the wrapped Env, modified for the Elements
+// if numeric
+func (ne *NoiseEnv) State(element string) etensor.Tensor {
+	src := ne.Env.State(element)
+	if src == nil || src.DataType() == etensor.STRING || !ne.HasElement(element) {
+		return src
+	}
+	st, has := ne.states[element]
+	if !has {
+		st = &etensor.Float32{}
+		ne.states[element] = st
+	}
+	if !ne.gen[element] {
+		st.CopyShapeFrom(src)
+		st.CopyFrom(src)
+		ne.Modify(st)
+		ne.gen[element] = true
+	}
+	return st
+}
+
+// Modify adds noise, dropout and occlusion to given tensor
+func (ne *NoiseEnv) Modify(tsr *etensor.Float32) {
+	if ne.Noise > 0 {
+		for i := range tsr.Values {
+			tsr.Values[i] += float32(ne.Noise * ne.Rand.NormFloat64(-1))
+		}
+	}
+	if ne.Dropout > 0 {
+		for i := range tsr.Values {
+			if erand.BoolP(ne.Dropout, -1, &ne.Rand) {
+				tsr.Values[i] = 0
+			}
+		}
+	}
+	if ne.Occlude > 0 {
+		nd := tsr.NumDims()
+		nx := tsr.Dim(nd - 1)
+		ny := 1
+		if nd > 1 {
+			ny = tsr.Dim(nd - 2)
+		}
+		ox := int(math.Round(ne.Occlude * float64(nx)))
+		oy := int(math.Round(ne.Occlude * float64(ny)))
+		if nd == 1 {
+			oy = 1
+		}
+		sx := ne.Rand.Intn(nx-ox+1, -1)
+		sy := ne.Rand.Intn(ny-oy+1, -1)
+		for i := range tsr.Values {
+			x := i % nx
+			y := (i / nx) % ny
+			if x >= sx && x < sx+ox && y >= sy && y < sy+oy {
+				tsr.Values[i] = 0
+			}
+		}
+	}
+}
+
+func (ne *NoiseEnv) Action(element string, input etensor.Tensor) {
+	ne.Env.Action(element, input)
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*NoiseEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+// Counters returns the Counters of the wrapped Env, if it implements EnvDesc
+func (ne *NoiseEnv) Counters() []TimeScales {
+	if ed, ok := ne.Env.(EnvDesc); ok {
+		return ed.Counters()
+	}
+	return nil
+}
+
+func (ne *NoiseEnv) States() Elements {
+	return envStates(ne.Env)
+}
+
+func (ne *NoiseEnv) Actions() Elements {
+	return envActions(ne.Env)
+}
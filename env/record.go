@@ -0,0 +1,289 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/emer/etable/etensor"
+)
+
+// RecordEnv is an Env that wraps another Env and records its trajectory
+// to a file: every Init run, Step result, the counters of all time scales
+// in Scales, the State of all the Elements after each Step, and every
+// Action input, with the State of the Elements after it (e.g., a Reward).  ReplayEnv reproduces a recorded trajectory exactly, so a
+// model can be run on the same inputs as from a stochastic or interactive
+// Env, and any differences in its Actions detected.
+// The file has one line of JSON per record: a header with the Name, Desc,
+// Counters, States and Actions, then init, step and action records.
+// All methods pass through to the wrapped Env.
+type RecordEnv struct {
+	Nm       string       `desc:"name of this environment -- defaults to the name of the wrapped Env"`
+	Dsc      string       `desc:"description of this environment"`
+	Env      Env          `desc:"the wrapped environment"`
+	Filename string       `desc:"file to record to -- created in the first Init if not already recording"`
+	Elements []string     `desc:"names of the State elements to record -- defaults to the States of the wrapped Env if it implements EnvDesc"`
+	Scales   []TimeScales `desc:"time scales of the counters to record -- defaults to the Counters of the wrapped Env if it implements EnvDesc, otherwise Run, Epoch, Trial"`
+	Err      error        `inactive:"+" desc:"last error writing the file"`
+
+	file io.Closer
+	bw   *bufio.Writer
+	enc  *json.Encoder
+}
+
+// trajLine is one line of a recorded trajectory file
+type trajLine struct {
+	Type     string                 `json:"type"` // header, init, step or action
+	Name     string                 `json:"name,omitempty"`
+	Desc     string                 `json:"desc,omitempty"`
+	Counters []string               `json:"counters,omitempty"`
+	States   Elements               `json:"states,omitempty"`
+	Actions  Elements               `json:"actions,omitempty"`
+	Run      int                    `json:"run,omitempty"`
+	Ok       bool                   `json:"ok,omitempty"`
+	Ctrs     map[string][3]int      `json:"ctrs,omitempty"` // cur, prv, chg (0 / 1)
+	Tensors  map[string]*trajTensor `json:"tensors,omitempty"`
+	Element  string                 `json:"element,omitempty"`
+	After    map[string]*trajTensor `json:"after,omitempty"` // states after an action
+}
+
+// trajTensor is a recorded tensor
+type trajTensor struct {
+	Type    int         `json:"type"`
+	Shape   []int       `json:"shape"`
+	Names   []string    `json:"names,omitempty"`
+	Values  []trajFloat `json:"values,omitempty"`
+	Strings []string    `json:"strings,omitempty"`
+}
+
+// trajFloat is a float64 that encodes NaN and Inf as strings in JSON
+type trajFloat float64
+
+func (tf trajFloat) MarshalJSON() ([]byte, error) {
+	f := float64(tf)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+func (tf *trajFloat) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		f, err := strconv.ParseFloat(s, 64)
+		*tf = trajFloat(f)
+		return err
+	}
+	var f float64
+	err := json.Unmarshal(b, &f)
+	*tf = trajFloat(f)
+	return err
+}
+
+// newTrajTensor returns a recorded copy of given tensor
+func newTrajTensor(tsr etensor.Tensor) *trajTensor {
+	tt := &trajTensor{Type: int(tsr.DataType()), Shape: tsr.Shapes(), Names: tsr.DimNames()}
+	n := tsr.Len()
+	if tsr.DataType() == etensor.STRING {
+		tt.Strings = make([]string, n)
+		for i := range tt.Strings {
+			tt.Strings[i] = tsr.StringVal1D(i)
+		}
+		return tt
+	}
+	tt.Values = make([]trajFloat, n)
+	for i := range tt.Values {
+		tt.Values[i] = trajFloat(tsr.FloatVal1D(i))
+	}
+	return tt
+}
+
+// Tensor returns a new tensor with the recorded values
+func (tt *trajTensor) Tensor() etensor.Tensor {
+	tsr := etensor.New(etensor.Type(tt.Type), tt.Shape, nil, tt.Names)
+	if tsr == nil {
+		tsr = etensor.NewFloat64(tt.Shape, nil, tt.Names)
+	}
+	if tsr.DataType() == etensor.STRING {
+		for i, s := range tt.Strings {
+			tsr.SetString1D(i, s)
+		}
+		return tsr
+	}
+	for i, v := range tt.Values {
+		tsr.SetFloat1D(i, float64(v))
+	}
+	return tsr
+}
+
+func (re *RecordEnv) Name() string {
+	if re.Nm == "" && re.Env != nil {
+		return re.Env.Name()
+	}
+	return re.Nm
+}
+
+func (re *RecordEnv) Desc() string { return re.Dsc }
+
+func (re *RecordEnv) Validate() error {
+	if re.Env == nil {
+		return fmt.Errorf("env.RecordEnv: %v has no Env", re.Nm)
+	}
+	if re.Filename == "" && re.enc == nil {
+		return fmt.Errorf("env.RecordEnv: %v has no Filename", re.Nm)
+	}
+	return re.Env.Validate()
+}
+
+// ConfigWriter starts recording to given writer, which is closed by Close
+// if it is an io.Closer.  Writes the header record.
+func (re *RecordEnv) ConfigWriter(w io.Writer) error {
+	if len(re.Elements) == 0 {
+		for _, el := range envStates(re.Env) {
+			re.Elements = append(re.Elements, el.Name)
+		}
+	}
+	if len(re.Scales) == 0 {
+		if ed, ok := re.Env.(EnvDesc); ok {
+			re.Scales = ed.Counters()
+		} else {
+			re.Scales = []TimeScales{Run, Epoch, Trial}
+		}
+	}
+	re.file, _ = w.(io.Closer)
+	re.bw = bufio.NewWriter(w)
+	re.enc = json.NewEncoder(re.bw) // Encode adds the newline
+	re.Err = nil
+	hdr := &trajLine{Type: "header", Name: re.Env.Name(), Desc: re.Env.Desc(), States: envStates(re.Env), Actions: envActions(re.Env)}
+	for _, sc := range re.Scales {
+		hdr.Counters = append(hdr.Counters, sc.String())
+	}
+	return re.write(hdr)
+}
+
+// write writes given record, and flushes so the file is complete
+// even if the program crashes
+func (re *RecordEnv) write(tl *trajLine) error {
+	if re.enc == nil || re.Err != nil {
+		return re.Err
+	}
+	if err := re.enc.Encode(tl); err != nil {
+		re.Err = err
+		log.Println(fmt.Errorf("env.RecordEnv: %v: %w", re.Nm, err))
+		return err
+	}
+	if err := re.bw.Flush(); err != nil {
+		re.Err = err
+		log.Println(fmt.Errorf("env.RecordEnv: %v: %w", re.Nm, err))
+	}
+	return re.Err
+}
+
+// Close stops recording, closing the file
+func (re *RecordEnv) Close() error {
+	var err error
+	if re.bw != nil {
+		err = re.bw.Flush()
+	}
+	if re.file != nil {
+		if cerr := re.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	re.file = nil
+	re.bw = nil
+	re.enc = nil
+	return err
+}
+
+// Init initializes the wrapped Env, creating the Filename if not
+// already recording, and records the run
+func (re *RecordEnv) Init(run int) {
+	if re.enc == nil {
+		fp, err := os.Create(re.Filename)
+		if err != nil {
+			re.Err = err
+			log.Println(fmt.Errorf("env.RecordEnv: %v: %w", re.Nm, err))
+		} else {
+			re.ConfigWriter(fp)
+		}
+	}
+	re.Env.Init(run)
+	re.write(&trajLine{Type: "init", Run: run})
+}
+
+// Step steps the wrapped Env, and records the result, counters and States
+func (re *RecordEnv) Step() bool {
+	ok := re.Env.Step()
+	tl := &trajLine{Type: "step", Ok: ok, Ctrs: make(map[string][3]int)}
+	for _, sc := range re.Scales {
+		cur, prv, chg := re.Env.Counter(sc)
+		ch := 0
+		if chg {
+			ch = 1
+		}
+		tl.Ctrs[sc.String()] = [3]int{cur, prv, ch}
+	}
+	tl.Tensors = re.states()
+	re.write(tl)
+	return ok
+}
+
+// states returns the recorded States of the Elements
+func (re *RecordEnv) states() map[string]*trajTensor {
+	sts := make(map[string]*trajTensor)
+	for _, el := range re.Elements {
+		if st := re.Env.State(el); st != nil {
+			sts[el] = newTrajTensor(st)
+		}
+	}
+	return sts
+}
+
+func (re *RecordEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	return re.Env.Counter(scale)
+}
+
+func (re *RecordEnv) State(element string) etensor.Tensor {
+	return re.Env.State(element)
+}
+
+// Action sends the input to the wrapped Env, and records it, along with
+// the States after it
+func (re *RecordEnv) Action(element string, input etensor.Tensor) {
+	re.Env.Action(element, input)
+	if input != nil {
+		re.write(&trajLine{Type: "action", Element: element, Tensors: map[string]*trajTensor{element: newTrajTensor(input)}, After: re.states()})
+	}
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*RecordEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+// Counters returns the Counters of the wrapped Env, if it implements EnvDesc
+func (re *RecordEnv) Counters() []TimeScales {
+	if ed, ok := re.Env.(EnvDesc); ok {
+		return ed.Counters()
+	}
+	return nil
+}
+
+func (re *RecordEnv) States() Elements {
+	return envStates(re.Env)
+}
+
+func (re *RecordEnv) Actions() Elements {
+	return envActions(re.Env)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/emer/etable/etensor"
+)
+
+func TestRecordReplay(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "traj.jsonl")
+	bd := &Bandit{}
+	bd.Config(.2, .5, .8)
+	rl := &RLEnv{Nm: "Bandit", Task: bd, MaxSteps: 5, RndSeed: 3}
+	re := &RecordEnv{Env: rl, Filename: fn}
+	if err := re.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	act := etensor.NewFloat32([]int{3}, nil, nil)
+	var recs []string
+	for run := 0; run < 2; run++ {
+		re.Init(run)
+		for i := 0; i < 12; i++ {
+			ok := re.Step()
+			epc, _, chg := re.Counter(Episode)
+			act.SetZeros()
+			act.Values[i%3] = 1
+			re.Action("Action", act)
+			recs = append(recs, fmt.Sprint(ok, epc, chg, re.State("Obs").(*etensor.Float32).Values, re.State("Reward").FloatVal1D(0)))
+		}
+	}
+	re.Close()
+
+	rp := &ReplayEnv{Filename: fn}
+	if err := rp.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if rp.Name() != "Bandit" || len(rp.Counters()) != 3 || len(rp.States()) != 2 {
+		t.Errorf("header not replayed: %s %v %v", rp.Name(), rp.Counters(), rp.States())
+	}
+	for run := 1; run >= 0; run-- {
+		rp.Init(run)
+		for i := 0; i < 12; i++ {
+			ok := rp.Step()
+			epc, _, chg := rp.Counter(Episode)
+			act.SetZeros()
+			act.Values[i%3] = 1
+			if run == 1 && i == 4 {
+				act.Values[0] = 1 // different action
+			}
+			rp.Action("Action", act)
+			got := fmt.Sprint(ok, epc, chg, rp.State("Obs").(*etensor.Float32).Values, rp.State("Reward").FloatVal1D(0))
+			if exp := recs[run*12+i]; got != exp {
+				t.Errorf("run %d step %d: replayed %s, recorded %s", run, i, got, exp)
+			}
+		}
+		if rp.Step() || !rp.Done {
+			t.Errorf("run %d: replay did not end", run)
+		}
+		if run == 1 && rp.ActDiffs != 1 {
+			t.Errorf("run 1: ActDiffs = %d, expected 1: %s", rp.ActDiffs, rp.LastDiff)
+		}
+		if run == 0 && rp.ActDiffs != 0 {
+			t.Errorf("run 0: ActDiffs = %d: %s", rp.ActDiffs, rp.LastDiff)
+		}
+	}
+}
+
+func TestTrajTensor(t *testing.T) {
+	tsr := etensor.NewFloat64([]int{2, 2}, nil, []string{"Y", "X"})
+	tsr.Values = []float64{1, math.NaN(), math.Inf(1), -2.5}
+	b, err := json.Marshal(newTrajTensor(tsr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := &trajTensor{}
+	if err := json.Unmarshal(b, tt); err != nil {
+		t.Fatal(err)
+	}
+	rt := tt.Tensor().(*etensor.Float64)
+	if rt.Dim(1) != 2 || rt.DimNames()[1] != "X" || rt.Values[0] != 1 || !math.IsNaN(rt.Values[1]) || !math.IsInf(rt.Values[2], 1) || rt.Values[3] != -2.5 {
+		t.Errorf("tensor not restored: %v", rt)
+	}
+}
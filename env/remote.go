@@ -0,0 +1,521 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/emer/etable/etensor"
+)
+
+// GymSpace describes an observation or action space, following
+// the Gymnasium spaces: Box (continuous values of given Shape),
+// Discrete (one of N values, as a one-hot [N] tensor),
+// MultiBinary (0 / 1 values of given Shape), or Dict (named sub-spaces,
+// each of which is a separate Element).
+type GymSpace struct {
+	Type   string               `json:"type" desc:"type of space: Box, Discrete, MultiBinary or Dict"`
+	Shape  []int                `json:"shape,omitempty" desc:"shape of the values for Box and MultiBinary"`
+	N      int                  `json:"n,omitempty" desc:"number of values for Discrete"`
+	Spaces map[string]*GymSpace `json:"spaces,omitempty" desc:"named sub-spaces for Dict"`
+}
+
+// TensorShape returns the shape of the tensor for this space
+func (sp *GymSpace) TensorShape() []int {
+	if sp.Type == "Discrete" {
+		return []int{sp.N}
+	}
+	if len(sp.Shape) == 0 {
+		return []int{1}
+	}
+	return sp.Shape
+}
+
+// Elements returns the Elements for this space: one per sub-space for
+// Dict, sorted by name, otherwise one with given name
+func (sp *GymSpace) Elements(name string) Elements {
+	if sp.Type != "Dict" {
+		return Elements{{Name: name, Shape: sp.TensorShape()}}
+	}
+	nms := sp.Names()
+	els := make(Elements, len(nms))
+	for i, nm := range nms {
+		els[i] = Element{Name: nm, Shape: sp.Spaces[nm].TensorShape()}
+	}
+	return els
+}
+
+// Names returns the sorted names of the sub-spaces for Dict
+func (sp *GymSpace) Names() []string {
+	nms := make([]string, 0, len(sp.Spaces))
+	for nm := range sp.Spaces {
+		nms = append(nms, nm)
+	}
+	sort.Strings(nms)
+	return nms
+}
+
+// SetTensor sets given tensor from a value decoded from JSON for this
+// space: a number (Discrete index, or single value), or nested lists
+// of numbers (Box, MultiBinary), which are flattened in row-major order.
+func (sp *GymSpace) SetTensor(tsr etensor.Tensor, val interface{}) error {
+	tsr.SetShape(sp.TensorShape(), nil, nil)
+	if sp.Type == "Discrete" {
+		tsr.SetZeros()
+		idx, ok := val.(float64)
+		if !ok || int(idx) < 0 || int(idx) >= sp.N {
+			return fmt.Errorf("env.GymSpace: invalid Discrete value: %v", val)
+		}
+		tsr.SetFloat1D(int(idx), 1)
+		return nil
+	}
+	vals := flattenJSON(val, nil)
+	if len(vals) != tsr.Len() {
+		return fmt.Errorf("env.GymSpace: %s value has %d values, expected %d", sp.Type, len(vals), tsr.Len())
+	}
+	for i, v := range vals {
+		tsr.SetFloat1D(i, v)
+	}
+	return nil
+}
+
+// Value returns the value to send in JSON for given tensor in this space:
+// the index of the maximum value for Discrete, otherwise a flat list
+// of values (zeros if nil).
+func (sp *GymSpace) Value(tsr etensor.Tensor) interface{} {
+	if sp.Type == "Discrete" {
+		if tsr == nil || tsr.Len() == 0 {
+			return 0
+		}
+		if tsr.Len() == 1 {
+			return int(tsr.FloatVal1D(0))
+		}
+		mx := 0
+		for i := 1; i < tsr.Len(); i++ {
+			if tsr.FloatVal1D(i) > tsr.FloatVal1D(mx) {
+				mx = i
+			}
+		}
+		return mx
+	}
+	n := 1
+	for _, d := range sp.TensorShape() {
+		n *= d
+	}
+	vals := make([]float64, n)
+	if tsr != nil {
+		for i := 0; i < n && i < tsr.Len(); i++ {
+			vals[i] = tsr.FloatVal1D(i)
+		}
+	}
+	return vals
+}
+
+// flattenJSON appends the numbers in given JSON value to vals
+func flattenJSON(val interface{}, vals []float64) []float64 {
+	switch v := val.(type) {
+	case float64:
+		vals = append(vals, v)
+	case bool:
+		if v {
+			vals = append(vals, 1)
+		} else {
+			vals = append(vals, 0)
+		}
+	case []interface{}:
+		for _, e := range v {
+			vals = flattenJSON(e, vals)
+		}
+	}
+	return vals
+}
+
+// GymRequest is a request sent to a remote environment, as one line of JSON.
+// Cmd is one of: spaces, reset, step, close.
+type GymRequest struct {
+	Cmd    string      `json:"cmd" desc:"command: spaces, reset, step, or close"`
+	Seed   *int64      `json:"seed,omitempty" desc:"random seed for reset -- only sent on the first reset of a run"`
+	Action interface{} `json:"action,omitempty" desc:"action for step: int for Discrete, list of numbers for Box, or object of these for Dict"`
+}
+
+// GymResponse is the response from a remote environment, as one line of JSON.
+type GymResponse struct {
+	ObsSpace   *GymSpace   `json:"observation_space,omitempty" desc:"observation space, for spaces"`
+	ActSpace   *GymSpace   `json:"action_space,omitempty" desc:"action space, for spaces"`
+	Obs        interface{} `json:"observation,omitempty" desc:"observation, for reset and step"`
+	Reward     float64     `json:"reward" desc:"reward, for step"`
+	Terminated bool        `json:"terminated" desc:"episode reached a terminal state, for step"`
+	Truncated  bool        `json:"truncated" desc:"episode was cut short, e.g., by a time limit, for step"`
+	Error      string      `json:"error,omitempty" desc:"error message if the request failed"`
+}
+
+// RemoteEnv is an Env for an environment running in another process,
+// e.g., a Python Gymnasium environment, which communicates over the
+// stdin / stdout of a subprocess started with Command, or a Unix Socket,
+// using newline-delimited JSON GymRequest and GymResponse messages
+// modeled on the Gymnasium API.  The observation and action spaces
+// are translated to etensor Elements: a Dict space has an element for
+// each sub-space, and otherwise the elements are named Observation and
+// Action.  The Reward is available as the Reward State.
+//
+// On each trial, the model reads the observation, and sends its choice
+// using Action, which sends a step request when all the action elements
+// have been set, after which the Reward is available.  Step returns false
+// when the episode has ended (terminated or truncated, or MaxSteps trials),
+// and the following Step resets the environment for a new episode.
+// Errors are logged and recorded in Err, and Step returns false after an error.
+type RemoteEnv struct {
+	Nm       string                      `desc:"name of this environment"`
+	Dsc      string                      `desc:"description of this environment"`
+	Command  []string                    `desc:"command and args to start the environment subprocess, which communicates over its stdin / stdout"`
+	Socket   string                      `desc:"path of Unix socket to connect to, if Command is empty"`
+	Seed     int64                       `desc:"random seed sent with the first reset of each run, as Seed + run"`
+	MaxSteps int                         `desc:"maximum number of trials per episode -- 0 = no limit beyond the remote environment's own truncation"`
+	Run      Ctr                         `view:"inline" desc:"current run of model as provided during Init"`
+	Episode  Ctr                         `view:"inline" desc:"number of episodes"`
+	Trial    Ctr                         `view:"inline" desc:"trial within the episode"`
+	ObsSpace *GymSpace                   `desc:"observation space from the remote environment"`
+	ActSpace *GymSpace                   `desc:"action space from the remote environment"`
+	Obs      map[string]*etensor.Float32 `desc:"current observation, by element name"`
+	Reward   etensor.Float32             `desc:"reward from the last step, [1] -- 0 before the action on each trial"`
+	EpReward float32                     `inactive:"+" desc:"cumulative reward over the current episode"`
+	Term     bool                        `inactive:"+" desc:"true if the last step reached a terminal state"`
+	Trunc    bool                        `inactive:"+" desc:"true if the last step truncated the episode"`
+	Done     bool                        `inactive:"+" desc:"true if the current episode is over -- next Step starts a new episode"`
+	Err      error                       `inactive:"+" desc:"last communication error"`
+
+	acts    map[string]etensor.Tensor // pending actions for this trial
+	stepped bool                      // step has been sent on this trial
+	nextObs interface{}               // observation from the last step, set on next Step
+	seedRun bool                      // send seed on next reset
+	conn    io.ReadWriteCloser
+	rd      *bufio.Reader
+	cmd     *exec.Cmd
+}
+
+func (ev *RemoteEnv) Name() string { return ev.Nm }
+func (ev *RemoteEnv) Desc() string { return ev.Dsc }
+
+// Validate connects to the remote environment if not already connected,
+// and gets its observation and action spaces
+func (ev *RemoteEnv) Validate() error {
+	if ev.conn != nil {
+		return nil
+	}
+	return ev.Connect()
+}
+
+// Connect starts the Command subprocess, or connects to the Unix Socket,
+// and gets the observation and action spaces
+func (ev *RemoteEnv) Connect() error {
+	switch {
+	case len(ev.Command) > 0:
+		cmd := exec.Command(ev.Command[0], ev.Command[1:]...)
+		cmd.Stderr = os.Stderr
+		wr, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		rd, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("env.RemoteEnv: %v could not start command: %w", ev.Nm, err)
+		}
+		ev.cmd = cmd
+		if err := ev.ConfigConn(&pipeConn{Reader: rd, WriteCloser: wr}); err != nil {
+			ev.conn = nil
+			ev.cmd = nil
+			wr.Close()
+			rd.Close()
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+		return nil
+	case ev.Socket != "":
+		conn, err := net.Dial("unix", ev.Socket)
+		if err != nil {
+			return fmt.Errorf("env.RemoteEnv: %v could not connect to socket: %w", ev.Nm, err)
+		}
+		if err := ev.ConfigConn(conn); err != nil {
+			ev.conn = nil
+			conn.Close()
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("env.RemoteEnv: %v has no Command or Socket set", ev.Nm)
+}
+
+// ConfigConn configures the environment to communicate over given
+// connection, and gets the observation and action spaces.
+// Use this to connect in other ways than Command or Socket.
+func (ev *RemoteEnv) ConfigConn(conn io.ReadWriteCloser) error {
+	ev.conn = conn
+	ev.rd = bufio.NewReader(conn)
+	resp, err := ev.request(&GymRequest{Cmd: "spaces"})
+	if err != nil {
+		return err
+	}
+	if resp.ObsSpace == nil || resp.ActSpace == nil {
+		return fmt.Errorf("env.RemoteEnv: %v did not receive observation and action spaces", ev.Nm)
+	}
+	ev.ObsSpace = resp.ObsSpace
+	ev.ActSpace = resp.ActSpace
+	ev.Obs = make(map[string]*etensor.Float32)
+	for _, el := range ev.ObsSpace.Elements("Observation") {
+		ev.Obs[el.Name] = etensor.NewFloat32(el.Shape, nil, nil)
+	}
+	return nil
+}
+
+// Close sends the close command, and closes the connection, waiting
+// for the subprocess to exit if started with Command
+func (ev *RemoteEnv) Close() error {
+	if ev.conn == nil {
+		return nil
+	}
+	_, err := ev.request(&GymRequest{Cmd: "close"})
+	if cerr := ev.conn.Close(); err == nil {
+		err = cerr
+	}
+	if ev.cmd != nil {
+		if werr := ev.cmd.Wait(); err == nil {
+			err = werr
+		}
+		ev.cmd = nil
+	}
+	ev.conn = nil
+	return err
+}
+
+// request sends given request and returns the response
+func (ev *RemoteEnv) request(req *GymRequest) (*GymResponse, error) {
+	if ev.conn == nil {
+		return nil, fmt.Errorf("env.RemoteEnv: %v is not connected", ev.Nm)
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ev.conn.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	line, err := ev.rd.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	resp := &GymResponse{}
+	if err := json.Unmarshal(line, resp); err != nil {
+		return nil, fmt.Errorf("env.RemoteEnv: %v invalid response: %w", ev.Nm, err)
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("env.RemoteEnv: %v %s: %s", ev.Nm, req.Cmd, resp.Error)
+	}
+	return resp, nil
+}
+
+// setErr records and logs given error, returning true if non-nil
+func (ev *RemoteEnv) setErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	ev.Err = err
+	log.Println(err)
+	return true
+}
+
+func (ev *RemoteEnv) Init(run int) {
+	ev.Run.Scale = Run
+	ev.Episode.Scale = Episode
+	ev.Trial.Scale = Trial
+	ev.Run.Init()
+	ev.Episode.Init()
+	ev.Trial.Init()
+	ev.Run.Cur = run
+	ev.Episode.Cur = -1 // first Step starts episode 0
+	ev.Trial.Cur = -1
+	ev.Reward.SetShape([]int{1}, nil, nil)
+	ev.Done = true
+	ev.seedRun = true
+	ev.Err = nil
+}
+
+// NewEpisode resets the remote environment for a new episode
+func (ev *RemoteEnv) NewEpisode() bool {
+	req := &GymRequest{Cmd: "reset"}
+	if ev.seedRun {
+		seed := ev.Seed + int64(ev.Run.Cur)
+		req.Seed = &seed
+		ev.seedRun = false
+	}
+	resp, err := ev.request(req)
+	if ev.setErr(err) {
+		return false
+	}
+	ev.Episode.Incr()
+	ev.Trial.Init()
+	ev.Trial.Chg = true
+	ev.EpReward = 0
+	ev.Done = false
+	ev.Term = false
+	ev.Trunc = false
+	ev.newTrial(resp.Obs)
+	return ev.Err == nil
+}
+
+// newTrial sets the observation and clears the action and reward
+func (ev *RemoteEnv) newTrial(obs interface{}) {
+	ev.stepped = false
+	ev.acts = make(map[string]etensor.Tensor)
+	ev.Reward.SetZeros()
+	if ev.ObsSpace.Type != "Dict" {
+		ev.setErr(ev.ObsSpace.SetTensor(ev.Obs["Observation"], obs))
+		return
+	}
+	om, ok := obs.(map[string]interface{})
+	if !ok {
+		ev.setErr(fmt.Errorf("env.RemoteEnv: %v Dict observation is not an object: %v", ev.Nm, obs))
+		return
+	}
+	for nm, sp := range ev.ObsSpace.Spaces {
+		ev.setErr(sp.SetTensor(ev.Obs[nm], om[nm]))
+	}
+}
+
+// Step advances to the next trial, returning false if the episode has
+// ended, or there was an error.  If no action was sent on the trial,
+// a step is sent with zero values (action 0 for Discrete).
+// After the end of an episode, the next call starts a new episode.
+func (ev *RemoteEnv) Step() bool {
+	ev.Episode.Same()
+	ev.Trial.Same()
+	if ev.Err != nil {
+		return false
+	}
+	if ev.Done {
+		return ev.NewEpisode()
+	}
+	if !ev.stepped && !ev.SendStep() {
+		return false
+	}
+	if ev.Term || ev.Trunc || (ev.MaxSteps > 0 && ev.Trial.Cur+1 >= ev.MaxSteps) {
+		ev.Done = true
+		return false
+	}
+	ev.Trial.Incr()
+	ev.newTrial(ev.nextObs)
+	return ev.Err == nil
+}
+
+// SendStep sends a step request with the actions set on this trial
+// (zero values for those not set), setting the Reward.
+// Returns false if there was an error.
+func (ev *RemoteEnv) SendStep() bool {
+	req := &GymRequest{Cmd: "step"}
+	if ev.ActSpace.Type == "Dict" {
+		am := make(map[string]interface{}, len(ev.ActSpace.Spaces))
+		for nm, sp := range ev.ActSpace.Spaces {
+			am[nm] = sp.Value(ev.acts[nm])
+		}
+		req.Action = am
+	} else {
+		req.Action = ev.ActSpace.Value(ev.acts["Action"])
+	}
+	resp, err := ev.request(req)
+	if ev.setErr(err) {
+		return false
+	}
+	ev.stepped = true
+	ev.Reward.Values[0] = float32(resp.Reward)
+	ev.EpReward += float32(resp.Reward)
+	ev.Term = resp.Terminated
+	ev.Trunc = resp.Truncated
+	ev.nextObs = resp.Obs
+	return true
+}
+
+func (ev *RemoteEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return ev.Run.Query()
+	case Episode:
+		return ev.Episode.Query()
+	case Trial:
+		return ev.Trial.Query()
+	}
+	return -1, -1, false
+}
+
+func (ev *RemoteEnv) State(element string) etensor.Tensor {
+	if element == "Reward" {
+		return &ev.Reward
+	}
+	if tsr, has := ev.Obs[element]; has {
+		return tsr
+	}
+	return nil
+}
+
+// Action sets the action for given element, and sends the step request
+// when all action elements have been set on this trial.
+// Actions after the step has been sent on a trial are ignored.
+func (ev *RemoteEnv) Action(element string, input etensor.Tensor) {
+	if input == nil || ev.Done || ev.stepped || ev.Err != nil || ev.ActSpace == nil {
+		return
+	}
+	if ev.ActSpace.Type == "Dict" {
+		if _, has := ev.ActSpace.Spaces[element]; !has {
+			return
+		}
+	} else if element != "Action" {
+		return
+	}
+	ev.acts[element] = input.Clone()
+	if ev.ActSpace.Type != "Dict" || len(ev.acts) == len(ev.ActSpace.Spaces) {
+		ev.SendStep()
+	}
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*RemoteEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (ev *RemoteEnv) Counters() []TimeScales {
+	return []TimeScales{Run, Episode, Trial}
+}
+
+func (ev *RemoteEnv) States() Elements {
+	if ev.ObsSpace == nil {
+		return nil
+	}
+	els := ev.ObsSpace.Elements("Observation")
+	return append(els, Element{Name: "Reward", Shape: []int{1}})
+}
+
+func (ev *RemoteEnv) Actions() Elements {
+	if ev.ActSpace == nil {
+		return nil
+	}
+	return ev.ActSpace.Elements("Action")
+}
+
+// pipeConn combines the stdout and stdin pipes of a subprocess
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
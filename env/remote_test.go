@@ -0,0 +1,191 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/emer/etable/etensor"
+)
+
+// when set, the test binary serves a gymStub on stdin / stdout,
+// for testing RemoteEnv.Command
+const gymStubEnvVar = "EMERGENT_GYM_STUB"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(gymStubEnvVar) != "" {
+		rw := struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}
+		if err := ServeGym(rw, &gymStub{Size: 3}); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testRemoteEnv runs two episodes of the gymStub corridor
+func testRemoteEnv(t *testing.T, ev *RemoteEnv) {
+	t.Helper()
+	if err := ev.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	els := ev.States()
+	if len(els) != 3 || els[0].Name != "Dist" || els[1].Name != "Pos" || els[1].Shape[0] != 3 || els[2].Name != "Reward" {
+		t.Errorf("States wrong: %v", els)
+	}
+	if acts := ev.Actions(); len(acts) != 1 || acts[0].Name != "Action" || acts[0].Shape[0] != 2 {
+		t.Errorf("Actions wrong: %v", acts)
+	}
+	ev.Init(1)
+	right := etensor.NewFloat32([]int{2}, nil, nil)
+	right.Values[1] = 1
+	for ep := 0; ep < 2; ep++ {
+		for trl := 0; trl < 2; trl++ {
+			if !ev.Step() {
+				t.Fatalf("episode %d ended early at trial %d: %v", ep, trl, ev.Err)
+			}
+			if cur, _, _ := ev.Counter(Episode); cur != ep {
+				t.Errorf("Episode = %d, expected %d", cur, ep)
+			}
+			if ev.State("Pos").FloatVal1D(trl) != 1 || ev.State("Dist").FloatVal1D(0) != float64(trl) {
+				t.Errorf("observation wrong at trial %d: Pos: %v  Dist: %v", trl, ev.State("Pos"), ev.State("Dist"))
+			}
+			ev.Action("Action", right)
+		}
+		if rew := ev.State("Reward").FloatVal1D(0); rew != 1 || !ev.Term {
+			t.Errorf("goal reward = %g, terminated: %v", rew, ev.Term)
+		}
+		if ev.Step() {
+			t.Errorf("Step did not return false at end of episode")
+		}
+	}
+	// no action: step is sent with action 0, so stays at start
+	ev.Step()
+	ev.Action("Action", nil) // ignored
+	ev.Step()
+	if ev.State("Pos").FloatVal1D(0) != 1 {
+		t.Errorf("default action wrong: Pos: %v", ev.State("Pos"))
+	}
+	if err := ev.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRemoteEnvPipe(t *testing.T) {
+	cl, sv := net.Pipe()
+	stub := &gymStub{Size: 3}
+	go ServeGym(sv, stub)
+	ev := &RemoteEnv{Nm: "Pipe", Seed: 10}
+	if err := ev.ConfigConn(cl); err != nil {
+		t.Fatal(err)
+	}
+	testRemoteEnv(t, ev)
+	if stub.Seed != 11 {
+		t.Errorf("seed = %d, expected Seed + run = 11", stub.Seed)
+	}
+}
+
+func TestRemoteEnvSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "gym.sock")
+	ln, err := ListenGym(sock, func() GymServer { return &gymStub{Size: 3} })
+	if err != nil {
+		t.Skip("unix sockets not available:", err)
+	}
+	defer ln.Close()
+	testRemoteEnv(t, &RemoteEnv{Nm: "Socket", Socket: sock})
+}
+
+func TestRemoteEnvCommand(t *testing.T) {
+	t.Setenv(gymStubEnvVar, "1")
+	testRemoteEnv(t, &RemoteEnv{Nm: "Command", Command: []string{os.Args[0]}})
+
+	// command that exits without serving is an error, and is cleaned up
+	tr, err := exec.LookPath("true")
+	if err != nil {
+		return
+	}
+	ev := &RemoteEnv{Nm: "True", Command: []string{tr}}
+	if err := ev.Connect(); err == nil || ev.cmd != nil || ev.conn != nil {
+		t.Errorf("expected error and cleanup for command not serving: %v", err)
+	}
+}
+
+func TestRemoteEnvError(t *testing.T) {
+	cl, sv := net.Pipe()
+	go ServeGym(sv, &gymStub{Size: 3})
+	ev := &RemoteEnv{Nm: "Err"}
+	if err := ev.ConfigConn(cl); err != nil {
+		t.Fatal(err)
+	}
+	ev.ActSpace = &GymSpace{Type: "Box", Shape: []int{2}} // stub rejects list actions
+	ev.Init(0)
+	ev.Step()
+	if ev.Step() || ev.Err == nil {
+		t.Errorf("expected error from invalid action")
+	}
+	ev.Close()
+}
+
+// gymStub is a minimal GymServer for testing: a corridor of Size
+// positions, where the agent starts at 0 and moves left (action 0)
+// or right (action 1), and reaching the last position terminates with
+// a reward of 1.  The observation is a Dict with Pos (Discrete)
+// and Dist (Box [2]: distance to the start and to the end).
+type gymStub struct {
+	Size int   `desc:"number of positions"`
+	Pos  int   `desc:"current position"`
+	Seed int64 `desc:"last seed received in Reset"`
+}
+
+func (gs *gymStub) Spaces() (obs, act *GymSpace) {
+	obs = &GymSpace{Type: "Dict", Spaces: map[string]*GymSpace{
+		"Pos":  {Type: "Discrete", N: gs.Size},
+		"Dist": {Type: "Box", Shape: []int{2}},
+	}}
+	act = &GymSpace{Type: "Discrete", N: 2}
+	return
+}
+
+func (gs *gymStub) obs() interface{} {
+	return map[string]interface{}{
+		"Pos":  gs.Pos,
+		"Dist": []float64{float64(gs.Pos), float64(gs.Size - 1 - gs.Pos)},
+	}
+}
+
+func (gs *gymStub) Reset(seed *int64) (interface{}, error) {
+	if seed != nil {
+		gs.Seed = *seed
+	}
+	gs.Pos = 0
+	return gs.obs(), nil
+}
+
+func (gs *gymStub) Step(action interface{}) (interface{}, float64, bool, bool, error) {
+	act, ok := action.(float64)
+	if !ok {
+		return nil, 0, false, false, fmt.Errorf("invalid action: %v", action)
+	}
+	switch {
+	case act == 0 && gs.Pos > 0:
+		gs.Pos--
+	case act == 1:
+		gs.Pos++
+	}
+	if gs.Pos >= gs.Size-1 {
+		gs.Pos = gs.Size - 1
+		return gs.obs(), 1, true, false, nil
+	}
+	return gs.obs(), 0, false, false, nil
+}
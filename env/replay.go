@@ -0,0 +1,292 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/emer/etable/etensor"
+)
+
+// ReplayEnv is an Env that replays a trajectory recorded by RecordEnv:
+// Init(run) goes to the start of the recorded run (or the first one if
+// not recorded), and each Step returns the recorded result, counters and
+// States, returning false with Done at the end of the run.
+// Action compares the input with the next recorded Action for the current
+// trial, counting differences in ActDiffs, so a model can be checked
+// for reproducing the same actions, and then State returns the States
+// recorded after that Action.
+type ReplayEnv struct {
+	Nm       string   `desc:"name of this environment -- defaults to the recorded name"`
+	Dsc      string   `desc:"description of this environment -- defaults to the recorded description"`
+	Filename string   `desc:"file to replay -- opened in Validate or the first Init if not already opened"`
+	Tol      float64  `def:"1e-6" desc:"tolerance for differences between Action inputs and recorded actions"`
+	Run      int      `inactive:"+" desc:"run being replayed"`
+	Pos      int      `inactive:"+" desc:"index of the current step within the run"`
+	ActPos   int      `inactive:"+" desc:"number of Actions received on the current step"`
+	Done     bool     `inactive:"+" desc:"true if the end of the recorded run has been reached"`
+	ActDiffs int      `inactive:"+" desc:"number of Action inputs that differed from the recorded actions, or were not recorded"`
+	LastDiff string   `inactive:"+" desc:"description of the last Action difference"`
+	Scales   []string `inactive:"+" desc:"names of the recorded counter time scales"`
+
+	states  Elements
+	actions Elements
+	runs    []replayRun
+	cur     *replayRun
+}
+
+// replayRun is the recorded steps of one Init run
+type replayRun struct {
+	run   int
+	steps []replayStep
+}
+
+// replayStep is a recorded step
+type replayStep struct {
+	ok     bool
+	ctrs   map[TimeScales][3]int
+	states map[string]etensor.Tensor
+	acts   []replayAct
+}
+
+// replayAct is a recorded action
+type replayAct struct {
+	element string
+	input   etensor.Tensor
+	after   map[string]etensor.Tensor // states after the action
+}
+
+func (rp *ReplayEnv) Name() string { return rp.Nm }
+func (rp *ReplayEnv) Desc() string { return rp.Dsc }
+
+// Validate opens the Filename if not already opened
+func (rp *ReplayEnv) Validate() error {
+	if rp.runs != nil {
+		return nil
+	}
+	if rp.Filename == "" {
+		return fmt.Errorf("env.ReplayEnv: %v has no Filename", rp.Nm)
+	}
+	return rp.Open(rp.Filename)
+}
+
+// Open reads the recorded trajectory from given file
+func (rp *ReplayEnv) Open(filename string) error {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if err := rp.Read(fp); err != nil {
+		return fmt.Errorf("env.ReplayEnv: %s: %w", filename, err)
+	}
+	return nil
+}
+
+// Read reads a recorded trajectory from given reader
+func (rp *ReplayEnv) Read(r io.Reader) error {
+	rp.runs = []replayRun{}
+	rp.cur = nil
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), math.MaxInt32)
+	ln := 0
+	for sc.Scan() {
+		ln++
+		tl := &trajLine{}
+		if err := json.Unmarshal(sc.Bytes(), tl); err != nil {
+			return fmt.Errorf("line %d: %w", ln, err)
+		}
+		switch tl.Type {
+		case "header":
+			if rp.Nm == "" {
+				rp.Nm = tl.Name
+			}
+			if rp.Dsc == "" {
+				rp.Dsc = tl.Desc
+			}
+			rp.Scales = tl.Counters
+			rp.states = tl.States
+			rp.actions = tl.Actions
+		case "init":
+			rp.runs = append(rp.runs, replayRun{run: tl.Run})
+		case "step":
+			if len(rp.runs) == 0 {
+				return fmt.Errorf("line %d: step before init", ln)
+			}
+			st := replayStep{ok: tl.Ok, ctrs: make(map[TimeScales][3]int), states: make(map[string]etensor.Tensor)}
+			for nm, ct := range tl.Ctrs {
+				ts, err := StringToTimeScales(nm)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", ln, err)
+				}
+				st.ctrs[ts] = ct
+			}
+			for nm, tt := range tl.Tensors {
+				st.states[nm] = tt.Tensor()
+			}
+			rr := &rp.runs[len(rp.runs)-1]
+			rr.steps = append(rr.steps, st)
+		case "action":
+			if len(rp.runs) == 0 || len(rp.runs[len(rp.runs)-1].steps) == 0 {
+				return fmt.Errorf("line %d: action before step", ln)
+			}
+			rr := &rp.runs[len(rp.runs)-1]
+			st := &rr.steps[len(rr.steps)-1]
+			ra := replayAct{element: tl.Element, after: make(map[string]etensor.Tensor)}
+			if tt, ok := tl.Tensors[tl.Element]; ok {
+				ra.input = tt.Tensor()
+			}
+			for nm, tt := range tl.After {
+				ra.after[nm] = tt.Tensor()
+			}
+			st.acts = append(st.acts, ra)
+		default:
+			return fmt.Errorf("line %d: unknown record type: %q", ln, tl.Type)
+		}
+	}
+	return sc.Err()
+}
+
+// Init goes to the start of the recorded run
+func (rp *ReplayEnv) Init(run int) {
+	if rp.Tol == 0 {
+		rp.Tol = 1e-6
+	}
+	if err := rp.Validate(); err != nil {
+		log.Println(err)
+	}
+	rp.Run = run
+	rp.Pos = -1
+	rp.ActPos = 0
+	rp.Done = false
+	rp.ActDiffs = 0
+	rp.LastDiff = ""
+	rp.cur = nil
+	for i := range rp.runs {
+		if rp.runs[i].run == run {
+			rp.cur = &rp.runs[i]
+			return
+		}
+	}
+	if len(rp.runs) > 0 {
+		log.Printf("env.ReplayEnv: %v: run %d not recorded, using run %d\n", rp.Nm, run, rp.runs[0].run)
+		rp.cur = &rp.runs[0]
+	}
+}
+
+// curStep returns the current recorded step, nil if none
+func (rp *ReplayEnv) curStep() *replayStep {
+	if rp.cur == nil || rp.Pos < 0 || rp.Pos >= len(rp.cur.steps) {
+		return nil
+	}
+	return &rp.cur.steps[rp.Pos]
+}
+
+// Step goes to the next recorded step, returning its recorded result,
+// or false with Done at the end of the run
+func (rp *ReplayEnv) Step() bool {
+	if rp.cur == nil || rp.Pos+1 >= len(rp.cur.steps) {
+		rp.Done = true
+		return false
+	}
+	rp.Pos++
+	rp.ActPos = 0
+	return rp.cur.steps[rp.Pos].ok
+}
+
+func (rp *ReplayEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	st := rp.curStep()
+	if st == nil {
+		return -1, -1, false
+	}
+	ct, ok := st.ctrs[scale]
+	if !ok {
+		return -1, -1, false
+	}
+	return ct[0], ct[1], ct[2] == 1
+}
+
+// State returns the recorded State, after the last Action received
+// on this step if any
+func (rp *ReplayEnv) State(element string) etensor.Tensor {
+	st := rp.curStep()
+	if st == nil {
+		return nil
+	}
+	if rp.ActPos > 0 && rp.ActPos <= len(st.acts) {
+		if as, ok := st.acts[rp.ActPos-1].after[element]; ok {
+			return as
+		}
+	}
+	return st.states[element]
+}
+
+// Action compares the input with the next recorded action for the
+// current step, incrementing ActDiffs if different
+func (rp *ReplayEnv) Action(element string, input etensor.Tensor) {
+	st := rp.curStep()
+	if st == nil || input == nil {
+		return
+	}
+	if rp.ActPos >= len(st.acts) {
+		rp.LastDiff = fmt.Sprintf("step %d: action on %s not recorded", rp.Pos, element)
+		rp.ActDiffs++
+		return
+	}
+	ra := &st.acts[rp.ActPos]
+	rp.ActPos++
+	rec := ra.input
+	switch {
+	case ra.element != element || rec == nil:
+		rp.LastDiff = fmt.Sprintf("step %d: action on %s, recorded on %s", rp.Pos, element, ra.element)
+	case rec.Len() != input.Len():
+		rp.LastDiff = fmt.Sprintf("step %d: action on %s has %d values, recorded %d", rp.Pos, element, input.Len(), rec.Len())
+	default:
+		for i := 0; i < rec.Len(); i++ {
+			if rec.DataType() == etensor.STRING {
+				if rec.StringVal1D(i) == input.StringVal1D(i) {
+					continue
+				}
+			} else if math.Abs(rec.FloatVal1D(i)-input.FloatVal1D(i)) <= rp.Tol {
+				continue
+			}
+			rp.LastDiff = fmt.Sprintf("step %d: action on %s differs at %d: %s, recorded %s", rp.Pos, element, i, input.StringVal1D(i), rec.StringVal1D(i))
+			rp.ActDiffs++
+			return
+		}
+		return
+	}
+	rp.ActDiffs++
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*ReplayEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (rp *ReplayEnv) Counters() []TimeScales {
+	var scs []TimeScales
+	for _, nm := range rp.Scales {
+		if ts, err := StringToTimeScales(nm); err == nil {
+			scs = append(scs, ts)
+		}
+	}
+	return scs
+}
+
+func (rp *ReplayEnv) States() Elements {
+	return rp.states
+}
+
+func (rp *ReplayEnv) Actions() Elements {
+	return rp.actions
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/etable/etensor"
+)
+
+// ReverseEnv is an Env that wraps another Env and presents its trials in
+// reverse order within each unit of the given Scale (e.g., Epoch, or
+// Sequence to reverse each sequence).  It steps through each unit of the
+// wrapped Env in advance (until the Counter at Scale changes, or Step
+// returns false), recording the Elements States, and then presents them
+// in reverse.  Counters are those of the wrapped Env in forward order, so
+// e.g., Trial and Tick still count up over the unit, while the States are
+// reversed.  Actions are not supported, as the wrapped Env has already
+// been stepped ahead.
+type ReverseEnv struct {
+	Nm       string     `desc:"name of this environment -- defaults to the name of the wrapped Env"`
+	Dsc      string     `desc:"description of this environment"`
+	Env      Env        `desc:"the wrapped environment"`
+	Scale    TimeScales `desc:"time scale of the units within which trials are reversed -- e.g., Epoch or Sequence -- defaults to Epoch if not set"`
+	Elements []string   `desc:"names of the State elements to record -- defaults to the States of the wrapped Env if it implements EnvDesc"`
+	MaxUnit  int        `def:"10000" desc:"maximum number of trials in a unit, in case the Counter at Scale never changes"`
+	Pos      int        `inactive:"+" desc:"position of the current trial within the unit, in forward order"`
+
+	unit  []revTrial // recorded trials of the current unit
+	carry *revTrial  // first trial of the next unit
+}
+
+// revTrial is a recorded trial of the wrapped Env
+type revTrial struct {
+	ctrs   map[TimeScales][3]int // cur, prv, chg (0 / 1) for each counter
+	states map[string]etensor.Tensor
+}
+
+func (re *ReverseEnv) Name() string {
+	if re.Nm == "" && re.Env != nil {
+		return re.Env.Name()
+	}
+	return re.Nm
+}
+
+func (re *ReverseEnv) Desc() string { return re.Dsc }
+
+func (re *ReverseEnv) Validate() error {
+	if re.Env == nil {
+		return fmt.Errorf("env.ReverseEnv: %v has no Env", re.Nm)
+	}
+	if len(re.Elements) == 0 && len(envStates(re.Env)) == 0 {
+		return fmt.Errorf("env.ReverseEnv: %v has no Elements, and Env does not describe its States", re.Nm)
+	}
+	return re.Env.Validate()
+}
+
+// Init initializes the ReverseEnv and the wrapped Env with given run
+func (re *ReverseEnv) Init(run int) {
+	if re.Scale == 0 {
+		re.Scale = Epoch
+	}
+	if re.MaxUnit <= 0 {
+		re.MaxUnit = 10000
+	}
+	if len(re.Elements) == 0 {
+		for _, el := range envStates(re.Env) {
+			re.Elements = append(re.Elements, el.Name)
+		}
+	}
+	re.Env.Init(run)
+	re.unit = nil
+	re.carry = nil
+	re.Pos = -1
+}
+
+// counters returns the counter time scales of the wrapped Env
+func (re *ReverseEnv) counters() []TimeScales {
+	if ed, ok := re.Env.(EnvDesc); ok {
+		return ed.Counters()
+	}
+	return []TimeScales{Run, Epoch, Trial}
+}
+
+// record records the current trial of the wrapped Env
+func (re *ReverseEnv) record() revTrial {
+	rt := revTrial{ctrs: make(map[TimeScales][3]int), states: make(map[string]etensor.Tensor)}
+	for _, sc := range re.counters() {
+		cur, prv, chg := re.Env.Counter(sc)
+		ch := 0
+		if chg {
+			ch = 1
+		}
+		rt.ctrs[sc] = [3]int{cur, prv, ch}
+	}
+	for _, el := range re.Elements {
+		if st := re.Env.State(el); st != nil {
+			rt.states[el] = st.Clone()
+		}
+	}
+	return rt
+}
+
+// fillUnit steps the wrapped Env through the next unit, recording it
+func (re *ReverseEnv) fillUnit() {
+	re.unit = re.unit[:0]
+	if re.carry != nil {
+		re.unit = append(re.unit, *re.carry)
+		re.carry = nil
+	}
+	for len(re.unit) < re.MaxUnit {
+		if !re.Env.Step() {
+			if len(re.unit) > 0 {
+				break
+			}
+			if !re.Env.Step() { // e.g., the first Step of a new episode
+				break
+			}
+		}
+		rt := re.record()
+		if _, _, chg := re.Env.Counter(re.Scale); chg && len(re.unit) > 0 {
+			re.carry = &rt
+			break
+		}
+		re.unit = append(re.unit, rt)
+	}
+}
+
+// Step presents the next trial of the current unit in reverse order,
+// recording the next unit when done.  Returns false if the wrapped Env
+// has no trials.
+func (re *ReverseEnv) Step() bool {
+	re.Pos++
+	if re.Pos >= len(re.unit) {
+		re.fillUnit()
+		re.Pos = 0
+	}
+	return len(re.unit) > 0
+}
+
+// Counter returns the counter of the wrapped Env at given scale for the
+// current trial, in forward order
+func (re *ReverseEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	if re.Pos < 0 || re.Pos >= len(re.unit) {
+		return re.Env.Counter(scale)
+	}
+	ct, ok := re.unit[re.Pos].ctrs[scale]
+	if !ok {
+		return -1, -1, false
+	}
+	return ct[0], ct[1], ct[2] == 1
+}
+
+// State returns the recorded State for the current trial, in reverse order
+func (re *ReverseEnv) State(element string) etensor.Tensor {
+	if re.Pos < 0 || re.Pos >= len(re.unit) {
+		return nil
+	}
+	return re.unit[len(re.unit)-1-re.Pos].states[element]
+}
+
+// Action is not supported, as the wrapped Env has already been stepped ahead
+func (re *ReverseEnv) Action(element string, input etensor.Tensor) {
+	// nop
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*ReverseEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (re *ReverseEnv) Counters() []TimeScales {
+	return re.counters()
+}
+
+func (re *ReverseEnv) States() Elements {
+	return envStates(re.Env)
+}
+
+func (re *ReverseEnv) Actions() Elements {
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etensor"
+)
+
+// RLTask is a closed-loop reinforcement learning task run by an RLEnv,
+// e.g., GridWorld or Bandit.  The task maintains its own state, and
+// the RLEnv manages the counters, reward and episode termination.
+type RLTask interface {
+	// Validate checks that the task is configured so it can be run,
+	// returning an error if not
+	Validate() error
+
+	// NActions returns the number of discrete actions
+	NActions() int
+
+	// ObsShape returns the shape and dimension names of the observation
+	ObsShape() (shape []int, dimNames []string)
+
+	// Reset starts a new episode, using given random number source
+	Reset(rnd erand.Rand)
+
+	// Act performs given action (0..NActions-1), returning the reward,
+	// and whether the episode has reached a terminal state
+	Act(action int, rnd erand.Rand) (reward float32, term bool)
+
+	// Observe sets the observation for the current state, into given
+	// tensor, which has the shape returned by ObsShape
+	Observe(obs *etensor.Float32)
+}
+
+// RLEnv is a closed-loop reinforcement learning Env, running an RLTask
+// organized into episodes of trials.  On each trial, the model reads the
+// Obs State, and then sends its choice using Action on the Action element,
+// which produces the Reward State.  Step returns false when the episode
+// has ended (the task reached a terminal state, or MaxSteps trials), and
+// the following Step starts a new episode, incrementing the Episode counter.
+type RLEnv struct {
+	Nm       string          `desc:"name of this environment"`
+	Dsc      string          `desc:"description of this environment"`
+	Task     RLTask          `desc:"the task -- e.g., GridWorld or Bandit"`
+	MaxSteps int             `desc:"maximum number of trials per episode -- episode ends after this many trials if the task has not reached a terminal state (0 = no limit)"`
+	RndSeed  int64           `desc:"random seed: the random number source is seeded with RndSeed + run in Init, so each run is reproducible"`
+	Rand     erand.SysRand   `view:"-" desc:"random number source"`
+	Run      Ctr             `view:"inline" desc:"current run of model as provided during Init"`
+	Episode  Ctr             `view:"inline" desc:"number of episodes"`
+	Trial    Ctr             `view:"inline" desc:"trial within the episode"`
+	Obs      etensor.Float32 `desc:"current observation"`
+	Reward   etensor.Float32 `desc:"reward from the last action, [1] -- 0 before any action is taken on a trial"`
+	Act      etensor.Float32 `desc:"last action as a one-hot pattern over NActions"`
+	LastAct  int             `inactive:"+" desc:"index of last action taken, -1 if none on this trial"`
+	EpReward float32         `inactive:"+" desc:"cumulative reward over the current episode"`
+	Term     bool            `inactive:"+" desc:"true if the last action led to a terminal state"`
+	Done     bool            `inactive:"+" desc:"true if the current episode is over -- next Step starts a new episode"`
+}
+
+func (ev *RLEnv) Name() string { return ev.Nm }
+func (ev *RLEnv) Desc() string { return ev.Dsc }
+
+func (ev *RLEnv) Validate() error {
+	if ev.Task == nil {
+		return fmt.Errorf("env.RLEnv: %v has no Task set", ev.Nm)
+	}
+	if ev.Task.NActions() < 1 {
+		return fmt.Errorf("env.RLEnv: %v Task has no actions", ev.Nm)
+	}
+	if err := ev.Task.Validate(); err != nil {
+		return fmt.Errorf("env.RLEnv: %v Task: %w", ev.Nm, err)
+	}
+	return nil
+}
+
+func (ev *RLEnv) Init(run int) {
+	ev.Rand.NewRand(ev.RndSeed + int64(run))
+	ev.Run.Scale = Run
+	ev.Episode.Scale = Episode
+	ev.Trial.Scale = Trial
+	ev.Run.Init()
+	ev.Episode.Init()
+	ev.Trial.Init()
+	ev.Run.Cur = run
+	ev.Episode.Cur = -1 // first Step starts episode 0
+	ev.Trial.Cur = -1
+	shp, nms := ev.Task.ObsShape()
+	ev.Obs.SetShape(shp, nil, nms)
+	ev.Reward.SetShape([]int{1}, nil, nil)
+	ev.Act.SetShape([]int{ev.Task.NActions()}, nil, nil)
+	ev.Done = true
+	ev.Term = false
+}
+
+// NewEpisode starts a new episode
+func (ev *RLEnv) NewEpisode() {
+	ev.Episode.Incr()
+	ev.Trial.Init()
+	ev.Trial.Chg = true
+	ev.EpReward = 0
+	ev.Done = false
+	ev.Term = false
+	ev.Task.Reset(&ev.Rand)
+	ev.newTrial()
+}
+
+// newTrial clears the action and reward and updates the observation
+func (ev *RLEnv) newTrial() {
+	ev.LastAct = -1
+	ev.Act.SetZeros()
+	ev.Reward.SetZeros()
+	ev.Task.Observe(&ev.Obs)
+}
+
+// Step advances to the next trial, returning false if the episode has
+// ended, either from a terminal state or reaching MaxSteps.
+// After that, the next call starts a new episode.
+func (ev *RLEnv) Step() bool {
+	ev.Episode.Same()
+	ev.Trial.Same()
+	if ev.Done {
+		ev.NewEpisode()
+		return true
+	}
+	if ev.Term || (ev.MaxSteps > 0 && ev.Trial.Cur+1 >= ev.MaxSteps) {
+		ev.Done = true
+		return false
+	}
+	ev.Trial.Incr()
+	ev.newTrial()
+	return true
+}
+
+func (ev *RLEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return ev.Run.Query()
+	case Episode:
+		return ev.Episode.Query()
+	case Trial:
+		return ev.Trial.Query()
+	}
+	return -1, -1, false
+}
+
+func (ev *RLEnv) State(element string) etensor.Tensor {
+	switch element {
+	case "Obs":
+		return &ev.Obs
+	case "Reward":
+		return &ev.Reward
+	case "Action":
+		return &ev.Act
+	}
+	return nil
+}
+
+// Action performs the action given on the Action element, which is
+// the index of the maximum value in the input (or the value itself for
+// a single-valued input), setting the Reward.  Only the first action
+// on each trial has an effect.
+func (ev *RLEnv) Action(element string, input etensor.Tensor) {
+	if element != "Action" || input == nil || input.Len() == 0 {
+		return
+	}
+	act := 0
+	if input.Len() == 1 {
+		act = int(input.FloatVal1D(0))
+	} else {
+		for i := 1; i < input.Len(); i++ {
+			if input.FloatVal1D(i) > input.FloatVal1D(act) {
+				act = i
+			}
+		}
+	}
+	ev.DoAction(act)
+}
+
+// DoAction performs given action index, if the episode is not done
+// and no action has been taken on this trial
+func (ev *RLEnv) DoAction(act int) {
+	if ev.Done || ev.Term || ev.LastAct >= 0 || act < 0 || act >= ev.Task.NActions() {
+		return
+	}
+	ev.LastAct = act
+	ev.Act.Values[act] = 1
+	rew, term := ev.Task.Act(act, &ev.Rand)
+	ev.Reward.Values[0] = rew
+	ev.EpReward += rew
+	ev.Term = term
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*RLEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (ev *RLEnv) Counters() []TimeScales {
+	return []TimeScales{Run, Episode, Trial}
+}
+
+func (ev *RLEnv) States() Elements {
+	shp, nms := ev.Task.ObsShape()
+	return Elements{
+		{Name: "Obs", Shape: shp, DimNames: nms},
+		{Name: "Reward", Shape: []int{1}},
+	}
+}
+
+func (ev *RLEnv) Actions() Elements {
+	return Elements{{Name: "Action", Shape: []int{ev.Task.NActions()}}}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"testing"
+
+	"github.com/emer/emergent/evec"
+	"github.com/emer/etable/etensor"
+)
+
+func TestGridWorld(t *testing.T) {
+	gw := &GridWorld{}
+	gw.Config(evec.Vec2i{X: 3, Y: 1}, evec.Vec2i{X: 0, Y: 0}, evec.Vec2i{X: 2, Y: 0})
+	gw.StepReward = -0.1
+	ev := &RLEnv{Nm: "Grid", Task: gw, MaxSteps: 10}
+	if err := ev.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ev.Init(0)
+	right := etensor.NewFloat32([]int{4}, nil, nil)
+	right.Values[GridRight] = 1
+	for ep := 0; ep < 2; ep++ {
+		for trl := 0; trl < 2; trl++ {
+			if !ev.Step() {
+				t.Fatalf("episode %d ended early at trial %d", ep, trl)
+			}
+			if cur, _, _ := ev.Counter(Episode); cur != ep {
+				t.Errorf("Episode = %d, expected %d", cur, ep)
+			}
+			if cur, _, _ := ev.Counter(Trial); cur != trl {
+				t.Errorf("Trial = %d, expected %d", cur, trl)
+			}
+			if ev.State("Obs").FloatVal1D(trl) != 1 {
+				t.Errorf("Obs wrong at trial %d: %v", trl, ev.State("Obs"))
+			}
+			ev.Action("Action", right)
+			ev.Action("Action", right) // second action on same trial is ignored
+		}
+		if rew := ev.State("Reward").FloatVal1D(0); rew != 1 {
+			t.Errorf("goal reward = %g", rew)
+		}
+		if ev.EpReward != 0.9 {
+			t.Errorf("EpReward = %g, expected 0.9", ev.EpReward)
+		}
+		if ev.Step() {
+			t.Errorf("Step did not return false at goal")
+		}
+	}
+	// bumping into the edge leaves the agent in place
+	ev.Step()
+	ev.DoAction(int(GridLeft))
+	if gw.Pos.X != 0 {
+		t.Errorf("moved through the edge: %v", gw.Pos)
+	}
+
+	// no free cell to start in
+	gw.RndStart = true
+	gw.Walls = []evec.Vec2i{{X: 0, Y: 0}, {X: 1, Y: 0}}
+	if err := ev.Validate(); err == nil {
+		t.Errorf("expected error for grid without free cells")
+	}
+	gw.Size.Y = 0
+	if err := ev.Validate(); err == nil {
+		t.Errorf("expected error for empty grid")
+	}
+}
+
+func TestBandit(t *testing.T) {
+	bd := &Bandit{}
+	probs := []float32{0, 1}
+	bd.Config(probs...)
+	probs[1] = 0 // Config copies the probs
+	bd.Reversal = 2
+	ev := &RLEnv{Nm: "Bandit", Task: bd, MaxSteps: 4}
+	ev.Init(0)
+	var rews []float32
+	for ev.Step() {
+		ev.DoAction(1)
+		rews = append(rews, ev.Reward.Values[0])
+	}
+	exp := []float32{1, 1, 0, 0}
+	if len(rews) != len(exp) {
+		t.Fatalf("episode had %d trials, expected %d", len(rews), len(exp))
+	}
+	for i := range exp {
+		if rews[i] != exp[i] {
+			t.Errorf("trial %d reward = %g, expected %g", i, rews[i], exp[i])
+		}
+	}
+	ev.Step()
+	if bd.Probs[1] != 1 || ev.Obs.Values[1] != 0 {
+		t.Errorf("new episode did not reset: Probs: %v  Obs: %v", bd.Probs, ev.Obs.Values)
+	}
+}
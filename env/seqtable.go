@@ -0,0 +1,372 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// SequenceTable is an Env that presents sequences of patterns from an
+// etable.Table, for sequence learning models (e.g., SRN or deep predictive
+// learning).  Rows with the same value in the sequence-id column (SeqCol)
+// form a sequence, in the order of the IdxView, and each row is one Tick
+// of the sequence.  Sequences are presented in either sequential or
+// permuted random order, with Sequence and Tick counters in addition to
+// the std Run / Epoch counters, and Trial counting ticks over the epoch.
+// Sequences can optionally be padded with blank ticks to MaxTicks, and
+// Markers adds Reset and Pad states marking the start of each sequence
+// and padded ticks.
+// It uses an IdxView indexed view of the Table, so a single shared table
+// can be used across different environments, with each having its own unique view.
+type SequenceTable struct {
+	Nm         string           `desc:"name of this environment"`
+	Dsc        string           `desc:"description of this environment"`
+	Table      *etable.IdxView  `desc:"this is an indexed view of the table with the set of patterns to output -- rows with the same SeqCol value form a sequence, in the order of this view"`
+	Sequential bool             `desc:"present sequences in the order of their first appearance in the Table?  otherwise permuted random order.  Ticks within a sequence are always in order"`
+	MaxTicks   int              `desc:"if > 0, every sequence has this many ticks: shorter ones are padded with blank ticks (all zero states), and longer ones are truncated"`
+	Markers    bool             `desc:"include Reset and Pad states: Reset is 1 on the first tick of each sequence, and Pad is 1 on padded ticks, 0 otherwise"`
+	Seqs       [][]int          `view:"-" desc:"rows in the Table for each sequence, set in Init"`
+	Order      []int            `desc:"permuted order of sequences to present if not sequential -- updated every time through the list"`
+	OwnRand    bool             `desc:"use a separate random number source for the Order, seeded with RndSeed + run in Init, so its position can be saved by SaveState to resume a run exactly -- otherwise uses the global random source"`
+	RndSeed    int64            `desc:"random seed for OwnRand: the source is seeded with RndSeed + run in Init"`
+	Rand       erand.SysRand    `view:"-" desc:"random number source -- the global source unless OwnRand"`
+	RandSrc    *erand.PosSource `view:"-" desc:"random number source for OwnRand, which records its position"`
+	Run        Ctr              `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch      Ctr              `view:"inline" desc:"number of times through entire set of sequences"`
+	Sequence   Ctr              `view:"inline" desc:"current ordinal sequence -- if Sequential then = sequence index, otherwise is index in Order list that then gives sequence index"`
+	Tick       Ctr              `view:"inline" desc:"current tick within the sequence"`
+	Trial      Ctr              `view:"inline" desc:"current tick within the epoch, counting across sequences"`
+	SeqName    CurPrvString     `desc:"contents of the SeqCol for the current sequence"`
+	TrialName  CurPrvString     `desc:"if Table has a Name column, this is the contents of that -- empty for padded ticks"`
+	GroupName  CurPrvString     `desc:"if Table has a Group column, this is contents of that -- empty for padded ticks"`
+	SeqCol     string           `desc:"name of the sequence-id column -- defaults to 'Sequence'"`
+	NameCol    string           `desc:"name of the Name column -- defaults to 'Name'"`
+	GroupCol   string           `desc:"name of the Group column -- defaults to 'Group'"`
+
+	reset etensor.Float32           // Reset marker state
+	pad   etensor.Float32           // Pad marker state
+	zeros map[string]etensor.Tensor // blank states for padded ticks
+}
+
+func (st *SequenceTable) Name() string { return st.Nm }
+func (st *SequenceTable) Desc() string { return st.Dsc }
+
+func (st *SequenceTable) Validate() error {
+	if st.Table == nil || st.Table.Table == nil {
+		return fmt.Errorf("env.SequenceTable: %v has no Table set", st.Nm)
+	}
+	if st.Table.Table.NumCols() == 0 {
+		return fmt.Errorf("env.SequenceTable: %v Table has no columns -- Outputs will be invalid", st.Nm)
+	}
+	if st.SeqCol == "" {
+		st.SeqCol = "Sequence"
+	}
+	_, err := st.Table.Table.ColByNameTry(st.SeqCol)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (st *SequenceTable) Init(run int) {
+	if st.SeqCol == "" {
+		st.SeqCol = "Sequence"
+	}
+	if st.NameCol == "" {
+		st.NameCol = "Name"
+	}
+	if st.GroupCol == "" {
+		st.GroupCol = "Group"
+	}
+	st.Run.Scale = Run
+	st.Epoch.Scale = Epoch
+	st.Sequence.Scale = Sequence
+	st.Tick.Scale = Tick
+	st.Trial.Scale = Trial
+	st.Run.Init()
+	st.Epoch.Init()
+	st.Sequence.Init()
+	st.Tick.Init()
+	st.Trial.Init()
+	st.Run.Cur = run
+	if st.OwnRand {
+		st.RandSrc = erand.NewPosRand(&st.Rand, st.RndSeed+int64(run))
+	} else {
+		st.Rand.Rand = nil
+		st.RandSrc = nil
+	}
+	st.reset.SetShape([]int{1}, nil, nil)
+	st.pad.SetShape([]int{1}, nil, nil)
+	st.zeros = nil
+	seqs, err := Strata(st.Table, st.SeqCol)
+	if err != nil {
+		log.Println(err)
+		seqs = nil
+	}
+	st.Seqs = seqs
+	st.NewOrder()
+	st.Sequence.Cur = -1 // init state -- key so that first Step() = 0
+	st.Tick.Cur = -1
+	st.Trial.Cur = -1
+}
+
+// Config configures the environment to use given table IndexView,
+// and initializes it.
+func (st *SequenceTable) Config(tbl *etable.IdxView) {
+	st.Table = tbl
+	st.Init(0)
+}
+
+// NewOrder sets a new random Order based on number of sequences.
+func (st *SequenceTable) NewOrder() {
+	ns := len(st.Seqs)
+	st.Order = st.Rand.Perm(ns, -1) // always start with new one so random order is identical
+	st.Sequence.Max = ns
+}
+
+// PermuteOrder permutes the existing order table to get a new random sequence of inputs
+// just calls: erand.PermuteInts(st.Order, &st.Rand)
+func (st *SequenceTable) PermuteOrder() {
+	erand.PermuteInts(st.Order, &st.Rand)
+}
+
+// SeqIdx returns the index of the current sequence in Seqs, based on
+// Sequential / permuted Order
+func (st *SequenceTable) SeqIdx() int {
+	if st.Sequential {
+		return st.Sequence.Cur
+	}
+	return st.Order[st.Sequence.Cur]
+}
+
+// SeqLen returns the number of ticks in the current sequence,
+// which is MaxTicks if > 0
+func (st *SequenceTable) SeqLen() int {
+	if st.MaxTicks > 0 {
+		return st.MaxTicks
+	}
+	return len(st.Seqs[st.SeqIdx()])
+}
+
+// Row returns the current row number in table, already de-referenced
+// through the IdxView's indexes, or -1 if the current tick is padding.
+func (st *SequenceTable) Row() int {
+	if st.Sequence.Cur < 0 || st.Tick.Cur < 0 {
+		return -1
+	}
+	rows := st.Seqs[st.SeqIdx()]
+	if st.Tick.Cur >= len(rows) {
+		return -1
+	}
+	return rows[st.Tick.Cur]
+}
+
+// IsPad returns true if the current tick is padding
+func (st *SequenceTable) IsPad() bool {
+	return st.Row() < 0
+}
+
+// setNames sets the SeqName, TrialName and GroupName
+func (st *SequenceTable) setNames() {
+	dt := st.Table.Table
+	if nms := dt.ColByName(st.SeqCol); nms != nil {
+		st.SeqName.Set(nms.StringVal1D(st.Seqs[st.SeqIdx()][0]))
+	}
+	rw := st.Row()
+	if nms := dt.ColByName(st.NameCol); nms != nil {
+		if rw >= 0 {
+			st.TrialName.Set(nms.StringVal1D(rw))
+		} else {
+			st.TrialName.Set("")
+		}
+	}
+	if nms := dt.ColByName(st.GroupCol); nms != nil {
+		if rw >= 0 {
+			st.GroupName.Set(nms.StringVal1D(rw))
+		} else {
+			st.GroupName.Set("")
+		}
+	}
+}
+
+func (st *SequenceTable) Step() bool {
+	st.Epoch.Same() // good idea to just reset all non-inner-most counters at start
+	st.Sequence.Same()
+	if len(st.Seqs) == 0 {
+		return false
+	}
+	if st.Tick.Cur >= 0 && st.Tick.Cur+1 < st.SeqLen() {
+		st.Tick.Incr()
+		st.Trial.Incr()
+	} else {
+		if st.Sequence.Incr() { // if true, hit max, reset to 0
+			st.PermuteOrder()
+			st.Epoch.Incr()
+			st.Trial.Prv = st.Trial.Cur
+			st.Trial.Cur = 0
+			st.Trial.Chg = true
+		} else {
+			st.Trial.Incr()
+		}
+		st.Tick.Prv = st.Tick.Cur
+		st.Tick.Cur = 0
+		st.Tick.Chg = true
+	}
+	st.setMarkers()
+	st.setNames()
+	return true
+}
+
+// setMarkers sets the Reset and Pad marker states for the current tick
+func (st *SequenceTable) setMarkers() {
+	if st.Tick.Cur == 0 {
+		st.reset.Values[0] = 1
+	} else {
+		st.reset.Values[0] = 0
+	}
+	if st.IsPad() {
+		st.pad.Values[0] = 1
+	} else {
+		st.pad.Values[0] = 0
+	}
+}
+
+func (st *SequenceTable) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return st.Run.Query()
+	case Epoch:
+		return st.Epoch.Query()
+	case Sequence:
+		return st.Sequence.Query()
+	case Tick:
+		return st.Tick.Query()
+	case Trial:
+		return st.Trial.Query()
+	}
+	return -1, -1, false
+}
+
+func (st *SequenceTable) State(element string) etensor.Tensor {
+	if st.Markers {
+		switch element {
+		case "Reset":
+			return &st.reset
+		case "Pad":
+			return &st.pad
+		}
+	}
+	rw := st.Row()
+	if rw >= 0 {
+		et, err := st.Table.Table.CellTensorTry(element, rw)
+		if err != nil {
+			log.Println(err)
+		}
+		return et
+	}
+	if zt, ok := st.zeros[element]; ok {
+		return zt
+	}
+	cl, err := st.Table.Table.ColByNameTry(element)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	if st.zeros == nil {
+		st.zeros = make(map[string]etensor.Tensor)
+	}
+	shp := cl.Shapes()
+	var dnms []string
+	if cl.NumDims() > 1 {
+		shp = shp[1:]
+		dnms = cl.DimNames()[1:]
+	} else {
+		shp = []int{1}
+	}
+	zt := etensor.New(cl.DataType(), shp, nil, dnms)
+	st.zeros[element] = zt
+	return zt
+}
+
+func (st *SequenceTable) Action(element string, input etensor.Tensor) {
+	// nop
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*SequenceTable)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (st *SequenceTable) Counters() []TimeScales {
+	return []TimeScales{Run, Epoch, Sequence, Trial, Tick}
+}
+
+func (st *SequenceTable) States() Elements {
+	els := Elements{}
+	els.FromSchema(st.Table.Table.Schema())
+	if st.Markers {
+		els = append(els, Element{Name: "Reset", Shape: []int{1}}, Element{Name: "Pad", Shape: []int{1}})
+	}
+	return els
+}
+
+func (st *SequenceTable) Actions() Elements {
+	return nil
+}
+
+/////////////////////////////////////////////////////
+// StateSaver
+
+// stateVars returns pointers to the state variables, for the StateSaver methods
+func (st *SequenceTable) stateVars() *tableStateVars {
+	return &tableStateVars{typ: "SequenceTable", nm: st.Nm, order: &st.Order, run: &st.Run, epoch: &st.Epoch, trial: &st.Trial, trialName: &st.TrialName, groupName: &st.GroupName, nrows: len(st.Seqs), randSrc: st.RandSrc, random: !st.Sequential}
+}
+
+// SequenceState returns the current state, for SaveState
+func (st *SequenceTable) SequenceState() *SequenceState {
+	return &SequenceState{TableState: *st.stateVars().state(), Sequence: st.Sequence, Tick: st.Tick, SeqName: st.SeqName}
+}
+
+// SaveState saves the counters, Order, names and random number
+// source position (if OwnRand) as JSON.  Returns an error if the env
+// uses random order without OwnRand, as the global random number
+// source cannot be saved, so the resumed run would differ.
+func (st *SequenceTable) SaveState(w io.Writer) error {
+	if err := st.stateVars().check(); err != nil {
+		return err
+	}
+	if err := st.SequenceState().Save(w); err != nil {
+		return fmt.Errorf("env.SequenceTable: %v SaveState: %w", st.Nm, err)
+	}
+	return nil
+}
+
+// LoadState loads the state saved by SaveState -- the env must have the
+// same Table and OwnRand, and have been initialized with Init.
+func (st *SequenceTable) LoadState(r io.Reader) error {
+	tv := st.stateVars()
+	ss := &SequenceState{}
+	if err := ss.Load(r, tv.nrows, tv.randSrc); err != nil {
+		return fmt.Errorf("env.SequenceTable: %v LoadState: %w", st.Nm, err)
+	}
+	tv.set(&ss.TableState)
+	st.Sequence = ss.Sequence
+	st.Tick = ss.Tick
+	st.SeqName = ss.SeqName
+	if st.Sequence.Cur >= 0 && st.Tick.Cur >= 0 {
+		st.setMarkers()
+	}
+	return nil
+}
+
+// Compile-time check that implements StateSaver interface
+var _ StateSaver = (*SequenceTable)(nil)
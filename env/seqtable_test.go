@@ -0,0 +1,59 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSequenceTable(t *testing.T) {
+	// sequences A, B, C of 3, 2 and 1 ticks
+	st := &SequenceTable{Nm: "Seq", Table: testTable("s", 6, "A", "A", "A", "B", "B", "C"), SeqCol: "Group", Sequential: true}
+	if err := st.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	st.Init(0)
+	// each step: SeqName, Tick, Sequence.Chg, Epoch.Cur, Trial.Cur
+	exp := []string{"A 0 true 0 0", "A 1 false 0 1", "A 2 false 0 2", "B 0 true 0 3", "B 1 false 0 4",
+		"C 0 true 0 5", "A 0 true 1 0"}
+	for i, ex := range exp {
+		st.Step()
+		_, _, schg := st.Counter(Sequence)
+		tick, _, _ := st.Counter(Tick)
+		if got := fmt.Sprintf("%s %d %v %d %d", st.SeqName.Cur, tick, schg, st.Epoch.Cur, st.Trial.Cur); got != ex {
+			t.Errorf("step %d: got %q, expected %q", i, got, ex)
+		}
+	}
+
+	st.MaxTicks = 3
+	st.Markers = true
+	st.Init(0)
+	var pads, resets string
+	for i := 0; i < 9; i++ {
+		st.Step()
+		pads += fmt.Sprint(st.State("Pad").FloatVal1D(0))
+		resets += fmt.Sprint(st.State("Reset").FloatVal1D(0))
+		if st.IsPad() && (st.State("Input").FloatVal1D(0) != 0 || st.TrialName.Cur != "") {
+			t.Errorf("step %d: padded tick not blank", i)
+		}
+	}
+	if pads != "000001011" || resets != "100100100" {
+		t.Errorf("markers wrong: Pad: %s  Reset: %s", pads, resets)
+	}
+
+	st.Sequential = false
+	st.MaxTicks = 0
+	st.OwnRand = true
+	st.Init(0)
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		st.Step()
+		seen[st.SeqName.Cur]++
+	}
+	if seen["A"] != 3 || seen["B"] != 2 || seen["C"] != 1 || st.Epoch.Cur != 0 {
+		t.Errorf("permuted epoch did not present each sequence once: %v", seen)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// ShardMagic is the first line of a binary tensor shard file
+const ShardMagic = "ETSHARD1"
+
+// ShardExt is the file extension for binary tensor shard files
+const ShardExt = ".etsh"
+
+// ShardMaxString is the maximum length of a string in a binary tensor
+// shard file -- longer lengths are reported as a corrupt file, instead
+// of allocating memory for them.
+var ShardMaxString = 16 << 20
+
+// shardHeader is the JSON header line of a binary tensor shard file
+type shardHeader struct {
+	Rows int
+	Cols []shardCol
+}
+
+// shardCol is the schema of one column in a shardHeader -- the Type is
+// saved as an int because etensor.Type does not decode from JSON
+type shardCol struct {
+	Name      string
+	Type      int
+	CellShape []int
+	DimNames  []string
+}
+
+// SaveShard saves given table as a binary tensor shard file, which is
+// much faster to read than CSV, for use in StreamTable.  The format is:
+// the ShardMagic line, a line of JSON with the number of Rows and the
+// schema of the Cols, and then each column in turn: all the values as little-endian
+// float32 for FLOAT32 columns, float64 for other numeric columns, and
+// for STRING columns, a uvarint length and the bytes of each string.
+func SaveShard(dt *etable.Table, filename string) error {
+	fp, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(fp)
+	err = WriteShard(dt, bw)
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteShard writes given table in the binary tensor shard format
+// -- see SaveShard
+func WriteShard(dt *etable.Table, w io.Writer) error {
+	sh := &shardHeader{Rows: dt.Rows}
+	for _, sc := range dt.Schema() {
+		sh.Cols = append(sh.Cols, shardCol{Name: sc.Name, Type: int(sc.Type), CellShape: sc.CellShape, DimNames: sc.DimNames})
+	}
+	hdr, err := json.Marshal(sh)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, ShardMagic+"\n"+string(hdr)+"\n"); err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	for _, col := range dt.Cols {
+		n := col.Len()
+		switch col.DataType() {
+		case etensor.STRING:
+			for i := 0; i < n; i++ {
+				s := col.StringVal1D(i)
+				ln := binary.PutUvarint(buf[:], uint64(len(s)))
+				if _, err := w.Write(buf[:ln]); err != nil {
+					return err
+				}
+				if _, err := io.WriteString(w, s); err != nil {
+					return err
+				}
+			}
+		case etensor.FLOAT32:
+			for i := 0; i < n; i++ {
+				binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(col.FloatVal1D(i))))
+				if _, err := w.Write(buf[:4]); err != nil {
+					return err
+				}
+			}
+		default:
+			for i := 0; i < n; i++ {
+				binary.LittleEndian.PutUint64(buf[:], math.Float64bits(col.FloatVal1D(i)))
+				if _, err := w.Write(buf[:8]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// OpenShard opens a binary tensor shard file saved by SaveShard
+func OpenShard(filename string) (*etable.Table, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	dt, err := ReadShard(bufio.NewReader(fp))
+	if err != nil {
+		return nil, fmt.Errorf("env.OpenShard: %s: %w", filename, err)
+	}
+	return dt, nil
+}
+
+// ReadShard reads a table in the binary tensor shard format -- see SaveShard
+func ReadShard(r *bufio.Reader) (*etable.Table, error) {
+	magic, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(magic) != ShardMagic {
+		return nil, fmt.Errorf("not a tensor shard file")
+	}
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	hdr := &shardHeader{}
+	if err := json.Unmarshal(line, hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Rows < 0 {
+		return nil, fmt.Errorf("invalid number of rows: %d", hdr.Rows)
+	}
+	sch := make(etable.Schema, len(hdr.Cols))
+	for i, sc := range hdr.Cols {
+		sch[i] = etable.Column{Name: sc.Name, Type: etensor.Type(sc.Type), CellShape: sc.CellShape, DimNames: sc.DimNames}
+	}
+	dt := etable.New(sch, hdr.Rows)
+	var buf [8]byte
+	for ci, col := range dt.Cols {
+		n := col.Len()
+		switch col.DataType() {
+		case etensor.STRING:
+			for i := 0; i < n; i++ {
+				ln, err := binary.ReadUvarint(r)
+				if err != nil {
+					return nil, err
+				}
+				if ln > uint64(ShardMaxString) {
+					return nil, fmt.Errorf("column %s: string length %d is more than ShardMaxString -- file is corrupt", dt.ColNames[ci], ln)
+				}
+				sb := make([]byte, ln)
+				if _, err := io.ReadFull(r, sb); err != nil {
+					return nil, err
+				}
+				col.SetString1D(i, string(sb))
+			}
+		case etensor.FLOAT32:
+			for i := 0; i < n; i++ {
+				if _, err := io.ReadFull(r, buf[:4]); err != nil {
+					return nil, err
+				}
+				col.SetFloat1D(i, float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[:4]))))
+			}
+		default:
+			for i := 0; i < n; i++ {
+				if _, err := io.ReadFull(r, buf[:8]); err != nil {
+					return nil, err
+				}
+				col.SetFloat1D(i, math.Float64frombits(binary.LittleEndian.Uint64(buf[:8])))
+			}
+		}
+	}
+	return dt, nil
+}
+
+// OpenShardFile opens a shard of patterns for StreamTable, based on the
+// file extension: ShardExt for binary tensor shards, .tsv for
+// tab-separated, and otherwise comma-separated values, using etable.OpenCSV.
+func OpenShardFile(filename string) (*etable.Table, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ShardExt:
+		return OpenShard(filename)
+	case ".tsv":
+		dt := &etable.Table{}
+		return dt, dt.OpenCSV(gi.FileName(filename), etable.Tab)
+	}
+	dt := &etable.Table{}
+	return dt, dt.OpenCSV(gi.FileName(filename), etable.Comma)
+}
+
+// ShardSchemaCheck returns an error if the columns of given shard table
+// do not have the same names, types and cell shapes as given schema,
+// e.g., of the first shard
+func ShardSchemaCheck(sch etable.Schema, dt *etable.Table) error {
+	dsc := dt.Schema()
+	if len(dsc) != len(sch) {
+		return fmt.Errorf("has %d columns instead of %d", len(dsc), len(sch))
+	}
+	for i, sc := range sch {
+		dc := dsc[i]
+		if dc.Name != sc.Name || dc.Type != sc.Type || !equalInts(dc.CellShape, sc.CellShape) {
+			return fmt.Errorf("column %d: %s %v %v does not match: %s %v %v", i, dc.Name, dc.Type, dc.CellShape, sc.Name, sc.Type, sc.CellShape)
+		}
+	}
+	return nil
+}
+
+// equalInts returns true if the two slices have the same values
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etable"
+)
+
+// Strata returns the rows of given view grouped by the values of the
+// given column (e.g., "Group" or "Name"), in order of first appearance,
+// with rows in view order within each group.  If col is empty, all rows
+// are in one group.
+func Strata(ix *etable.IdxView, col string) ([][]int, error) {
+	if col == "" {
+		return [][]int{append([]int{}, ix.Idxs...)}, nil
+	}
+	cl, err := ix.Table.ColByNameTry(col)
+	if err != nil {
+		return nil, fmt.Errorf("env.Strata: %w", err)
+	}
+	var strata [][]int
+	gps := map[string]int{}
+	for _, row := range ix.Idxs {
+		val := cl.StringVal1D(row)
+		gi, has := gps[val]
+		if !has {
+			gi = len(strata)
+			gps[val] = gi
+			strata = append(strata, nil)
+		}
+		strata[gi] = append(strata[gi], row)
+	}
+	return strata, nil
+}
+
+// StratSplits splits the rows of given view into len(props) views, with
+// each having the given proportion of the rows (props are normalized to
+// sum to 1), stratified by the values of the given column, so each group
+// has the same proportions in each split (col = "" for no stratification).
+// Rows are permuted by a random number source seeded with the run number,
+// so each run has a different but reproducible split.
+func StratSplits(ix *etable.IdxView, col string, props []float64, run int) ([]*etable.IdxView, error) {
+	if len(props) == 0 {
+		return nil, fmt.Errorf("env.StratSplits: no proportions given")
+	}
+	sum := 0.0
+	for _, p := range props {
+		if p < 0 {
+			return nil, fmt.Errorf("env.StratSplits: negative proportion: %g", p)
+		}
+		sum += p
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("env.StratSplits: proportions sum to 0")
+	}
+	strata, err := Strata(ix, col)
+	if err != nil {
+		return nil, err
+	}
+	rnd := erand.NewSysRand(int64(run))
+	splits := make([]*etable.IdxView, len(props))
+	for si := range splits {
+		splits[si] = etable.NewIdxView(ix.Table)
+		splits[si].Idxs = nil
+	}
+	for _, rows := range strata {
+		erand.PermuteInts(rows, rnd)
+		n := len(rows)
+		st := 0
+		cum := 0.0
+		for si, p := range props {
+			cum += p
+			ed := int(math.Round(cum / sum * float64(n)))
+			if si == len(props)-1 {
+				ed = n
+			}
+			splits[si].Idxs = append(splits[si].Idxs, rows[st:ed]...)
+			st = ed
+		}
+	}
+	return splits, nil
+}
+
+// TrainValidTest returns stratified Train, Validate and Test views of the
+// given view, with the given proportions of rows for Validate and Test, and
+// the rest for Train -- see StratSplits.
+func TrainValidTest(ix *etable.IdxView, col string, validate, test float64, run int) (trn, val, tst *etable.IdxView, err error) {
+	if validate+test > 1 {
+		return nil, nil, nil, fmt.Errorf("env.TrainValidTest: validate + test proportions > 1: %g", validate+test)
+	}
+	spl, err := StratSplits(ix, col, []float64{1 - validate - test, validate, test}, run)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return spl[0], spl[1], spl[2], nil
+}
+
+// KFolds partitions the rows of given view into k folds of (nearly) equal
+// size, stratified by the values of the given column, so each fold has
+// (nearly) the same number of rows from each group (col = "" for no
+// stratification).  Rows are permuted by a random number source seeded
+// with the run number.  Use KFold to get train and test views for one fold.
+func KFolds(ix *etable.IdxView, col string, k, run int) ([]*etable.IdxView, error) {
+	if k < 2 {
+		return nil, fmt.Errorf("env.KFolds: k must be >= 2: %d", k)
+	}
+	strata, err := Strata(ix, col)
+	if err != nil {
+		return nil, err
+	}
+	rnd := erand.NewSysRand(int64(run))
+	folds := make([]*etable.IdxView, k)
+	for fi := range folds {
+		folds[fi] = etable.NewIdxView(ix.Table)
+		folds[fi].Idxs = nil
+	}
+	fi := 0 // continues across groups, so folds stay balanced overall
+	for _, rows := range strata {
+		erand.PermuteInts(rows, rnd)
+		for _, row := range rows {
+			folds[fi].Idxs = append(folds[fi].Idxs, row)
+			fi = (fi + 1) % k
+		}
+	}
+	return folds, nil
+}
+
+// KFold returns the train and test views for the given fold of k-fold
+// cross-validation: test is the fold from KFolds, and train is all the
+// other folds.
+func KFold(ix *etable.IdxView, col string, k, fold, run int) (trn, tst *etable.IdxView, err error) {
+	if fold < 0 || fold >= k {
+		return nil, nil, fmt.Errorf("env.KFold: fold %d out of range for k = %d", fold, k)
+	}
+	folds, err := KFolds(ix, col, k, run)
+	if err != nil {
+		return nil, nil, err
+	}
+	trn = etable.NewIdxView(ix.Table)
+	trn.Idxs = nil
+	for fi, fv := range folds {
+		if fi != fold {
+			trn.Idxs = append(trn.Idxs, fv.Idxs...)
+		}
+	}
+	return trn, folds[fold], nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+)
+
+// groupCount returns the number of rows in view in given group
+func groupCount(ix *etable.IdxView, gp string) int {
+	n := 0
+	for _, row := range ix.Idxs {
+		if ix.Table.CellString("Group", row) == gp {
+			n++
+		}
+	}
+	return n
+}
+
+// checkPartition checks that the views contain all rows once
+func checkPartition(t *testing.T, ix *etable.IdxView, views ...*etable.IdxView) {
+	var all []int
+	for _, v := range views {
+		all = append(all, v.Idxs...)
+	}
+	sort.Ints(all)
+	if len(all) != ix.Len() {
+		t.Fatalf("views have %d rows, expected %d", len(all), ix.Len())
+	}
+	for i, row := range all {
+		if row != i {
+			t.Fatalf("views are not a partition of the rows: %v", all)
+		}
+	}
+}
+
+func TestTrainValidTest(t *testing.T) {
+	ix := testTable("r", 30, "A", "A", "B")
+	trn, val, tst, err := TrainValidTest(ix, "Group", .2, .1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartition(t, ix, trn, val, tst)
+	if groupCount(trn, "A") != 14 || groupCount(val, "A") != 4 || groupCount(tst, "A") != 2 ||
+		groupCount(trn, "B") != 7 || groupCount(val, "B") != 2 || groupCount(tst, "B") != 1 {
+		t.Errorf("not stratified: train: %v  validate: %v  test: %v", trn.Idxs, val.Idxs, tst.Idxs)
+	}
+	trn2, _, _, _ := TrainValidTest(ix, "Group", .2, .1, 1)
+	trn3, _, _, _ := TrainValidTest(ix, "Group", .2, .1, 2)
+	if fmt.Sprint(trn.Idxs) != fmt.Sprint(trn2.Idxs) {
+		t.Errorf("same run gave a different split")
+	}
+	if fmt.Sprint(trn.Idxs) == fmt.Sprint(trn3.Idxs) {
+		t.Errorf("different run gave the same split")
+	}
+	if _, _, _, err := TrainValidTest(ix, "Bad", .2, .1, 1); err == nil {
+		t.Errorf("expected error for missing column")
+	}
+
+	var evs Envs
+	if err := evs.SplitTable(ix, "Group", .2, .1, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []etime.Modes{etime.Train, etime.Validate, etime.Test} {
+		ft, ok := evs.ByMode(mode).(*FixedTable)
+		if !ok {
+			t.Fatalf("no FixedTable for mode %v", mode)
+		}
+		if ft.Sequential != (mode != etime.Train) {
+			t.Errorf("mode %v Sequential: %v", mode, ft.Sequential)
+		}
+	}
+	if evs.ByMode(etime.Validate).(*FixedTable).Table.Len() != 6 {
+		t.Errorf("Validate env has wrong number of rows")
+	}
+}
+
+func TestKFold(t *testing.T) {
+	ix := testTable("r", 30, "A", "A", "B")
+	folds, err := KFolds(ix, "Group", 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartition(t, ix, folds...)
+	for fi, f := range folds {
+		if groupCount(f, "A") != 4 || groupCount(f, "B") != 2 {
+			t.Errorf("fold %d not stratified: %v", fi, f.Idxs)
+		}
+	}
+	trn, tst, err := KFold(ix, "Group", 5, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartition(t, ix, trn, tst)
+	if fmt.Sprint(tst.Idxs) != fmt.Sprint(folds[2].Idxs) {
+		t.Errorf("KFold test is not the fold from KFolds")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/emer/emergent/erand"
+)
+
+// StateSaver is an optional interface for an Env that can save and load
+// its state: counters, presentation order, current names, and the position
+// of its random number source, so that a run can be resumed mid-epoch
+// with exactly the same sequence of trials.  An env that draws from a
+// random number source whose position cannot be saved (e.g., the global
+// one) cannot be resumed exactly, so its SaveState returns an error.
+type StateSaver interface {
+	// SaveState saves the state of the env to given writer -- returns an
+	// error if the state cannot be restored exactly, e.g., because the
+	// random number source cannot be saved
+	SaveState(w io.Writer) error
+
+	// LoadState loads the state of the env from given reader, saved by
+	// SaveState -- the env must already be configured the same way,
+	// e.g., with the same Table
+	LoadState(r io.Reader) error
+}
+
+// SaveStateFile saves the state of given env to given file
+func SaveStateFile(ss StateSaver, filename string) error {
+	fp, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = ss.SaveState(fp)
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// LoadStateFile loads the state of given env from given file
+func LoadStateFile(ss StateSaver, filename string) error {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return ss.LoadState(fp)
+}
+
+// TableState is the state of the table envs: FixedTable, FreqTable and
+// MPIFixedTable, saved as JSON by SaveState.  The random number source
+// position is only saved for envs with OwnRand, as the global source
+// cannot be saved.
+type TableState struct {
+	Order     []int        `desc:"presentation order"`
+	Run       Ctr          `desc:"Run counter"`
+	Epoch     Ctr          `desc:"Epoch counter"`
+	Trial     Ctr          `desc:"Trial counter"`
+	TrialName CurPrvString `desc:"current trial name"`
+	GroupName CurPrvString `desc:"current group name"`
+	OwnRand   bool         `desc:"env uses its own random number source, and its position is saved"`
+	RandSeed  int64        `desc:"seed of the random number source"`
+	RandN     uint64       `desc:"number of values drawn from the random number source"`
+}
+
+// SetRand sets the random number source position from given source,
+// if non-nil
+func (ts *TableState) SetRand(src *erand.PosSource) {
+	if src == nil {
+		return
+	}
+	ts.OwnRand = true
+	ts.RandSeed, ts.RandN = src.Pos()
+}
+
+// Save saves the state as JSON to given writer
+func (ts *TableState) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ts)
+}
+
+// Load loads the state as JSON from given reader, checking that the
+// Order is valid for given number of rows, and that the random number
+// source is the same kind
+func (ts *TableState) Load(r io.Reader, nrows int, src *erand.PosSource) error {
+	if err := json.NewDecoder(r).Decode(ts); err != nil {
+		return err
+	}
+	return ts.restore(nrows, src)
+}
+
+// restore checks that the loaded Order is valid for given number of
+// items, and that the random number source is the same kind, and
+// sets its position
+func (ts *TableState) restore(nitems int, src *erand.PosSource) error {
+	for _, oi := range ts.Order {
+		if oi < 0 || oi >= nitems {
+			return fmt.Errorf("Order index: %d out of range for %d items", oi, nitems)
+		}
+	}
+	if ts.OwnRand != (src != nil) {
+		return fmt.Errorf("saved OwnRand: %v does not match env OwnRand -- Init env with the same OwnRand first", ts.OwnRand)
+	}
+	if src != nil {
+		src.SetPos(ts.RandSeed, ts.RandN)
+	}
+	return nil
+}
+
+// SequenceState is the state of a SequenceTable, saved as JSON by SaveState:
+// the TableState, with the Order of the sequences, and the Sequence and
+// Tick counters and current sequence name.
+type SequenceState struct {
+	TableState
+	Sequence Ctr          `desc:"Sequence counter"`
+	Tick     Ctr          `desc:"Tick counter"`
+	SeqName  CurPrvString `desc:"current sequence name"`
+}
+
+// Save saves the state as JSON to given writer
+func (ss *SequenceState) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ss)
+}
+
+// Load loads the state as JSON from given reader, checking that the
+// Order is valid for given number of sequences, and that the random
+// number source is the same kind
+func (ss *SequenceState) Load(r io.Reader, nseqs int, src *erand.PosSource) error {
+	if err := json.NewDecoder(r).Decode(ss); err != nil {
+		return err
+	}
+	return ss.restore(nseqs, src)
+}
+
+// tableStateVars points to the state variables of a table env, for the
+// TableState, SaveState and LoadState methods of FixedTable, FreqTable,
+// MPIFixedTable and SequenceTable
+type tableStateVars struct {
+	typ       string           // type name, for errors
+	nm        string           // env name, for errors
+	order     *[]int           // presentation order
+	run       *Ctr             // Run counter
+	epoch     *Ctr             // Epoch counter
+	trial     *Ctr             // Trial counter
+	trialName *CurPrvString    // current trial name
+	groupName *CurPrvString    // current group name
+	nrows     int              // number of rows (or sequences) in the Order
+	randSrc   *erand.PosSource // own random number source, nil if not OwnRand
+	random    bool             // env draws random numbers, e.g., not Sequential
+}
+
+// state returns the current state
+func (tv *tableStateVars) state() *TableState {
+	ts := &TableState{Order: append([]int{}, *tv.order...), Run: *tv.run, Epoch: *tv.epoch, Trial: *tv.trial, TrialName: *tv.trialName, GroupName: *tv.groupName}
+	ts.SetRand(tv.randSrc)
+	return ts
+}
+
+// check returns an error if the env draws random numbers from the
+// global source, which cannot be saved, so a resumed run would differ
+func (tv *tableStateVars) check() error {
+	if tv.random && tv.randSrc == nil {
+		return fmt.Errorf("env.%s: %v SaveState: random order cannot be resumed exactly without OwnRand -- set OwnRand, or Sequential", tv.typ, tv.nm)
+	}
+	return nil
+}
+
+// save saves the current state to given writer -- see check
+func (tv *tableStateVars) save(w io.Writer) error {
+	if err := tv.check(); err != nil {
+		return err
+	}
+	if err := tv.state().Save(w); err != nil {
+		return fmt.Errorf("env.%s: %v SaveState: %w", tv.typ, tv.nm, err)
+	}
+	return nil
+}
+
+// load loads the state saved by save from given reader
+func (tv *tableStateVars) load(r io.Reader) error {
+	ts := &TableState{}
+	if err := ts.Load(r, tv.nrows, tv.randSrc); err != nil {
+		return fmt.Errorf("env.%s: %v LoadState: %w", tv.typ, tv.nm, err)
+	}
+	tv.set(ts)
+	return nil
+}
+
+// set sets the state variables from given loaded state
+func (tv *tableStateVars) set(ts *TableState) {
+	*tv.order = ts.Order
+	*tv.run = ts.Run
+	*tv.epoch = ts.Epoch
+	*tv.trial = ts.Trial
+	*tv.trialName = ts.TrialName
+	*tv.groupName = ts.GroupName
+}
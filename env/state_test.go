@@ -0,0 +1,90 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// stateEnvs returns new envs of each type that implement StateSaver
+func stateEnvs() []Env {
+	return []Env{
+		&FixedTable{Nm: "Fixed", Table: testTable("i", 10), OwnRand: true, RndSeed: 1},
+		&FreqTable{Nm: "Freq", Table: testTable("i", 10), NSamples: 2, RndSamp: true, OwnRand: true, RndSeed: 1},
+		&MPIFixedTable{Nm: "MPI", Table: testTable("i", 10), OwnRand: true, RndSeed: 1},
+		&SequenceTable{Nm: "Seq", Table: testTable("i", 10, "A", "A", "B", "C", "C", "D", "E", "E", "E", "F"), SeqCol: "Group", OwnRand: true, RndSeed: 1},
+	}
+}
+
+// stateSteps steps given env n times, returning the trial names and counters
+func stateSteps(ev Env, n int) string {
+	var bs bytes.Buffer
+	for i := 0; i < n; i++ {
+		ev.Step()
+		epc, _, _ := ev.Counter(Epoch)
+		trl, _, _ := ev.Counter(Trial)
+		var nm string
+		switch et := ev.(type) {
+		case *FixedTable:
+			nm = et.TrialName.Cur
+		case *FreqTable:
+			nm = et.TrialName.Cur
+		case *MPIFixedTable:
+			nm = et.TrialName.Cur
+		case *SequenceTable:
+			nm = et.TrialName.Cur
+		}
+		fmt.Fprintf(&bs, "%d:%d:%s ", epc, trl, nm)
+	}
+	return bs.String()
+}
+
+func TestStateSaver(t *testing.T) {
+	evs := stateEnvs()
+	rss := stateEnvs()
+	for ei, ev := range evs {
+		ev.Init(2)
+		stateSteps(ev, 7)
+		var buf bytes.Buffer
+		if err := ev.(StateSaver).SaveState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		exp := stateSteps(ev, 25)
+
+		rs := rss[ei]
+		rs.Init(2)
+		stateSteps(rs, 3) // different position
+		if err := rs.(StateSaver).LoadState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := stateSteps(rs, 25); got != exp {
+			t.Errorf("%s: resumed run differs:\n%s\nexpected:\n%s", ev.Name(), got, exp)
+		}
+	}
+
+	ft := &FixedTable{Nm: "Global", Table: testTable("i", 10)}
+	ft.Init(0)
+	var buf bytes.Buffer
+	evs[0].(*FixedTable).SaveState(&buf)
+	if err := ft.LoadState(&buf); err == nil {
+		t.Errorf("expected error loading OwnRand state into env without OwnRand")
+	}
+
+	buf.Reset()
+	if err := ft.SaveState(&buf); err == nil {
+		t.Errorf("expected error saving random order state without OwnRand")
+	}
+	ft.Sequential = true
+	if err := ft.SaveState(&buf); err != nil {
+		t.Errorf("Sequential state without OwnRand: %v", err)
+	}
+	fq := &FreqTable{Nm: "Global", Table: testTable("i", 10), NSamples: 2, RndSamp: true, Sequential: true}
+	fq.Init(0)
+	if err := fq.SaveState(&buf); err == nil {
+		t.Errorf("expected error saving random sampling state without OwnRand")
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// StreamTable is an Env that streams patterns from a list of shard files
+// on disk (see OpenShardFile: etable CSV / TSV, or binary tensor shards
+// saved with SaveShard), for datasets that do not fit in memory.
+// Shards are loaded ahead by a prefetch goroutine, and rows are presented
+// through a shuffle buffer, with shard order and shuffling determined by
+// a random number source seeded with Seed + run, so the order is
+// reproducible.  Each Epoch is one pass through all the shards, and it
+// has the same Run / Epoch / Trial counters as FixedTable.
+// All shards must have the same columns as the first one, which is
+// checked as each shard is loaded.
+type StreamTable struct {
+	Nm            string        `desc:"name of this environment"`
+	Dsc           string        `desc:"description of this environment"`
+	Shards        []string      `desc:"shard file names, presented in this order unless ShuffleShards"`
+	ShuffleShards bool          `desc:"permute the order of the shards every epoch"`
+	ShuffleBuf    int           `desc:"size of the shuffle buffer: each trial presents a random row from a buffer of this many rows, refilled in shard order -- <= 1 = sequential order"`
+	Prefetch      int           `def:"2" desc:"number of shards loaded ahead of the current one"`
+	Seed          int64         `desc:"random seed: the random number source is seeded with Seed + run in Init, so each run is reproducible"`
+	Rand          erand.SysRand `view:"-" desc:"random number source for shard order and shuffling"`
+	Run           Ctr           `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch         Ctr           `view:"inline" desc:"number of times through all the shards"`
+	Trial         Ctr           `view:"inline" desc:"current row within the epoch"`
+	EpochRows     int           `inactive:"+" desc:"number of rows in the last complete epoch -- 0 until the first epoch is complete"`
+	TrialName     CurPrvString  `desc:"if the shards have a Name column, this is the contents of that"`
+	GroupName     CurPrvString  `desc:"if the shards have a Group column, this is contents of that"`
+	NameCol       string        `desc:"name of the Name column -- defaults to 'Name'"`
+	GroupCol      string        `desc:"name of the Group column -- defaults to 'Group'"`
+	Schema        etable.Schema `desc:"schema of the shards, from the first shard"`
+	Err           error         `inactive:"+" desc:"last error loading a shard"`
+
+	curTable *etable.Table // table of the current row
+	curRow   int           // current row in curTable
+	buf      []streamRow   // shuffle buffer
+	shard    *etable.Table // shard being read into the buffer
+	shardRow int           // next row to read from shard
+	loads    chan shardLoad
+	stop     chan struct{}
+}
+
+// streamRow is a row in a shard table
+type streamRow struct {
+	dt  *etable.Table
+	row int
+}
+
+// shardLoad is the result of loading a shard
+type shardLoad struct {
+	dt  *etable.Table
+	err error
+}
+
+func (st *StreamTable) Name() string { return st.Nm }
+func (st *StreamTable) Desc() string { return st.Dsc }
+
+// Validate checks that there are shards, and gets the Schema
+// from the first one
+func (st *StreamTable) Validate() error {
+	if len(st.Shards) == 0 {
+		return fmt.Errorf("env.StreamTable: %v has no Shards set", st.Nm)
+	}
+	if st.Schema != nil {
+		return nil
+	}
+	dt, err := OpenShardFile(st.Shards[0])
+	if err != nil {
+		return fmt.Errorf("env.StreamTable: %v: %w", st.Nm, err)
+	}
+	if dt.NumCols() == 0 {
+		return fmt.Errorf("env.StreamTable: %v shard %s has no columns", st.Nm, st.Shards[0])
+	}
+	st.Schema = dt.Schema()
+	return nil
+}
+
+func (st *StreamTable) Init(run int) {
+	if st.NameCol == "" {
+		st.NameCol = "Name"
+	}
+	if st.GroupCol == "" {
+		st.GroupCol = "Group"
+	}
+	if st.Prefetch < 1 {
+		st.Prefetch = 2
+	}
+	st.Rand.NewRand(st.Seed + int64(run))
+	st.Run.Scale = Run
+	st.Epoch.Scale = Epoch
+	st.Trial.Scale = Trial
+	st.Run.Init()
+	st.Epoch.Init()
+	st.Trial.Init()
+	st.Run.Cur = run
+	st.Trial.Cur = -1 // init state -- key so that first Step() = 0
+	st.EpochRows = 0
+	st.Err = nil
+	st.curTable = nil
+	st.StartEpoch()
+}
+
+// StartEpoch starts loading the shards for a new epoch, stopping any
+// current loading
+func (st *StreamTable) StartEpoch() {
+	st.Close()
+	order := make([]int, len(st.Shards))
+	for i := range order {
+		order[i] = i
+	}
+	if st.ShuffleShards {
+		erand.PermuteInts(order, &st.Rand)
+	}
+	st.buf = st.buf[:0]
+	st.shard = nil
+	st.shardRow = 0
+	loads := make(chan shardLoad, st.Prefetch)
+	stop := make(chan struct{})
+	st.loads = loads
+	st.stop = stop
+	shards := make([]string, len(order))
+	for i, si := range order {
+		shards[i] = st.Shards[si]
+	}
+	sch := st.Schema
+	go func() {
+		defer close(loads)
+		for _, fn := range shards {
+			dt, err := OpenShardFile(fn)
+			if err == nil && sch != nil {
+				if serr := ShardSchemaCheck(sch, dt); serr != nil {
+					err = fmt.Errorf("shard %s: %w", fn, serr)
+				}
+			}
+			select {
+			case loads <- shardLoad{dt: dt, err: err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the prefetch goroutine, if running
+func (st *StreamTable) Close() {
+	if st.stop != nil {
+		close(st.stop)
+		st.stop = nil
+	}
+}
+
+// nextSrcRow returns the next row in shard order, false if no more
+// rows in this epoch
+func (st *StreamTable) nextSrcRow() (streamRow, bool) {
+	for st.shard == nil || st.shardRow >= st.shard.Rows {
+		ld, ok := <-st.loads
+		if !ok {
+			return streamRow{}, false
+		}
+		if ld.err != nil {
+			st.Err = ld.err
+			log.Println(fmt.Errorf("env.StreamTable: %v: %w", st.Nm, ld.err))
+			return streamRow{}, false
+		}
+		st.shard = ld.dt
+		st.shardRow = 0
+	}
+	sr := streamRow{dt: st.shard, row: st.shardRow}
+	st.shardRow++
+	return sr, true
+}
+
+// nextRow returns the next row to present through the shuffle buffer,
+// false if no more rows in this epoch
+func (st *StreamTable) nextRow() (streamRow, bool) {
+	bsz := st.ShuffleBuf
+	if bsz < 1 {
+		bsz = 1
+	}
+	for len(st.buf) < bsz {
+		sr, ok := st.nextSrcRow()
+		if !ok {
+			break
+		}
+		st.buf = append(st.buf, sr)
+	}
+	n := len(st.buf)
+	if n == 0 {
+		return streamRow{}, false
+	}
+	i := 0
+	if n > 1 {
+		i = st.Rand.Intn(n, -1)
+	}
+	sr := st.buf[i]
+	if bsz == 1 {
+		st.buf = st.buf[:0]
+		return sr, true
+	}
+	st.buf[i] = st.buf[n-1]
+	st.buf = st.buf[:n-1]
+	return sr, true
+}
+
+func (st *StreamTable) Step() bool {
+	st.Epoch.Same() // good idea to just reset all non-inner-most counters at start
+	sr, ok := st.nextRow()
+	if !ok {
+		if st.Err != nil {
+			return false
+		}
+		st.EpochRows = st.Trial.Cur + 1
+		st.StartEpoch()
+		if sr, ok = st.nextRow(); !ok {
+			return false
+		}
+		st.Epoch.Incr()
+		st.Trial.Prv = st.Trial.Cur
+		st.Trial.Cur = 0
+		st.Trial.Chg = true
+	} else {
+		st.Trial.Incr()
+	}
+	st.curTable = sr.dt
+	st.curRow = sr.row
+	st.setNames()
+	return true
+}
+
+// setNames sets the TrialName and GroupName from the current row
+func (st *StreamTable) setNames() {
+	if nms, err := st.curTable.ColByNameTry(st.NameCol); err == nil {
+		st.TrialName.Set(nms.StringVal1D(st.curRow))
+	}
+	if nms, err := st.curTable.ColByNameTry(st.GroupCol); err == nil {
+		st.GroupName.Set(nms.StringVal1D(st.curRow))
+	}
+}
+
+// Row returns the current table and row in it
+func (st *StreamTable) Row() (*etable.Table, int) {
+	return st.curTable, st.curRow
+}
+
+func (st *StreamTable) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return st.Run.Query()
+	case Epoch:
+		return st.Epoch.Query()
+	case Trial:
+		return st.Trial.Query()
+	}
+	return -1, -1, false
+}
+
+func (st *StreamTable) State(element string) etensor.Tensor {
+	if st.curTable == nil {
+		return nil
+	}
+	et, err := st.curTable.CellTensorTry(element, st.curRow)
+	if err != nil {
+		log.Println(err)
+	}
+	return et
+}
+
+func (st *StreamTable) Action(element string, input etensor.Tensor) {
+	// nop
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*StreamTable)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (st *StreamTable) Counters() []TimeScales {
+	return []TimeScales{Run, Epoch, Trial}
+}
+
+func (st *StreamTable) States() Elements {
+	els := Elements{}
+	els.FromSchema(st.Schema)
+	return els
+}
+
+func (st *StreamTable) Actions() Elements {
+	return nil
+}
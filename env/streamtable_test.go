@@ -0,0 +1,158 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// testShards saves 3 shards of 4 rows each, as CSV, TSV and binary shards
+func testShards(t *testing.T) []string {
+	dir := t.TempDir()
+	sch := etable.Schema{
+		{Name: "Name", Type: etensor.STRING},
+		{Name: "Input", Type: etensor.FLOAT32, CellShape: []int{2, 2}, DimNames: []string{"Y", "X"}},
+	}
+	var fns []string
+	for si, ext := range []string{".csv", ".tsv", ShardExt} {
+		dt := etable.New(sch, 4)
+		for r := 0; r < 4; r++ {
+			dt.SetCellString("Name", r, fmt.Sprintf("s%d_%d", si, r))
+			dt.CellTensor("Input", r).SetFloat1D(r, float64(si+1))
+		}
+		fn := filepath.Join(dir, fmt.Sprintf("shard%d%s", si, ext))
+		var err error
+		switch ext {
+		case ".csv":
+			err = dt.SaveCSV(gi.FileName(fn), etable.Comma, etable.Headers)
+		case ".tsv":
+			err = dt.SaveCSV(gi.FileName(fn), etable.Tab, etable.Headers)
+		default:
+			err = SaveShard(dt, fn)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fns = append(fns, fn)
+	}
+	return fns
+}
+
+// streamNames returns the trial names for given number of steps
+func streamNames(t *testing.T, st *StreamTable, n int) []string {
+	var nms []string
+	for i := 0; i < n; i++ {
+		if !st.Step() {
+			t.Fatalf("Step failed at %d: %v", i, st.Err)
+		}
+		nms = append(nms, st.TrialName.Cur)
+	}
+	return nms
+}
+
+func TestShard(t *testing.T) {
+	fns := testShards(t)
+	dt, err := OpenShard(fns[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt.Rows != 4 || dt.CellString("Name", 3) != "s2_3" || dt.CellTensor("Input", 3).FloatVal1D(3) != 3 {
+		t.Errorf("shard not read correctly")
+	}
+	if dn := dt.ColByName("Input").DimNames(); dn[2] != "X" {
+		t.Errorf("shard dim names: %v", dn)
+	}
+}
+
+func TestShardCorrupt(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString(ShardMagic + "\n" + `{"Rows":1,"Cols":[{"Name":"Name","Type":` + fmt.Sprint(int(etensor.STRING)) + `}]}` + "\n")
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], 1<<40)])
+	if _, err := ReadShard(bufio.NewReader(&b)); err == nil {
+		t.Errorf("expected error for corrupt string length")
+	}
+}
+
+func TestStreamTable(t *testing.T) {
+	fns := testShards(t)
+	st := &StreamTable{Nm: "Stream", Shards: fns}
+	if err := st.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if els := st.States(); len(els) != 2 || els[1].Shape[1] != 2 {
+		t.Errorf("States wrong: %v", els)
+	}
+	st.Init(0)
+	nms := streamNames(t, st, 13)
+	for i := 0; i < 12; i++ {
+		if exp := fmt.Sprintf("s%d_%d", i/4, i%4); nms[i] != exp {
+			t.Errorf("sequential row %d = %s, expected %s", i, nms[i], exp)
+		}
+	}
+	if cur, _, chg := st.Counter(Epoch); cur != 1 || !chg || st.Trial.Cur != 0 || st.EpochRows != 12 {
+		t.Errorf("epoch boundary wrong: Epoch: %d %v  Trial: %d  EpochRows: %d", cur, chg, st.Trial.Cur, st.EpochRows)
+	}
+	if st.State("Input").FloatVal1D(0) != 1 {
+		t.Errorf("State wrong: %v", st.State("Input"))
+	}
+
+	st.ShuffleShards = true
+	st.ShuffleBuf = 5
+	st.Seed = 3
+	st.Init(0)
+	a := streamNames(t, st, 24)
+	st.Init(0)
+	b := streamNames(t, st, 24)
+	for ep := 0; ep < 2; ep++ {
+		seen := map[string]bool{}
+		for _, nm := range a[ep*12 : (ep+1)*12] {
+			seen[nm] = true
+		}
+		if len(seen) != 12 {
+			t.Errorf("epoch %d did not present all rows once: %v", ep, a[ep*12:(ep+1)*12])
+		}
+	}
+	same := true
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("order not reproducible at %d: %s vs. %s", i, a[i], b[i])
+		}
+		if i < 12 && a[i] != nms[i] {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("shuffled order is the same as sequential")
+	}
+	st.Close()
+
+	// shard with different columns is an error
+	bad := etable.New(etable.Schema{{Name: "Name", Type: etensor.STRING}}, 2)
+	bfn := filepath.Join(t.TempDir(), "bad"+ShardExt)
+	if err := SaveShard(bad, bfn); err != nil {
+		t.Fatal(err)
+	}
+	st.Shards = append(fns[:1:1], bfn)
+	st.ShuffleShards = false
+	st.ShuffleBuf = 0
+	st.Init(0)
+	for i := 0; i < 5 && st.Err == nil; i++ {
+		st.Step()
+	}
+	if st.Err == nil {
+		t.Errorf("expected error for shard with different columns")
+	}
+	st.Close()
+}
@@ -28,6 +28,15 @@ var KiT_TimeScales = kit.Enums.AddEnum(TimeScalesN, kit.NotBitFlag, nil)
 func (ev TimeScales) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
 func (ev *TimeScales) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
 
+// FromString sets the value from its string name, as needed for UnmarshalJSON
+func (ev *TimeScales) FromString(s string) error {
+	ts, err := StringToTimeScales(s)
+	if err == nil {
+		*ev = ts
+	}
+	return err
+}
+
 // The time scales
 const (
 	// Event is the smallest unit of naturalistic experience that coheres unto itself
@@ -0,0 +1,388 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/emergent/evec"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/minmax"
+	"github.com/goki/ki/kit"
+)
+
+// StimTypes are the types of stimuli generated by VisualEnv
+type StimTypes int
+
+//go:generate stringer -type=StimTypes
+
+var KiT_StimTypes = kit.Enums.AddEnum(StimTypesN, kit.NotBitFlag, nil)
+
+func (ev StimTypes) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *StimTypes) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// The visual stimulus types
+const (
+	// StimBar is an oriented bar, of length Scale and width BarWidth
+	StimBar StimTypes = iota
+
+	// StimGabor is a Gabor grating: a sinusoidal grating with Freq and
+	// Phase along the Angle, in a Gaussian envelope of sigma = Scale / 4,
+	// with values from -1 to 1
+	StimGabor
+
+	// StimDots is a field of NDots dots within a disk of diameter Scale,
+	// moving coherently at Speed in the direction of the Angle
+	StimDots
+
+	// StimCircle is a filled circle of diameter Scale
+	StimCircle
+
+	// StimSquare is a filled square of side Scale, rotated by the Angle
+	StimSquare
+
+	// StimTriangle is a filled equilateral triangle with a vertex pointing
+	// in the direction of the Angle, inscribed in a circle of diameter Scale
+	StimTriangle
+
+	StimTypesN
+)
+
+// VisualEnv is an Env that procedurally generates visual stimuli, e.g.,
+// for V1-style inputs to vision models: oriented bars, Gabor gratings,
+// moving dots and simple shapes (see StimTypes), with position, scale,
+// orientation and other parameters chosen at random within given ranges
+// on each trial, rendered into the Image State of given Size, with
+// optional Gaussian noise.  Each trial has Ticks ticks, over which the
+// dots move (other stimuli are static).  The generative parameters are
+// also States, so these latent factors can be decoded and logged:
+// Stim (one-hot over StimTypes), Pos (X, Y as a proportion of the Size),
+// Scale, Angle, Freq, Phase and Speed.
+type VisualEnv struct {
+	Nm       string          `desc:"name of this environment"`
+	Dsc      string          `desc:"description of this environment"`
+	Size     evec.Vec2i      `desc:"size of the Image, in pixels"`
+	Stims    []StimTypes     `desc:"types of stimuli to generate, chosen at random on each trial -- all if empty"`
+	PosX     minmax.F32      `desc:"range of the X (horizontal) position of the stimulus center, as a proportion of the Size"`
+	PosY     minmax.F32      `desc:"range of the Y (vertical) position of the stimulus center, as a proportion of the Size"`
+	Scale    minmax.F32      `desc:"range of the size of the stimulus, as a proportion of the smaller dimension of the Size"`
+	Angle    minmax.F32      `desc:"range of the orientation, in degrees counterclockwise from horizontal -- also the direction of motion of dots"`
+	Freq     minmax.F32      `desc:"range of the spatial frequency of Gabor gratings, in cycles per Scale"`
+	Speed    minmax.F32      `desc:"range of the speed of moving dots, in pixels per tick"`
+	BarWidth float32         `def:"0.15" desc:"width of bars, as a proportion of their length"`
+	NDots    int             `def:"8" desc:"number of dots"`
+	DotSize  float32         `def:"1" desc:"radius of dots, in pixels"`
+	Noise    float32         `desc:"standard deviation of Gaussian noise added to each pixel -- 0 = none"`
+	Ticks    int             `def:"1" desc:"number of ticks per trial -- dots move by Speed on each tick"`
+	Trials   int             `def:"100" desc:"number of trials per epoch"`
+	RndSeed  int64           `desc:"random seed: the random number source is seeded with RndSeed + run in Init, so each run is reproducible"`
+	Rand     erand.SysRand   `view:"-" desc:"random number source"`
+	Run      Ctr             `view:"inline" desc:"current run of model as provided during Init"`
+	Epoch    Ctr             `view:"inline" desc:"number of times through Trials"`
+	Trial    Ctr             `view:"inline" desc:"current trial within the epoch"`
+	Tick     Ctr             `view:"inline" desc:"current tick within the trial"`
+	CurStim  StimTypes       `inactive:"+" desc:"current stimulus type"`
+	CurPos   [2]float32      `inactive:"+" desc:"current X, Y position of the stimulus center, as a proportion of the Size"`
+	CurScale float32         `inactive:"+" desc:"current scale"`
+	CurAngle float32         `inactive:"+" desc:"current angle in degrees"`
+	CurFreq  float32         `inactive:"+" desc:"current Gabor frequency"`
+	CurPhase float32         `inactive:"+" desc:"current Gabor phase, in radians"`
+	CurSpeed float32         `inactive:"+" desc:"current dot speed"`
+	Image    etensor.Float32 `desc:"the rendered image, [Y][X]"`
+
+	dots   [][2]float32                // dot offsets from the center, in pixels
+	states map[string]*etensor.Float32 // latent factor states
+}
+
+// Defaults sets default parameters
+func (ve *VisualEnv) Defaults() {
+	ve.Size.Set(32, 32)
+	ve.PosX.Set(.3, .7)
+	ve.PosY.Set(.3, .7)
+	ve.Scale.Set(.3, .6)
+	ve.Angle.Set(0, 180)
+	ve.Freq.Set(2, 4)
+	ve.Speed.Set(.5, 1.5)
+	ve.BarWidth = .15
+	ve.NDots = 8
+	ve.DotSize = 1
+	ve.Ticks = 1
+	ve.Trials = 100
+}
+
+func (ve *VisualEnv) Name() string { return ve.Nm }
+func (ve *VisualEnv) Desc() string { return ve.Dsc }
+
+func (ve *VisualEnv) Validate() error {
+	if ve.Size.X < 1 || ve.Size.Y < 1 {
+		return fmt.Errorf("env.VisualEnv: %v has invalid Size: %v -- call Defaults", ve.Nm, ve.Size)
+	}
+	dots := len(ve.Stims) == 0
+	for _, st := range ve.Stims {
+		if st < 0 || st >= StimTypesN {
+			return fmt.Errorf("env.VisualEnv: %v has invalid Stims: %v", ve.Nm, st)
+		}
+		if st == StimDots {
+			dots = true
+		}
+	}
+	if ve.Scale.Min <= 0 || ve.Scale.Max < ve.Scale.Min {
+		return fmt.Errorf("env.VisualEnv: %v has invalid Scale: %v -- Min must be > 0 -- call Defaults", ve.Nm, ve.Scale)
+	}
+	if ve.Trials < 1 {
+		return fmt.Errorf("env.VisualEnv: %v has invalid Trials: %d -- call Defaults", ve.Nm, ve.Trials)
+	}
+	if dots && ve.NDots < 1 {
+		return fmt.Errorf("env.VisualEnv: %v has invalid NDots: %d for StimDots -- call Defaults", ve.Nm, ve.NDots)
+	}
+	return nil
+}
+
+func (ve *VisualEnv) Init(run int) {
+	if ve.Ticks < 1 {
+		ve.Ticks = 1
+	}
+	ve.Rand.NewRand(ve.RndSeed + int64(run))
+	ve.Run.Scale = Run
+	ve.Epoch.Scale = Epoch
+	ve.Trial.Scale = Trial
+	ve.Tick.Scale = Tick
+	ve.Run.Init()
+	ve.Epoch.Init()
+	ve.Trial.Init()
+	ve.Tick.Init()
+	ve.Run.Cur = run
+	ve.Trial.Max = ve.Trials
+	ve.Trial.Cur = -1 // init state -- key so that first Step() = 0
+	ve.Tick.Cur = -1
+	ve.Image.SetShape([]int{ve.Size.Y, ve.Size.X}, nil, []string{"Y", "X"})
+	ve.states = make(map[string]*etensor.Float32)
+	for _, el := range ve.latents() {
+		ve.states[el.Name] = etensor.NewFloat32(el.Shape, nil, nil)
+	}
+}
+
+// latents returns the Elements for the latent factors
+func (ve *VisualEnv) latents() Elements {
+	return Elements{
+		{Name: "Stim", Shape: []int{int(StimTypesN)}},
+		{Name: "Pos", Shape: []int{2}},
+		{Name: "Scale", Shape: []int{1}},
+		{Name: "Angle", Shape: []int{1}},
+		{Name: "Freq", Shape: []int{1}},
+		{Name: "Phase", Shape: []int{1}},
+		{Name: "Speed", Shape: []int{1}},
+	}
+}
+
+// randRange returns a random value in given range
+func (ve *VisualEnv) randRange(mm minmax.F32) float32 {
+	return mm.Min + ve.Rand.Float32(-1)*mm.Range()
+}
+
+// NewStim chooses a new random stimulus
+func (ve *VisualEnv) NewStim() {
+	if len(ve.Stims) > 0 {
+		ve.CurStim = ve.Stims[ve.Rand.Intn(len(ve.Stims), -1)]
+	} else {
+		ve.CurStim = StimTypes(ve.Rand.Intn(int(StimTypesN), -1))
+	}
+	ve.CurPos = [2]float32{ve.randRange(ve.PosX), ve.randRange(ve.PosY)}
+	ve.CurScale = ve.randRange(ve.Scale)
+	ve.CurAngle = ve.randRange(ve.Angle)
+	ve.CurFreq = ve.randRange(ve.Freq)
+	ve.CurPhase = ve.Rand.Float32(-1) * 2 * math.Pi
+	ve.CurSpeed = ve.randRange(ve.Speed)
+	ve.dots = ve.dots[:0]
+	if ve.CurStim == StimDots {
+		rad := 0.5 * ve.CurScale * ve.minSize()
+		for i := 0; i < ve.NDots; i++ {
+			r := rad * float32(math.Sqrt(ve.Rand.Float64(-1)))
+			th := ve.Rand.Float64(-1) * 2 * math.Pi
+			ve.dots = append(ve.dots, [2]float32{r * float32(math.Cos(th)), r * float32(math.Sin(th))})
+		}
+	}
+}
+
+// minSize returns the smaller dimension of the Size
+func (ve *VisualEnv) minSize() float32 {
+	if ve.Size.X < ve.Size.Y {
+		return float32(ve.Size.X)
+	}
+	return float32(ve.Size.Y)
+}
+
+// Move moves the dots by the Speed in the direction of the Angle
+func (ve *VisualEnv) Move() {
+	if ve.CurStim != StimDots {
+		return
+	}
+	rad := float64(ve.CurAngle) * math.Pi / 180
+	ve.CurPos[0] += ve.CurSpeed * float32(math.Cos(rad)) / float32(ve.Size.X)
+	ve.CurPos[1] += ve.CurSpeed * float32(math.Sin(rad)) / float32(ve.Size.Y)
+}
+
+// coverage returns the anti-aliased coverage of a pixel at distance d
+// from the center of a region of half-width h
+func coverage(d, h float32) float32 {
+	v := h - d + 0.5
+	switch {
+	case v < 0:
+		return 0
+	case v > 1:
+		return 1
+	}
+	return v
+}
+
+// Render renders the current stimulus into the Image, adding Noise
+func (ve *VisualEnv) Render() {
+	cx := ve.CurPos[0] * float32(ve.Size.X)
+	cy := ve.CurPos[1] * float32(ve.Size.Y)
+	s := ve.CurScale * ve.minSize()
+	if s < 1 { // at least 1 pixel, so the Gabor is defined
+		s = 1
+	}
+	rad := float64(ve.CurAngle) * math.Pi / 180
+	cos, sin := float32(math.Cos(rad)), float32(math.Sin(rad))
+	for y := 0; y < ve.Size.Y; y++ {
+		for x := 0; x < ve.Size.X; x++ {
+			dx := float32(x) + 0.5 - cx
+			dy := float32(y) + 0.5 - cy
+			u := dx*cos + dy*sin  // along the angle
+			v := -dx*sin + dy*cos // perpendicular to the angle
+			var val float32
+			switch ve.CurStim {
+			case StimBar:
+				w := ve.BarWidth * s
+				if w < 1 {
+					w = 1
+				}
+				val = coverage(abs32(u), s/2) * coverage(abs32(v), w/2)
+			case StimGabor:
+				sig := s / 4
+				env := math.Exp(-float64(dx*dx+dy*dy) / float64(2*sig*sig))
+				val = float32(env * math.Cos(2*math.Pi*float64(ve.CurFreq*u/s)+float64(ve.CurPhase)))
+			case StimDots:
+				for _, dt := range ve.dots {
+					ddx, ddy := dx-dt[0], dy-dt[1]
+					if c := coverage(float32(math.Sqrt(float64(ddx*ddx+ddy*ddy))), ve.DotSize); c > val {
+						val = c
+					}
+				}
+			case StimCircle:
+				val = coverage(float32(math.Sqrt(float64(dx*dx+dy*dy))), s/2)
+			case StimSquare:
+				val = coverage(abs32(u), s/2) * coverage(abs32(v), s/2)
+			case StimTriangle:
+				// edges are at the inradius (s/4) from the center, with outward
+				// normals opposite the vertex and at +/- 60 degrees from it
+				val = coverage(-u, s/4)
+				for _, ea := range []float64{math.Pi / 3, -math.Pi / 3} {
+					ec, es := float32(math.Cos(ea)), float32(math.Sin(ea))
+					if c := coverage(u*ec+v*es, s/4); c < val {
+						val = c
+					}
+				}
+			}
+			if ve.Noise > 0 {
+				val += ve.Noise * float32(ve.Rand.NormFloat64(-1))
+			}
+			ve.Image.Set([]int{y, x}, val)
+		}
+	}
+}
+
+// abs32 returns the absolute value
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// setLatents sets the latent factor states
+func (ve *VisualEnv) setLatents() {
+	st := ve.states["Stim"]
+	st.SetZeros()
+	st.Values[ve.CurStim] = 1
+	copy(ve.states["Pos"].Values, ve.CurPos[:])
+	ve.states["Scale"].Values[0] = ve.CurScale
+	ve.states["Angle"].Values[0] = ve.CurAngle
+	ve.states["Freq"].Values[0] = ve.CurFreq
+	ve.states["Phase"].Values[0] = ve.CurPhase
+	ve.states["Speed"].Values[0] = ve.CurSpeed
+}
+
+// Step advances to the next tick, starting a new trial with a new
+// stimulus after Ticks ticks
+func (ve *VisualEnv) Step() bool {
+	ve.Epoch.Same() // good idea to just reset all non-inner-most counters at start
+	ve.Trial.Same()
+	if ve.Tick.Cur >= 0 && ve.Tick.Cur+1 < ve.Ticks {
+		ve.Tick.Incr()
+		ve.Move()
+	} else {
+		if ve.Trial.Incr() { // if true, hit max, reset to 0
+			ve.Epoch.Incr()
+		}
+		ve.Tick.Prv = ve.Tick.Cur
+		ve.Tick.Cur = 0
+		ve.Tick.Chg = true
+		ve.NewStim()
+	}
+	ve.Render()
+	ve.setLatents()
+	return true
+}
+
+func (ve *VisualEnv) Counter(scale TimeScales) (cur, prv int, chg bool) {
+	switch scale {
+	case Run:
+		return ve.Run.Query()
+	case Epoch:
+		return ve.Epoch.Query()
+	case Trial:
+		return ve.Trial.Query()
+	case Tick:
+		return ve.Tick.Query()
+	}
+	return -1, -1, false
+}
+
+func (ve *VisualEnv) State(element string) etensor.Tensor {
+	if element == "Image" {
+		return &ve.Image
+	}
+	if st, ok := ve.states[element]; ok {
+		return st
+	}
+	return nil
+}
+
+func (ve *VisualEnv) Action(element string, input etensor.Tensor) {
+	// nop
+}
+
+// Compile-time check that implements Env interface
+var _ Env = (*VisualEnv)(nil)
+
+/////////////////////////////////////////////////////
+// EnvDesc -- optional but implemented here
+
+func (ve *VisualEnv) Counters() []TimeScales {
+	return []TimeScales{Run, Epoch, Trial, Tick}
+}
+
+func (ve *VisualEnv) States() Elements {
+	els := Elements{{Name: "Image", Shape: []int{ve.Size.Y, ve.Size.X}, DimNames: []string{"Y", "X"}}}
+	return append(els, ve.latents()...)
+}
+
+func (ve *VisualEnv) Actions() Elements {
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/etable/etensor"
+)
+
+// imgCentroid returns the centroid of the positive pixels of the image
+func imgCentroid(img etensor.Tensor) (cx, cy, sum float64) {
+	ny, nx := img.Dim(0), img.Dim(1)
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			v := img.FloatVal([]int{y, x})
+			if v > 0 {
+				cx += v * (float64(x) + .5)
+				cy += v * (float64(y) + .5)
+				sum += v
+			}
+		}
+	}
+	if sum > 0 {
+		cx /= sum
+		cy /= sum
+	}
+	return
+}
+
+func TestVisualEnv(t *testing.T) {
+	ve := &VisualEnv{Nm: "Visual"}
+	ve.Defaults()
+	ve.Size.Set(40, 32)
+	ve.Trials = 12
+	if err := ve.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ve.Init(0)
+	for i := 0; i < 24; i++ {
+		ve.Step()
+		img := ve.State("Image")
+		if img.Dim(0) != 32 || img.Dim(1) != 40 {
+			t.Fatalf("image shape: %v", img.Shapes())
+		}
+		if ve.State("Stim").FloatVal1D(int(ve.CurStim)) != 1 {
+			t.Errorf("trial %d: Stim not one-hot for %v", i, ve.CurStim)
+		}
+		if sc := ve.State("Scale").FloatVal1D(0); float32(sc) != ve.CurScale || sc < .3 || sc > .6 {
+			t.Errorf("trial %d: Scale: %g", i, sc)
+		}
+		if ve.CurStim == StimGabor || ve.CurStim == StimDots {
+			continue // not symmetric about the center
+		}
+		cx, cy, sum := imgCentroid(img)
+		if sum == 0 {
+			t.Fatalf("trial %d: %v image is empty", i, ve.CurStim)
+		}
+		px, py := ve.State("Pos").FloatVal1D(0)*40, ve.State("Pos").FloatVal1D(1)*32
+		tol := 1.0
+		if cx < px-tol || cx > px+tol || cy < py-tol || cy > py+tol {
+			t.Errorf("trial %d: %v centroid: %g, %g not near Pos: %g, %g", i, ve.CurStim, cx, cy, px, py)
+		}
+	}
+	if cur, _, _ := ve.Counter(Epoch); cur != 1 {
+		t.Errorf("Epoch: %d != 1", cur)
+	}
+
+	// same seed, same images
+	ve2 := &VisualEnv{}
+	ve2.Defaults()
+	ve2.Size.Set(40, 32)
+	ve2.Noise = .1
+	ve.Noise = .1
+	ve.Init(1)
+	ve2.Init(1)
+	for i := 0; i < 5; i++ {
+		ve.Step()
+		ve2.Step()
+		for j, v := range ve.Image.Values {
+			if ve2.Image.Values[j] != v {
+				t.Fatalf("trial %d: images differ for same seed", i)
+			}
+		}
+	}
+}
+
+func TestVisualEnvValidate(t *testing.T) {
+	ve := &VisualEnv{Stims: []StimTypes{StimGabor}, Trials: 10}
+	ve.Size.Set(8, 8)
+	if err := ve.Validate(); err == nil {
+		t.Errorf("expected error for zero Scale")
+	}
+	ve.Init(0)
+	ve.Step()
+	for _, v := range ve.Image.Values {
+		if math.IsNaN(float64(v)) {
+			t.Fatalf("zero Scale Gabor has NaN pixels")
+		}
+	}
+}
+
+func TestVisualEnvDots(t *testing.T) {
+	ve := &VisualEnv{Stims: []StimTypes{StimDots}}
+	ve.Defaults()
+	ve.Angle.Set(0, 0)
+	ve.Speed.Set(2, 2)
+	ve.Ticks = 3
+	ve.Init(0)
+	ve.Step()
+	cx0, cy0, _ := imgCentroid(&ve.Image)
+	px0 := ve.CurPos[0]
+	ve.Step()
+	ve.Step()
+	if tk, _, _ := ve.Counter(Tick); tk != 2 {
+		t.Errorf("Tick: %d != 2", tk)
+	}
+	cx, cy, _ := imgCentroid(&ve.Image)
+	if cx-cx0 < 3.5 || cx-cx0 > 4.5 || cy-cy0 < -.5 || cy-cy0 > .5 {
+		t.Errorf("dots moved: %g, %g, expected 4, 0", cx-cx0, cy-cy0)
+	}
+	if dp := (ve.CurPos[0] - px0) * 32; dp < 3.99 || dp > 4.01 {
+		t.Errorf("Pos moved: %g, expected 4", dp)
+	}
+	ve.Step()
+	if tk, _, _ := ve.Counter(Tick); tk != 0 {
+		t.Errorf("Tick: %d != 0 on new trial", tk)
+	}
+	if tr, _, _ := ve.Counter(Trial); tr != 1 {
+		t.Errorf("Trial: %d != 1", tr)
+	}
+}
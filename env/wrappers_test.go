@@ -0,0 +1,147 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+func TestMixEnv(t *testing.T) {
+	a := &FixedTable{Nm: "A", Table: testTable("A", 4), Sequential: true}
+	b := &FixedTable{Nm: "B", Table: testTable("B", 4), Sequential: true}
+	me := &MixEnv{Nm: "Mix", Envs: []Env{a, b}, Probs: []float64{8, 2}, Trials: 10, RndSeed: 1}
+	if err := me.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	me.Init(0)
+	na := 0
+	for i := 0; i < 1000; i++ {
+		me.Step()
+		if me.Cur == 0 {
+			na++
+		}
+	}
+	if na < 750 || na > 850 {
+		t.Errorf("mixture proportion of A: %d / 1000, expected ~800", na)
+	}
+	if cur, _, _ := me.Counter(Epoch); cur != 99 || me.Trial.Cur != 9 {
+		t.Errorf("counters wrong: Epoch: %d  Trial: %d", cur, me.Trial.Cur)
+	}
+
+	// steps where the chosen Env presents no trial are not counted
+	bd := &Bandit{}
+	bd.Config(0, 1)
+	me = &MixEnv{Nm: "MixRL", Envs: []Env{a, &RLEnv{Task: bd, MaxSteps: 2}}, Probs: []float64{1, 1}, Trials: 100}
+	me.Init(0)
+	npres := 0
+	for i := 0; i < 50; i++ {
+		if me.Step() {
+			npres++
+		}
+	}
+	if npres == 50 || me.Trial.Cur != npres-1 {
+		t.Errorf("Trial: %d counts steps not presented: %d", me.Trial.Cur, npres)
+	}
+}
+
+func TestConcatEnv(t *testing.T) {
+	a := &FixedTable{Nm: "A", Table: testTable("A", 3), Sequential: true}
+	b := &FixedTable{Nm: "B", Table: testTable("B", 4), Sequential: true}
+	ce := &ConcatEnv{Nm: "Concat", Envs: []Env{a, b}, Trials: []int{0, 2}}
+	if err := ce.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ce.Init(0)
+	var nms, trls []string
+	for i := 0; i < 10; i++ {
+		ce.Step()
+		nms = append(nms, ce.CurEnv().(*FixedTable).TrialName.Cur)
+		trls = append(trls, fmt.Sprint(ce.Trial.Cur))
+	}
+	if got := strings.Join(nms, " "); got != "A0 A1 A2 B0 B1 A0 A1 A2 B2 B3" {
+		t.Errorf("concat order wrong: %s", got)
+	}
+	if got := strings.Join(trls, " "); got != "0 1 2 3 4 0 1 2 3 4" || ce.Epoch.Cur != 1 {
+		t.Errorf("concat counters wrong: Trial: %s  Epoch: %d", got, ce.Epoch.Cur)
+	}
+
+	// the episode ends after 2 trials, before the 5 Trials of its segment
+	bd := &Bandit{}
+	bd.Config(0, 1)
+	ce = &ConcatEnv{Nm: "Concat", Envs: []Env{&RLEnv{Nm: "Bandit", Task: bd, MaxSteps: 2}, b}, Trials: []int{5, 1}}
+	ce.Init(0)
+	var envs []string
+	for i := 0; i < 6; i++ {
+		ce.Step()
+		envs = append(envs, ce.CurEnv().Name())
+	}
+	if got := strings.Join(envs, " "); got != "Bandit Bandit B Bandit Bandit B" {
+		t.Errorf("concat of episodic env wrong: %s", got)
+	}
+}
+
+func TestNoiseEnv(t *testing.T) {
+	ft := &FixedTable{Nm: "A", Table: testTable("A", 3), Sequential: true}
+	ne := &NoiseEnv{Env: ft, Elements: []string{"Input"}, Occlude: .5, RndSeed: 1}
+	ne.Init(0)
+	ne.Step()
+	st := ne.State("Input").(*etensor.Float32)
+	if st.Values[0]*st.Values[1] != 0 || st.Values[0]+st.Values[1] != 1 {
+		t.Errorf("occlusion of .5 of [2] should zero 1 value: %v", st.Values)
+	}
+	if ne.State("Input") != st || ne.Name() != "A" {
+		t.Errorf("State not stable within Step, or wrong Name")
+	}
+	if src := ft.State("Input").(*etensor.Float32); src.Values[0] != 1 || src.Values[1] != 1 {
+		t.Errorf("wrapped Env State was modified")
+	}
+
+	// all numeric States are modified, and string States are not
+	dt := etable.New(etable.Schema{
+		{Name: "Words", Type: etensor.STRING, CellShape: []int{2}},
+		{Name: "Input", Type: etensor.FLOAT32, CellShape: []int{2}},
+	}, 1)
+	dt.CellTensor("Words", 0).SetString1D(1, "b")
+	ne = &NoiseEnv{Env: &FixedTable{Nm: "W", Table: etable.NewIdxView(dt)}, Noise: 1, RndSeed: 1}
+	ne.Init(0)
+	ne.Step()
+	if wd, ok := ne.State("Words").(*etensor.String); !ok || wd.Values[1] != "b" {
+		t.Errorf("string State was modified: %v", ne.State("Words"))
+	}
+	if ne.State("Input").FloatVal1D(0) == 0 {
+		t.Errorf("numeric State was not modified")
+	}
+}
+
+func TestReverseEnv(t *testing.T) {
+	re := &ReverseEnv{Env: &FixedTable{Nm: "A", Table: testTable("A", 4), Sequential: true}}
+	if err := re.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	re.Init(0)
+	var vals, trls, epcs []string
+	for i := 0; i < 8; i++ {
+		re.Step()
+		vals = append(vals, fmt.Sprint(re.State("Input").FloatVal1D(0)))
+		trl, _, _ := re.Counter(Trial)
+		epc, _, chg := re.Counter(Epoch)
+		trls = append(trls, fmt.Sprint(trl))
+		epcs = append(epcs, fmt.Sprint(epc, chg))
+	}
+	if got := strings.Join(vals, " "); got != "4 3 2 1 4 3 2 1" {
+		t.Errorf("reversed states wrong: %s", got)
+	}
+	if got := strings.Join(trls, " "); got != "0 1 2 3 0 1 2 3" {
+		t.Errorf("trial counters wrong: %s", got)
+	}
+	if epcs[4] != "1 true" || epcs[5] != "1 false" {
+		t.Errorf("epoch counters wrong: %v", epcs)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package erand
+
+import "math/rand"
+
+// PosSource is a rand.Source that keeps track of its position in the
+// random number sequence, as its seed and the number of values drawn,
+// so the position can be saved and restored with SetPos, e.g., to resume
+// a run with the exact same random numbers.  Use NewPosRand to create
+// a SysRand using it.
+type PosSource struct {
+	SeedVal int64  `desc:"seed the source was last seeded with"`
+	N       uint64 `desc:"number of values drawn since seeding"`
+
+	src rand.Source64
+}
+
+// NewPosSource returns a new PosSource seeded with given seed
+func NewPosSource(seed int64) *PosSource {
+	ps := &PosSource{}
+	ps.Seed(seed)
+	return ps
+}
+
+// Seed seeds the source, resetting the number of values drawn
+func (ps *PosSource) Seed(seed int64) {
+	ps.src = rand.NewSource(seed).(rand.Source64)
+	ps.SeedVal = seed
+	ps.N = 0
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer as an int64.
+func (ps *PosSource) Int63() int64 {
+	ps.N++
+	return ps.src.Int63()
+}
+
+// Uint64 returns a pseudo-random 64-bit value as a uint64.
+func (ps *PosSource) Uint64() uint64 {
+	ps.N++
+	return ps.src.Uint64()
+}
+
+// Pos returns the position in the random number sequence:
+// the seed and number of values drawn
+func (ps *PosSource) Pos() (seed int64, n uint64) {
+	return ps.SeedVal, ps.N
+}
+
+// SetPos sets the position in the random number sequence, by seeding with
+// given seed and drawing n values
+func (ps *PosSource) SetPos(seed int64, n uint64) {
+	ps.Seed(seed)
+	for i := uint64(0); i < n; i++ {
+		ps.src.Int63()
+	}
+	ps.N = n
+}
+
+// NewPosRand sets the Rand of given SysRand to a new rand.Rand using a new
+// PosSource with given seed, and returns the PosSource, for saving the
+// position of the SysRand.
+func NewPosRand(r *SysRand, seed int64) *PosSource {
+	ps := NewPosSource(seed)
+	r.Rand = rand.New(ps)
+	return ps
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package erand
+
+import "testing"
+
+func TestPosSource(t *testing.T) {
+	var rnd SysRand
+	ps := NewPosRand(&rnd, 5)
+	rnd.Intn(10, -1)
+	rnd.NormFloat64(-1)
+	rnd.Perm(7, -1)
+	seed, n := ps.Pos()
+	var exp []float64
+	for i := 0; i < 10; i++ {
+		exp = append(exp, rnd.Float64(-1))
+	}
+
+	var rs SysRand
+	rps := NewPosRand(&rs, 1)
+	rps.SetPos(seed, n)
+	for i := 0; i < 10; i++ {
+		if v := rs.Float64(-1); v != exp[i] {
+			t.Errorf("value %d after SetPos: %g, expected %g", i, v, exp[i])
+		}
+	}
+	if _, rn := rps.Pos(); rn != n+10 {
+		t.Errorf("position after SetPos: %d, expected %d", rn, n+10)
+	}
+}
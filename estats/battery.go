@@ -0,0 +1,194 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/confusion"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+//////////////////////////////////////////////
+//  Generalization test battery
+
+// TestEnv is the subset of the env.Env interface used by TestBattery
+// (estats cannot import env) -- any env.Env can be used directly.
+type TestEnv interface {
+	// Name returns a name for the environment
+	Name() string
+
+	// Init initializes the environment for a given run
+	Init(run int)
+}
+
+// TestSet is one named test set in a TestBattery, with the statistics
+// accumulated over its trials on the last run of the battery.
+type TestSet struct {
+	Name      string           `desc:"name of the test set, e.g., Novel, Interp -- used to label results"`
+	Env       TestEnv          `desc:"environment presenting the test items"`
+	N         int              `inactive:"+" desc:"number of trials recorded"`
+	ErrSums   []float64        `inactive:"+" desc:"sums of the TestBattery.ErrStats values over trials"`
+	NCorrect  int              `inactive:"+" desc:"number of trials where the closest pattern matched the target"`
+	Confusion confusion.Matrix `view:"no-inline" desc:"confusion matrix of target vs. closest pattern, if TestBattery.Labels are set"`
+}
+
+// Reset resets the accumulated statistics, for given number of error stats
+// and confusion labels
+func (ts *TestSet) Reset(nerr int, lbls []string) {
+	ts.N = 0
+	ts.NCorrect = 0
+	ts.ErrSums = make([]float64, nerr)
+	if len(lbls) > 0 {
+		ts.Confusion.Init(len(lbls))
+		ts.Confusion.SetLabels(lbls)
+	}
+}
+
+// ErrMean returns the mean of the given error stat (index into ErrStats)
+func (ts *TestSet) ErrMean(idx int) float64 {
+	if ts.N == 0 {
+		return 0
+	}
+	return ts.ErrSums[idx] / float64(ts.N)
+}
+
+// PctCor returns the proportion of trials where the closest pattern
+// matched the target
+func (ts *TestSet) PctCor() float64 {
+	if ts.N == 0 {
+		return 0
+	}
+	return float64(ts.NCorrect) / float64(ts.N)
+}
+
+// TestBattery runs the Test stack over each of a set of named test
+// environments (e.g., held-out items, novel combinations, interpolations),
+// collecting per-set error stats, ClosestPat accuracy and confusion
+// matrices, and writing a comparison table with one row per set.
+// RunFunc must run the Test stack on the given env, and the sim must call
+// RecordTrial at the end of each test trial (when Running is true),
+// after computing the trial stats.
+type TestBattery struct {
+	Sets        []*TestSet       `desc:"the test sets, in order"`
+	ErrStats    []string         `desc:"names of Float stats recorded on each trial, averaged per set, e.g., TrlErr, TrlSSE"`
+	TargetStat  string           `desc:"name of String stat with the correct pattern or category name on each trial, e.g., TrlName"`
+	ClosestStat string           `desc:"name of String stat with the name of the closest pattern from ClosestPat on each trial, e.g., TrlClosest -- trial is correct if it matches TargetStat"`
+	Labels      []string         `desc:"if set, the labels of the target and closest names for the confusion matrices -- names not in the list are not counted"`
+	RunFunc     func(ev TestEnv) `view:"-" desc:"runs the Test stack over given env, e.g., by making it the current Test env and calling Loops.ResetAndRun(etime.Test)"`
+	Table       *etable.Table    `view:"no-inline" desc:"comparison table with one row per set: Set, N, each of ErrStats, PctCor"`
+	Running     bool             `inactive:"+" desc:"true while the battery is running -- test trials are only recorded when true"`
+	Cur         *TestSet         `view:"-" desc:"the set currently being run"`
+	lblIdx      map[string]int   // index of each label
+}
+
+// AddSet adds a new test set with given name and environment
+func (tb *TestBattery) AddSet(name string, ev TestEnv) *TestSet {
+	ts := &TestSet{Name: name, Env: ev}
+	tb.Sets = append(tb.Sets, ts)
+	return ts
+}
+
+// SetByName returns the test set of given name, nil if not found
+func (tb *TestBattery) SetByName(name string) *TestSet {
+	for _, ts := range tb.Sets {
+		if ts.Name == name {
+			return ts
+		}
+	}
+	return nil
+}
+
+// Run runs the battery: for each set, initializes its env for given run,
+// calls RunFunc on it, and records the results in Table and in given
+// Stats (if non-nil) as Float stats: set_errstat (for each of ErrStats),
+// set_PctCor.
+func (tb *TestBattery) Run(st *Stats, run int) error {
+	if tb.RunFunc == nil {
+		return fmt.Errorf("estats.TestBattery: RunFunc must be set")
+	}
+	tb.lblIdx = make(map[string]int, len(tb.Labels))
+	for i, l := range tb.Labels {
+		tb.lblIdx[l] = i
+	}
+	tb.Running = true
+	for _, ts := range tb.Sets {
+		ts.Reset(len(tb.ErrStats), tb.Labels)
+		tb.Cur = ts
+		ts.Env.Init(run)
+		tb.RunFunc(ts.Env)
+		if len(tb.Labels) > 0 {
+			ts.Confusion.Probs()
+		}
+	}
+	tb.Running = false
+	tb.Cur = nil
+	tb.ConfigTable()
+	for ri, ts := range tb.Sets {
+		tb.Table.SetCellString("Set", ri, ts.Name)
+		tb.Table.SetCellFloat("N", ri, float64(ts.N))
+		for ei, es := range tb.ErrStats {
+			tb.Table.SetCellFloat(es, ri, ts.ErrMean(ei))
+			if st != nil {
+				st.SetFloat(ts.Name+"_"+es, ts.ErrMean(ei))
+			}
+		}
+		tb.Table.SetCellFloat("PctCor", ri, ts.PctCor())
+		if st != nil {
+			st.SetFloat(ts.Name+"_PctCor", ts.PctCor())
+		}
+	}
+	return nil
+}
+
+// RecordTrial records the trial stats from given Stats for the set
+// currently being run: the ErrStats values, and whether the ClosestStat
+// name matches the TargetStat name.  Does nothing if not Running,
+// so it can be called at the end of every test trial.
+func (tb *TestBattery) RecordTrial(st *Stats) {
+	if !tb.Running || tb.Cur == nil {
+		return
+	}
+	ts := tb.Cur
+	ts.N++
+	for ei, es := range tb.ErrStats {
+		ts.ErrSums[ei] += st.Float(es)
+	}
+	if tb.TargetStat == "" || tb.ClosestStat == "" {
+		return
+	}
+	trg := st.String(tb.TargetStat)
+	cls := st.String(tb.ClosestStat)
+	if trg == cls {
+		ts.NCorrect++
+	}
+	if len(tb.Labels) == 0 {
+		return
+	}
+	ti, thas := tb.lblIdx[trg]
+	ci, chas := tb.lblIdx[cls]
+	if thas && chas {
+		ts.Confusion.Incr(ti, ci)
+	}
+}
+
+// ConfigTable configures the comparison Table for the current sets
+func (tb *TestBattery) ConfigTable() {
+	if tb.Table == nil {
+		tb.Table = &etable.Table{}
+	}
+	sch := etable.Schema{
+		{Name: "Set", Type: etensor.STRING},
+		{Name: "N", Type: etensor.INT64},
+	}
+	for _, es := range tb.ErrStats {
+		sch = append(sch, etable.Column{Name: es, Type: etensor.FLOAT64})
+	}
+	sch = append(sch, etable.Column{Name: "PctCor", Type: etensor.FLOAT64})
+	tb.Table.SetFromSchema(sch, len(tb.Sets))
+	tb.Table.SetMetaData("name", "TestBattery")
+	tb.Table.SetMetaData("desc", "comparison of test set results")
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+//////////////////////////////////////////////
+//  Bootstrap confidence intervals
+
+// BootCI is a bootstrap confidence interval for a statistic
+type BootCI struct {
+	Stat  float64 `desc:"value of the statistic on the original data"`
+	N     int     `desc:"number of data values"`
+	Lo    float64 `desc:"lower bound of the percentile interval"`
+	Hi    float64 `desc:"upper bound of the percentile interval"`
+	BCaLo float64 `desc:"lower bound of the bias-corrected and accelerated (BCa) interval"`
+	BCaHi float64 `desc:"upper bound of the bias-corrected and accelerated (BCa) interval"`
+}
+
+// Bootstrap computes percentile and BCa (bias-corrected and accelerated,
+// Efron, 1987) confidence intervals for given statistic function
+// (e.g., BootMean) on given values, using nboot bootstrap resamples,
+// for given confidence level (e.g., .95), using given random number source
+// (nil = global) -- use a separate seeded source for reproducible results.
+// NaN values are excluded.  Returns NaN intervals if no values.
+func Bootstrap(vals []float64, stat func(vals []float64) float64, nboot int, ci float64, rnd erand.Rand) BootCI {
+	if rnd == nil {
+		rnd = erand.NewGlobalRand()
+	}
+	vs := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			vs = append(vs, v)
+		}
+	}
+	n := len(vs)
+	bc := BootCI{N: n, Stat: math.NaN(), Lo: math.NaN(), Hi: math.NaN(), BCaLo: math.NaN(), BCaHi: math.NaN()}
+	if n == 0 || nboot < 1 {
+		return bc
+	}
+	bc.Stat = stat(vs)
+
+	bs := make([]float64, nboot)
+	rs := make([]float64, n)
+	nless := 0.0
+	for bi := range bs {
+		for i := range rs {
+			rs[i] = vs[rnd.Intn(n, -1)]
+		}
+		bs[bi] = stat(rs)
+		switch {
+		case bs[bi] < bc.Stat:
+			nless++
+		case bs[bi] == bc.Stat:
+			nless += 0.5
+		}
+	}
+	sort.Float64s(bs)
+	alpha := (1 - ci) / 2
+	bc.Lo = sortedQuantile(bs, alpha)
+	bc.Hi = sortedQuantile(bs, 1-alpha)
+
+	// bias correction
+	z0 := normInv(clampProb(nless/float64(nboot), nboot))
+	// acceleration from jackknife
+	jk := make([]float64, n)
+	rs = rs[:n-1]
+	var jmean float64
+	for i := range jk {
+		copy(rs, vs[:i])
+		copy(rs[i:], vs[i+1:])
+		jk[i] = stat(rs)
+		jmean += jk[i]
+	}
+	jmean /= float64(n)
+	var num, den float64
+	for _, j := range jk {
+		d := jmean - j
+		num += d * d * d
+		den += d * d
+	}
+	acc := 0.0
+	if den > 0 {
+		acc = num / (6 * math.Pow(den, 1.5))
+	}
+	bca := func(a float64) float64 {
+		z := normInv(a)
+		return normCDF(z0 + (z0+z)/(1-acc*(z0+z)))
+	}
+	bc.BCaLo = sortedQuantile(bs, bca(alpha))
+	bc.BCaHi = sortedQuantile(bs, bca(1-alpha))
+	return bc
+}
+
+// BootMean is the mean statistic for Bootstrap
+func BootMean(vals []float64) float64 {
+	var sum float64
+	for _, v := range vals {
+		sum += v
+	}
+	return sum / float64(len(vals))
+}
+
+// BootstrapCol computes Bootstrap intervals for the mean of given
+// scalar column in given table (IdxView) -- see Bootstrap for args.
+func BootstrapCol(ix *etable.IdxView, colNm string, nboot int, ci float64, rnd erand.Rand) (BootCI, error) {
+	vals, err := idxViewVals(ix, colNm)
+	if err != nil {
+		return BootCI{}, err
+	}
+	return Bootstrap(vals, BootMean, nboot, ci, rnd), nil
+}
+
+// BootstrapStats computes Bootstrap intervals for the mean of given
+// scalar column in given table (IdxView), recording Float stats as:
+// name_Mean, name_CILo, name_CIHi, name_BCaLo, name_BCaHi
+// See Bootstrap for other args.
+func (st *Stats) BootstrapStats(name string, ix *etable.IdxView, colNm string, nboot int, ci float64, rnd erand.Rand) error {
+	bc, err := BootstrapCol(ix, colNm, nboot, ci, rnd)
+	if err != nil {
+		return err
+	}
+	st.SetFloat(name+"_Mean", bc.Stat)
+	st.SetFloat(name+"_CILo", bc.Lo)
+	st.SetFloat(name+"_CIHi", bc.Hi)
+	st.SetFloat(name+"_BCaLo", bc.BCaLo)
+	st.SetFloat(name+"_BCaHi", bc.BCaHi)
+	return nil
+}
+
+// BootstrapSplits computes Bootstrap intervals for the mean of given
+// scalar column within each split of given Splits (e.g., from split.GroupBy
+// on a condition column), writing the results to table dt, with one row
+// per split, and columns for the split level values (from Levels), and:
+// N, Mean, CILo, CIHi, CIHalf, BCaLo, BCaHi
+// where CIHalf is the half-width of the percentile interval, (CIHi - CILo) / 2,
+// which is used as the ErrCol for plotting error bars on the Mean.
+// See Bootstrap for other args.
+func BootstrapSplits(dt *etable.Table, spl *etable.Splits, colNm string, nboot int, ci float64, rnd erand.Rand) error {
+	sch := etable.Schema{}
+	for _, lv := range spl.Levels {
+		sch = append(sch, etable.Column{Name: lv, Type: etensor.STRING})
+	}
+	sch = append(sch, etable.Column{Name: "N", Type: etensor.INT64})
+	for _, cn := range []string{"Mean", "CILo", "CIHi", "CIHalf", "BCaLo", "BCaHi"} {
+		sch = append(sch, etable.Column{Name: cn, Type: etensor.FLOAT64})
+	}
+	dt.SetFromSchema(sch, len(spl.Splits))
+	dt.SetMetaData("name", "Bootstrap_"+colNm)
+	dt.SetMetaData("desc", fmt.Sprintf("Bootstrap %g confidence intervals of mean %s", ci, colNm))
+	dt.SetMetaData("Mean:ErrCol", "CIHalf")
+	for si, six := range spl.Splits {
+		bc, err := BootstrapCol(six, colNm, nboot, ci, rnd)
+		if err != nil {
+			return err
+		}
+		for li, lv := range spl.Levels {
+			if si < len(spl.Values) && li < len(spl.Values[si]) {
+				dt.SetCellString(lv, si, spl.Values[si][li])
+			}
+		}
+		dt.SetCellFloat("N", si, float64(bc.N))
+		dt.SetCellFloat("Mean", si, bc.Stat)
+		dt.SetCellFloat("CILo", si, bc.Lo)
+		dt.SetCellFloat("CIHi", si, bc.Hi)
+		dt.SetCellFloat("CIHalf", si, (bc.Hi-bc.Lo)/2)
+		dt.SetCellFloat("BCaLo", si, bc.BCaLo)
+		dt.SetCellFloat("BCaHi", si, bc.BCaHi)
+	}
+	return nil
+}
+
+//////////////////////////////////////////////
+//  Paired permutation tests
+
+// PairedPermTest returns the mean difference a - b between paired values,
+// and the two-tailed p value for it being different from 0, from a
+// permutation test with nperm random sign flips of the differences, using
+// given random number source (nil = global).  Pairs with a NaN are excluded.
+// The p value counts the observed difference as one of the permutations.
+func PairedPermTest(a, b []float64, nperm int, rnd erand.Rand) (diff, p float64) {
+	if rnd == nil {
+		rnd = erand.NewGlobalRand()
+	}
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	ds := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		ds = append(ds, a[i]-b[i])
+	}
+	if len(ds) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	diff = BootMean(ds)
+	obs := math.Abs(diff)
+	nge := 1
+	for pi := 0; pi < nperm; pi++ {
+		var sum float64
+		for _, d := range ds {
+			if rnd.Intn(2, -1) == 0 {
+				sum += d
+			} else {
+				sum -= d
+			}
+		}
+		if math.Abs(sum/float64(len(ds))) >= obs-1e-12 {
+			nge++
+		}
+	}
+	p = float64(nge) / float64(nperm+1)
+	return
+}
+
+// PairedPermTestCol does a PairedPermTest on the values of given scalar
+// column, between rows with condition column condCol = condA vs. condB,
+// paired by having the same value in pairCol (e.g., "Run" when comparing
+// two models across runs).  Rows without a pair are ignored.
+// Returns the mean difference A - B and the p value.
+func PairedPermTestCol(ix *etable.IdxView, colNm, condCol, condA, condB, pairCol string, nperm int, rnd erand.Rand) (diff, p float64, err error) {
+	dt := ix.Table
+	var vc, cc, pc etensor.Tensor
+	if vc, err = dt.ColByNameTry(colNm); err != nil {
+		return
+	}
+	if cc, err = dt.ColByNameTry(condCol); err != nil {
+		return
+	}
+	if pc, err = dt.ColByNameTry(pairCol); err != nil {
+		return
+	}
+	avals := make(map[string]float64)
+	bvals := make(map[string]float64)
+	for _, ri := range ix.Idxs {
+		switch cc.StringVal1D(ri) {
+		case condA:
+			avals[pc.StringVal1D(ri)] = vc.FloatVal1D(ri)
+		case condB:
+			bvals[pc.StringVal1D(ri)] = vc.FloatVal1D(ri)
+		}
+	}
+	keys := make([]string, 0, len(avals))
+	for k := range avals {
+		if _, has := bvals[k]; has {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		err = fmt.Errorf("estats.PairedPermTestCol: no pairs of %s = %s and %s matched on %s", condCol, condA, condB, pairCol)
+		return
+	}
+	sort.Strings(keys) // reproducible order
+	a := make([]float64, len(keys))
+	b := make([]float64, len(keys))
+	for i, k := range keys {
+		a[i] = avals[k]
+		b[i] = bvals[k]
+	}
+	diff, p = PairedPermTest(a, b, nperm, rnd)
+	return
+}
+
+// idxViewVals returns the values of given scalar column in given IdxView
+func idxViewVals(ix *etable.IdxView, colNm string) ([]float64, error) {
+	col, err := ix.Table.ColByNameTry(colNm)
+	if err != nil {
+		return nil, err
+	}
+	if col.NumDims() > 1 {
+		return nil, fmt.Errorf("estats: column %s is not a scalar column: shape: %v", colNm, col.Shapes())
+	}
+	vals := make([]float64, ix.Len())
+	for i, ri := range ix.Idxs {
+		if col.IsNull1D(ri) {
+			vals[i] = math.NaN()
+			continue
+		}
+		vals[i] = col.FloatVal1D(ri)
+	}
+	return vals, nil
+}
+
+// sortedQuantile returns quantile q (0-1) of given sorted values,
+// using linear interpolation.
+func sortedQuantile(vals []float64, q float64) float64 {
+	n := len(vals)
+	if n == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	qi := q * float64(n-1)
+	lw := math.Floor(qi)
+	li := int(lw)
+	switch {
+	case li >= n-1:
+		return vals[n-1]
+	case li < 0:
+		return vals[0]
+	}
+	phi := qi - lw
+	return (1-phi)*vals[li] + phi*vals[li+1]
+}
+
+// clampProb keeps proportion p within (0, 1), by half of 1/n
+func clampProb(p float64, n int) float64 {
+	lim := 0.5 / float64(n)
+	return math.Min(math.Max(p, lim), 1-lim)
+}
+
+// normCDF is the standard normal cumulative distribution function
+func normCDF(z float64) float64 {
+	return 0.5 * (1 + math.Erf(z/math.Sqrt2))
+}
+
+// normInv is the inverse of the standard normal cumulative distribution function
+func normInv(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+//////////////////////////////////////////////
+//  CKA and SVCCA representational comparison
+
+// RepSimStats computes representational similarity statistics between
+// two activation matrices a and b, with one row per trial (in the same
+// order for both), and units as columns (which can differ in number).
+// Records Float stats as:
+// name_CKA: linear centered kernel alignment (CKA)
+// name_CKARBF: RBF kernel CKA, with kernel width sigma times the median
+// distance between rows (only if sigma > 0 -- 0.8 is typical)
+// name_SVCCA: SVCCA, keeping the singular vectors that explain varThr
+// proportion of variance (only if varThr > 0 -- .99 is typical)
+func (st *Stats) RepSimStats(name string, a, b *etensor.Float64, sigma, varThr float64) error {
+	if a.Dim(0) != b.Dim(0) {
+		return fmt.Errorf("estats.RepSimStats: %s: number of rows differ: %d vs. %d", name, a.Dim(0), b.Dim(0))
+	}
+	am := TensorMatrix(a)
+	bm := TensorMatrix(b)
+	st.SetFloat(name+"_CKA", LinearCKA(am, bm))
+	if sigma > 0 {
+		st.SetFloat(name+"_CKARBF", RBFCKA(am, bm, sigma))
+	}
+	if varThr > 0 {
+		st.SetFloat(name+"_SVCCA", SVCCA(am, bm, varThr))
+	}
+	return nil
+}
+
+// LayerRepSimStats computes RepSimStats between two layers, from columns
+// named "layer_var" in given log table (IdxView), e.g., as created by
+// elog.AddLayerTensorItems, recording stats named layA_layB_CKA etc.
+// See RepSimStats for sigma and varThr.
+func (st *Stats) LayerRepSimStats(ix *etable.IdxView, varNm, layA, layB string, sigma, varThr float64) error {
+	a, err := IdxViewMatrix(ix, layA+"_"+varNm, st.F64Tensor(layA+"_RepSim"))
+	if err != nil {
+		return err
+	}
+	b, err := IdxViewMatrix(ix, layB+"_"+varNm, st.F64Tensor(layB+"_RepSim"))
+	if err != nil {
+		return err
+	}
+	return st.RepSimStats(layA+"_"+layB, a, b, sigma, varThr)
+}
+
+// LayerRepSimPrev computes RepSimStats between the current activations
+// of a layer, from column "layer_var" in given log table (IdxView),
+// and those saved on the previous call (e.g., the previous epoch),
+// recording stats named layer_Prev_CKA etc, and then saves the current
+// activations for the next call, in F64Tensors as layer_RepPrev.
+// Nothing is recorded on the first call.  The rows of the log
+// must be in the same trial order each time, e.g., a Test log.
+// See RepSimStats for sigma and varThr.
+func (st *Stats) LayerRepSimPrev(ix *etable.IdxView, varNm, lnm string, sigma, varThr float64) error {
+	cur, err := IdxViewMatrix(ix, lnm+"_"+varNm, st.F64Tensor(lnm+"_RepSim"))
+	if err != nil {
+		return err
+	}
+	prv := st.F64Tensor(lnm + "_RepPrev")
+	if prv.Len() > 0 {
+		if err := st.RepSimStats(lnm+"_Prev", cur, prv, sigma, varThr); err != nil {
+			return err
+		}
+	}
+	prv.CopyShapeFrom(cur)
+	copy(prv.Values, cur.Values)
+	return nil
+}
+
+// IdxViewMatrix copies the values of given tensor column in given log
+// table (IdxView) into given 2D float64 tensor, with one row per row
+// of the IdxView, and the cell values flattened as columns.
+// The tensor is returned for convenience.
+func IdxViewMatrix(ix *etable.IdxView, colNm string, tsr *etensor.Float64) (*etensor.Float64, error) {
+	col, err := ix.Table.ColByNameTry(colNm)
+	if err != nil {
+		return nil, err
+	}
+	rows := ix.Len()
+	if rows == 0 || col.Dim(0) == 0 {
+		return nil, fmt.Errorf("estats.IdxViewMatrix: no rows in column: %s", colNm)
+	}
+	csz := col.Len() / col.Dim(0)
+	tsr.SetShape([]int{rows, csz}, nil, []string{"Row", "Unit"})
+	for r := 0; r < rows; r++ {
+		st := ix.Idxs[r] * csz
+		for i := 0; i < csz; i++ {
+			tsr.Values[r*csz+i] = col.FloatVal1D(st + i)
+		}
+	}
+	return tsr, nil
+}
+
+// TensorMatrix returns a gonum matrix view of given tensor, with the
+// outer-most dimension as rows and all the others flattened as columns.
+// The values are shared, not copied.
+func TensorMatrix(tsr *etensor.Float64) *mat.Dense {
+	rows := tsr.Dim(0)
+	return mat.NewDense(rows, tsr.Len()/rows, tsr.Values)
+}
+
+// centerCols returns a copy of given matrix with the mean of each column subtracted
+func centerCols(m *mat.Dense) *mat.Dense {
+	rows, cols := m.Dims()
+	c := mat.DenseCopyOf(m)
+	for j := 0; j < cols; j++ {
+		var sum float64
+		for i := 0; i < rows; i++ {
+			sum += c.At(i, j)
+		}
+		mean := sum / float64(rows)
+		for i := 0; i < rows; i++ {
+			c.Set(i, j, c.At(i, j)-mean)
+		}
+	}
+	return c
+}
+
+// centerGram centers given square Gram (kernel) matrix in place,
+// subtracting row and column means and adding the grand mean,
+// i.e., H K H with centering matrix H.
+func centerGram(k *mat.Dense) {
+	n, _ := k.Dims()
+	rmean := make([]float64, n)
+	var gmean float64
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			rmean[i] += k.At(i, j)
+		}
+		gmean += rmean[i]
+		rmean[i] /= float64(n)
+	}
+	gmean /= float64(n * n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ { // symmetric so col mean = row mean
+			k.Set(i, j, k.At(i, j)-rmean[i]-rmean[j]+gmean)
+		}
+	}
+}
+
+// gramCKA returns the CKA between two centered Gram matrices:
+// <K,L> / (||K|| ||L||), using Frobenius inner products.
+func gramCKA(k, l *mat.Dense) float64 {
+	kl := floats.Dot(k.RawMatrix().Data, l.RawMatrix().Data)
+	kk := floats.Dot(k.RawMatrix().Data, k.RawMatrix().Data)
+	ll := floats.Dot(l.RawMatrix().Data, l.RawMatrix().Data)
+	den := math.Sqrt(kk * ll)
+	if den == 0 {
+		return math.NaN()
+	}
+	return kl / den
+}
+
+// LinearCKA returns the linear centered kernel alignment (CKA) between
+// two activation matrices with one row per trial (Kornblith et al, 2019).
+// It is invariant to orthogonal transforms and isotropic scaling of the
+// units, and the number of units can differ.
+// Returns NaN if either matrix has no variance.
+func LinearCKA(a, b *mat.Dense) float64 {
+	ac := centerCols(a)
+	bc := centerCols(b)
+	var k, l mat.Dense
+	k.Mul(ac, ac.T())
+	l.Mul(bc, bc.T())
+	return gramCKA(&k, &l)
+}
+
+// RBFCKA returns the CKA between two activation matrices with one row
+// per trial, using a Gaussian RBF kernel with width sigma times the
+// median distance between rows (0.8 is typical), which is sensitive to
+// local, nonlinear structure.  Returns NaN if either matrix has no variance.
+func RBFCKA(a, b *mat.Dense, sigma float64) float64 {
+	k := rbfGram(a, sigma)
+	l := rbfGram(b, sigma)
+	centerGram(k)
+	centerGram(l)
+	return gramCKA(k, l)
+}
+
+// rbfGram returns the RBF kernel Gram matrix for rows of given matrix
+func rbfGram(m *mat.Dense, sigma float64) *mat.Dense {
+	n, _ := m.Dims()
+	d := mat.NewDense(n, n, nil)
+	dists := make([]float64, 0, n*(n-1)/2)
+	for i := 0; i < n; i++ {
+		ri := m.RawRowView(i)
+		for j := i + 1; j < n; j++ {
+			rj := m.RawRowView(j)
+			var ss float64
+			for u := range ri {
+				df := ri[u] - rj[u]
+				ss += df * df
+			}
+			d.Set(i, j, ss)
+			d.Set(j, i, ss)
+			dists = append(dists, ss)
+		}
+	}
+	var med float64
+	if len(dists) > 0 {
+		sort.Float64s(dists)
+		med = dists[len(dists)/2]
+	}
+	wd := sigma * sigma * med // (sigma * median dist)^2
+	k := mat.NewDense(n, n, nil)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if wd == 0 {
+				k.Set(i, j, 1)
+				continue
+			}
+			k.Set(i, j, math.Exp(-d.At(i, j)/(2*wd)))
+		}
+	}
+	return k
+}
+
+// SVCCA returns the mean canonical correlation between two activation
+// matrices with one row per trial, after first reducing each to the
+// top singular vectors that explain varThr proportion of variance
+// (.99 is typical), per Raghu et al, 2017.
+// Returns NaN if either matrix has no variance.
+func SVCCA(a, b *mat.Dense, varThr float64) float64 {
+	ua := svccaBasis(a, varThr)
+	ub := svccaBasis(b, varThr)
+	if ua == nil || ub == nil {
+		return math.NaN()
+	}
+	// canonical correlations are the singular values of Ua^T Ub
+	var m mat.Dense
+	m.Mul(ua.T(), ub)
+	var svd mat.SVD
+	if !svd.Factorize(&m, mat.SVDNone) {
+		return math.NaN()
+	}
+	cc := svd.Values(nil)
+	if len(cc) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, v := range cc {
+		sum += math.Min(v, 1)
+	}
+	return sum / float64(len(cc))
+}
+
+// svccaBasis returns an orthonormal basis for the column-centered rows of given
+// matrix, keeping the top left singular vectors that explain varThr of variance.
+func svccaBasis(m *mat.Dense, varThr float64) *mat.Dense {
+	mc := centerCols(m)
+	var svd mat.SVD
+	if !svd.Factorize(mc, mat.SVDThin) {
+		return nil
+	}
+	vals := svd.Values(nil)
+	var tot float64
+	for _, v := range vals {
+		tot += v * v
+	}
+	if tot == 0 {
+		return nil
+	}
+	k := len(vals)
+	var cum float64
+	for i, v := range vals {
+		cum += v * v
+		if cum/tot >= varThr {
+			k = i + 1
+			break
+		}
+	}
+	var u mat.Dense
+	svd.UTo(&u)
+	rows, _ := u.Dims()
+	return mat.DenseCopyOf(u.Slice(0, rows, 0, k))
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/metric"
+)
+
+//////////////////////////////////////////////
+//  Dimensionality
+
+// DimParams are parameters for DimStats
+type DimParams struct {
+	VarThr    float64 `def:"0.9" desc:"proportion of total variance that must be explained by the principal components counted in the NVar stat"`
+	TwoNNFrac float64 `def:"0.9" desc:"proportion of points used in the TwoNN fit, discarding those with the largest nearest-neighbor distance ratios, which are most affected by noise"`
+}
+
+// Defaults sets default parameters
+func (dp *DimParams) Defaults() {
+	dp.VarThr = 0.9
+	dp.TwoNNFrac = 0.9
+}
+
+// DimStats computes dimensionality statistics on recorded activation
+// patterns in given log table (IdxView), for given list of layer names
+// and variable name -- columns named "layer_var", as in PCAStats.
+// Uses given parameters, with defaults if nil.
+// Records Float stats as:
+// layer_Dim_PR: participation ratio of the eigenvalues of the covariance
+// matrix, (Σλ)² / Σλ², a continuous measure of the number of dimensions
+// layer_Dim_NVar: number of principal components needed to explain
+// DimParams.VarThr of the total variance
+// layer_Dim_TwoNN: intrinsic dimensionality estimated by the TwoNN method
+// (Facco et al., 2017), from ratios of distances to the two nearest neighbors
+func (st *Stats) DimStats(ix *etable.IdxView, varNm string, layers []string, dp *DimParams) error {
+	if dp == nil {
+		dp = &DimParams{}
+		dp.Defaults()
+	}
+	svd := &st.SVD
+	for _, lnm := range layers {
+		colNm := lnm + "_" + varNm
+		if err := svd.TableCol(ix, colNm, metric.Covariance64); err != nil {
+			return fmt.Errorf("estats.DimStats: layer %s: %w", lnm, err)
+		}
+		st.SetFloat(lnm+"_Dim_PR", ParticipationRatio(svd.Values))
+		st.SetFloat(lnm+"_Dim_NVar", float64(NCompsVar(svd.Values, dp.VarThr)))
+		mat, err := IdxViewMatrix(ix, colNm, st.F64Tensor(lnm+"_Dim"))
+		if err != nil {
+			return err
+		}
+		st.SetFloat(lnm+"_Dim_TwoNN", TwoNN(mat, dp.TwoNNFrac))
+	}
+	return nil
+}
+
+// ParticipationRatio returns the participation ratio of given eigenvalues:
+// (Σλ)² / Σλ², which is the number of dimensions if variance is equal
+// across them.  Returns 0 if all are 0.
+func ParticipationRatio(eigs []float64) float64 {
+	var sum, ssq float64
+	for _, v := range eigs {
+		sum += v
+		ssq += v * v
+	}
+	if ssq == 0 {
+		return 0
+	}
+	return sum * sum / ssq
+}
+
+// NCompsVar returns the number of components, from the start of given
+// eigenvalues sorted in descending order, needed to explain at least
+// varThr proportion (0-1) of the total variance.  Returns 0 if all are 0.
+func NCompsVar(eigs []float64, varThr float64) int {
+	var tot float64
+	for _, v := range eigs {
+		tot += v
+	}
+	if tot == 0 {
+		return 0
+	}
+	var cum float64
+	for i, v := range eigs {
+		cum += v
+		if cum/tot >= varThr {
+			return i + 1
+		}
+	}
+	return len(eigs)
+}
+
+// TwoNN returns the intrinsic dimensionality of the points in the rows
+// of given 2D tensor (flattening inner dimensions), estimated by the TwoNN
+// method (Facco et al., 2017): the ratios μ = r2 / r1 of distances to the
+// second and first nearest neighbors follow a Pareto distribution with
+// exponent d, fit by linear regression through the origin of -log(1-F(μ))
+// on log(μ), using the smallest frac proportion of μ values.
+// Points with duplicates (r1 = 0) are skipped.
+// Returns NaN if there are fewer than 3 usable points.
+func TwoNN(tsr etensor.Tensor, frac float64) float64 {
+	n := tsr.Dim(0)
+	if n < 3 {
+		return math.NaN()
+	}
+	sz := tsr.Len() / n
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = make([]float64, sz)
+		for j := range rows[i] {
+			rows[i][j] = tsr.FloatVal1D(i*sz + j)
+		}
+	}
+	mus := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		r1, r2 := math.Inf(1), math.Inf(1)
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			d := metric.Euclidean64(rows[i], rows[j])
+			switch {
+			case d < r1:
+				r2 = r1
+				r1 = d
+			case d < r2:
+				r2 = d
+			}
+		}
+		if r1 == 0 || math.IsInf(r2, 1) {
+			continue
+		}
+		mus = append(mus, r2/r1)
+	}
+	nm := len(mus)
+	if nm < 3 {
+		return math.NaN()
+	}
+	sort.Float64s(mus)
+	nfit := int(math.Round(frac * float64(nm)))
+	if nfit < 2 {
+		nfit = 2
+	}
+	if nfit > nm {
+		nfit = nm
+	}
+	var sxy, sxx float64
+	for i := 0; i < nfit; i++ {
+		f := float64(i+1) / float64(nm+1) // empirical cdf, avoiding F = 1
+		x := math.Log(mus[i])
+		y := -math.Log(1 - f)
+		sxy += x * y
+		sxx += x * x
+	}
+	if sxx == 0 {
+		return math.NaN()
+	}
+	return sxy / sxx
+}
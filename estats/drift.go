@@ -0,0 +1,208 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/metric"
+)
+
+//////////////////////////////////////////////
+//  Representational drift
+
+// DriftSnap is a snapshot of the trial-averaged activity patterns
+// of a layer, with one row per unique trial name.
+type DriftSnap struct {
+	Epoch int              `desc:"epoch when snapshot was taken"`
+	Names []string         `desc:"sorted unique trial names, one per row of Pats"`
+	Pats  *etensor.Float64 `desc:"trial-averaged activity patterns: [Names][Units]"`
+}
+
+// Row returns the pattern row for given trial name, false if not found
+func (ds *DriftSnap) Row(name string) ([]float64, bool) {
+	i := sort.SearchStrings(ds.Names, name)
+	if i >= len(ds.Names) || ds.Names[i] != name {
+		return nil, false
+	}
+	nu := ds.Pats.Dim(1)
+	return ds.Pats.Values[i*nu : (i+1)*nu], true
+}
+
+// Drift holds the first and previous DriftSnap snapshots for a layer,
+// for computing representational drift over learning.
+type Drift struct {
+	First *DriftSnap `desc:"first snapshot taken"`
+	Prev  *DriftSnap `desc:"most recent snapshot"`
+}
+
+// DriftStats takes a snapshot of the trial-averaged activity patterns
+// of each of given layers, from columns named "layer_var" in given log
+// table (IdxView), grouped by the trial name in nameCol (as in ClosestPat),
+// if epoch % interval == 0 (or interval <= 1), returning true if so.
+// It then records Float stats comparing the new snapshot with the
+// previous and first ones, using the trial names in common:
+// layer_Drift_Prev: mean correlation of patterns with previous snapshot
+// layer_Drift_First: mean correlation of patterns with first snapshot
+// layer_Drift_PrefChg: proportion of units whose preferred trial name
+// (with maximum activity) changed since the previous snapshot.
+// Stats are 1, 1, 0 for the first snapshot.  Snapshots are kept in
+// Drifts by layer name, and ResetDrift starts over (e.g., each run).
+func (st *Stats) DriftStats(ix *etable.IdxView, varNm, nameCol string, layers []string, epoch, interval int) (bool, error) {
+	if interval > 1 && epoch%interval != 0 {
+		return false, nil
+	}
+	for _, lnm := range layers {
+		ds, err := NewDriftSnap(ix, lnm+"_"+varNm, nameCol)
+		if err != nil {
+			return false, err
+		}
+		ds.Epoch = epoch
+		dr, has := st.Drifts[lnm]
+		if !has {
+			dr = &Drift{}
+			st.Drifts[lnm] = dr
+		}
+		if dr.First == nil {
+			dr.First = ds
+			dr.Prev = ds
+		}
+		st.SetFloat(lnm+"_Drift_Prev", DriftCorrel(ds, dr.Prev))
+		st.SetFloat(lnm+"_Drift_First", DriftCorrel(ds, dr.First))
+		st.SetFloat(lnm+"_Drift_PrefChg", DriftPrefChange(ds, dr.Prev))
+		dr.Prev = ds
+	}
+	return true, nil
+}
+
+// ResetDrift resets the Drift snapshots for all layers
+func (st *Stats) ResetDrift() {
+	st.Drifts = make(map[string]*Drift)
+}
+
+// NewDriftSnap returns a new DriftSnap with the average activity pattern
+// in given tensor column of given log table (IdxView) for each unique
+// trial name in nameCol.
+func NewDriftSnap(ix *etable.IdxView, colNm, nameCol string) (*DriftSnap, error) {
+	col, err := ix.Table.ColByNameTry(colNm)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := ix.Table.ColByNameTry(nameCol)
+	if err != nil {
+		return nil, err
+	}
+	if col.Dim(0) == 0 {
+		return nil, fmt.Errorf("estats.NewDriftSnap: no rows in column: %s", colNm)
+	}
+	nu := col.Len() / col.Dim(0)
+	idx := make(map[string]int)
+	for _, ri := range ix.Idxs {
+		idx[nc.StringVal1D(ri)] = 0
+	}
+	ds := &DriftSnap{}
+	for nm := range idx {
+		ds.Names = append(ds.Names, nm)
+	}
+	sort.Strings(ds.Names)
+	for i, nm := range ds.Names {
+		idx[nm] = i
+	}
+	ds.Pats = etensor.NewFloat64([]int{len(ds.Names), nu}, nil, []string{"Name", "Unit"})
+	cnt := make([]int, len(ds.Names))
+	for _, ri := range ix.Idxs {
+		ni := idx[nc.StringVal1D(ri)]
+		cnt[ni]++
+		for u := 0; u < nu; u++ {
+			ds.Pats.Values[ni*nu+u] += col.FloatVal1D(ri*nu + u)
+		}
+	}
+	for ni, n := range cnt {
+		for u := 0; u < nu; u++ {
+			ds.Pats.Values[ni*nu+u] /= float64(n)
+		}
+	}
+	return ds, nil
+}
+
+// DriftCorrel returns the mean correlation between the patterns of
+// the trial names in common between two snapshots.
+// Returns NaN if there are no names in common.
+func DriftCorrel(a, b *DriftSnap) float64 {
+	var sum float64
+	n := 0
+	for _, nm := range a.Names {
+		bp, ok := b.Row(nm)
+		if !ok {
+			continue
+		}
+		ap, _ := a.Row(nm)
+		cor := metric.Correlation64(ap, bp)
+		if math.IsNaN(cor) {
+			continue
+		}
+		sum += cor
+		n++
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+// DriftPrefChange returns the proportion of units whose preferred
+// trial name (with maximum activity, among names in common) differs
+// between two snapshots.  Units that are equally active for all
+// names in either snapshot have no preference and are not counted.
+// Returns NaN if no units have a preference in both.
+func DriftPrefChange(a, b *DriftSnap) float64 {
+	var names []string
+	for _, nm := range a.Names {
+		if _, ok := b.Row(nm); ok {
+			names = append(names, nm)
+		}
+	}
+	nu := a.Pats.Dim(1)
+	if len(names) == 0 || b.Pats.Dim(1) != nu {
+		return math.NaN()
+	}
+	nchg, n := 0, 0
+	for u := 0; u < nu; u++ {
+		ap, aok := driftPref(a, names, u)
+		bp, bok := driftPref(b, names, u)
+		if !aok || !bok {
+			continue
+		}
+		n++
+		if ap != bp {
+			nchg++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return float64(nchg) / float64(n)
+}
+
+// driftPref returns the index of the preferred name for given unit,
+// false if all names have the same activity.
+func driftPref(ds *DriftSnap, names []string, u int) (int, bool) {
+	mx, mn := math.Inf(-1), math.Inf(1)
+	pi := -1
+	for i, nm := range names {
+		p, _ := ds.Row(nm)
+		v := p[u]
+		if v > mx {
+			mx = v
+			pi = i
+		}
+		mn = math.Min(mn, v)
+	}
+	return pi, mx > mn
+}
@@ -0,0 +1,599 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/emergent/decoder"
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/split"
+)
+
+func TestRankCorrel(t *testing.T) {
+	rks := Ranks([]float64{3, 1, 3, 2})
+	exp := []float64{3.5, 1, 3.5, 2}
+	for i := range rks {
+		if rks[i] != exp[i] {
+			t.Errorf("Ranks[%d] = %g, expected %g", i, rks[i], exp[i])
+		}
+	}
+	a := []float64{1, 2, 3, 4, 5}
+	b := []float64{1, 4, 9, 16, 100} // monotonic
+	if r := SpearmanCorrel(a, b); math.Abs(r-1) > 1e-9 {
+		t.Errorf("Spearman = %g, expected 1", r)
+	}
+	if r := KendallCorrel(a, b); math.Abs(r-1) > 1e-9 {
+		t.Errorf("Kendall = %g, expected 1", r)
+	}
+	c := []float64{2, 1, 4, 3, 5}
+	// 10 pairs: 2 discordant, 8 concordant
+	if r := KendallCorrel(a, c); math.Abs(r-0.6) > 1e-9 {
+		t.Errorf("Kendall = %g, expected 0.6", r)
+	}
+}
+
+// testPatTable returns a table with npat patterns in two categories,
+// with Hidden_Act patterns that reflect the category plus noise
+func testPatTable(npat int, rnd erand.Rand) *etable.Table {
+	dt := &etable.Table{}
+	dt.SetFromSchema(etable.Schema{
+		{Name: "Name", Type: etensor.STRING},
+		{Name: "Cat", Type: etensor.STRING},
+		{Name: "Hidden_Act", Type: etensor.FLOAT32, CellShape: []int{10}},
+	}, npat)
+	for i := 0; i < npat; i++ {
+		cat := i % 2
+		dt.SetCellString("Name", i, string(rune('a'+i)))
+		dt.SetCellString("Cat", i, []string{"A", "B"}[cat])
+		for u := 0; u < 10; u++ {
+			v := 0.2 * rnd.Float64(-1)
+			if u%2 == cat {
+				v += 1
+			}
+			dt.ColByName("Hidden_Act").SetFloat([]int{i, u}, v)
+		}
+	}
+	return dt
+}
+
+func TestRSA(t *testing.T) {
+	st := &Stats{}
+	st.Init()
+	rnd := erand.NewSysRand(1)
+	ix := etable.NewIdxView(testPatTable(12, rnd))
+	if err := st.RSALayerRDMs(ix, "Act", []string{"Hidden"}, "Name"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.RSACategoryRDM("Cat", ix, "Cat", "Name"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := st.RSACompare("Hidden_Cat", RSARDMName("Hidden"), "Cat", RSAKendall, 200, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r < 0.5 || st.Float("Hidden_Cat_RSA") != r {
+		t.Errorf("RSA correlation too low: %g", r)
+	}
+	if p := st.Float("Hidden_Cat_RSA_P"); p > 0.05 {
+		t.Errorf("RSA p value not significant: %g", p)
+	}
+	cm, err := st.RSACompareSimMat("RSA", []string{RSARDMName("Hidden"), "Cat"}, RSASpearman)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Mat.FloatVal([]int{0, 0}) != 1 || cm.Mat.FloatVal([]int{0, 1}) < 0.5 {
+		t.Errorf("bad RSA SimMat: %v", cm.Mat)
+	}
+}
+
+func TestRepSim(t *testing.T) {
+	rnd := erand.NewSysRand(2)
+	nr, nu := 30, 8
+	a := etensor.NewFloat64([]int{nr, nu}, nil, nil)
+	b := etensor.NewFloat64([]int{nr, nu + 2}, nil, nil) // transform of a, more units
+	c := etensor.NewFloat64([]int{nr, nu}, nil, nil)     // unrelated
+	for r := 0; r < nr; r++ {
+		for u := 0; u < nu; u++ {
+			a.Set([]int{r, u}, rnd.NormFloat64(-1))
+			c.Set([]int{r, u}, rnd.NormFloat64(-1))
+		}
+		for u := 0; u < nu; u++ {
+			// permuted and scaled copy: orthogonal transform + isotropic scale,
+			// with 2 extra constant units
+			b.Set([]int{r, u}, 3*a.Value([]int{r, (u + 3) % nu}))
+		}
+		b.Set([]int{r, nu}, 1)
+	}
+	st := &Stats{}
+	st.Init()
+	if err := st.RepSimStats("AB", a, b, 0.8, 0.99); err != nil {
+		t.Fatal(err)
+	}
+	st.RepSimStats("AC", a, c, 0.8, 0.99)
+	for _, s := range []string{"_CKA", "_SVCCA"} {
+		if v := st.Float("AB" + s); math.Abs(v-1) > 1e-6 {
+			t.Errorf("AB%s = %g, expected 1", s, v)
+		}
+		if v := st.Float("AC" + s); v > 0.8 {
+			t.Errorf("AC%s = %g, expected lower", s, v)
+		}
+	}
+	if ab, ac := st.Float("AB_CKARBF"), st.Float("AC_CKARBF"); ab < 0.9 || ac >= ab {
+		t.Errorf("RBF CKA: AB = %g, AC = %g", ab, ac)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	st := &Stats{}
+	st.Init()
+	rnd := erand.NewSysRand(3)
+	dt := testPatTable(6, rnd)
+	dt.SetNumRows(12) // repeat each name twice, for averaging
+	for i := 6; i < 12; i++ {
+		dt.SetCellString("Name", i, dt.CellString("Name", i-6))
+		dt.SetCellTensor("Hidden_Act", i, dt.CellTensor("Hidden_Act", i-6))
+	}
+	ix := etable.NewIdxView(dt)
+	took, err := st.DriftStats(ix, "Act", "Name", []string{"Hidden"}, 0, 5)
+	if err != nil || !took {
+		t.Fatal("first snapshot not taken", err)
+	}
+	if st.Float("Hidden_Drift_Prev") != 1 || st.Float("Hidden_Drift_PrefChg") != 0 {
+		t.Errorf("first snapshot stats wrong")
+	}
+	if took, _ := st.DriftStats(ix, "Act", "Name", []string{"Hidden"}, 3, 5); took {
+		t.Errorf("snapshot taken off interval")
+	}
+	// swap the patterns of two categories: all unit preferences change
+	col := dt.ColByName("Hidden_Act").(*etensor.Float32)
+	for i := range col.Values {
+		col.Values[i] = 1 - col.Values[i]
+	}
+	st.DriftStats(ix, "Act", "Name", []string{"Hidden"}, 5, 5)
+	if v := st.Float("Hidden_Drift_Prev"); v > -0.9 {
+		t.Errorf("Drift_Prev = %g, expected -1", v)
+	}
+	if v := st.Float("Hidden_Drift_PrefChg"); v < 0.99 {
+		t.Errorf("Drift_PrefChg = %g, expected 1", v)
+	}
+	st.DriftStats(ix, "Act", "Name", []string{"Hidden"}, 10, 5)
+	if v := st.Float("Hidden_Drift_Prev"); math.Abs(v-1) > 1e-9 {
+		t.Errorf("Drift_Prev = %g, expected 1", v)
+	}
+	if v := st.Float("Hidden_Drift_First"); v > -0.9 {
+		t.Errorf("Drift_First = %g, expected -1", v)
+	}
+}
+
+func TestSelectivity(t *testing.T) {
+	if s := Sparseness([]float64{1, 0, 0, 0}); s != 1 {
+		t.Errorf("Sparseness = %g, expected 1", s)
+	}
+	if s := Sparseness([]float64{.5, .5, .5}); math.Abs(s) > 1e-12 {
+		t.Errorf("Sparseness = %g, expected 0", s)
+	}
+	st := &Stats{}
+	st.Init()
+	ix := etable.NewIdxView(testPatTable(20, erand.NewSysRand(4)))
+	cats, err := st.LayerSelectivity(ix, "Act", "Cat", []string{"Hidden"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cats) != 2 || cats[0] != "A" {
+		t.Errorf("bad categories: %v", cats)
+	}
+	tune := st.F64Tensor("Hidden_Tuning")
+	if tune.Dim(0) != 2 || tune.Dim(1) != 10 {
+		t.Errorf("bad tuning shape: %v", tune.Shp)
+	}
+	pc := st.IntTensor("Hidden_PrefCat")
+	dp := st.F64Tensor("Hidden_DPrime")
+	for u := 0; u < 10; u++ {
+		// even units prefer category A (0), odd units B (1)
+		if pc.Values[u] != u%2 {
+			t.Errorf("unit %d: PrefCat = %d", u, pc.Values[u])
+		}
+		if dp.Values[u] < 3 {
+			t.Errorf("unit %d: DPrime = %g, expected large", u, dp.Values[u])
+		}
+	}
+}
+
+func TestRasterStats(t *testing.T) {
+	st := &Stats{}
+	st.Init()
+	st.Rasters = []string{"Hidden"}
+	sr := st.F32Tensor("Raster_Hidden")
+	nn, nc := 3, 200
+	sr.SetShape([]int{nn, nc}, nil, []string{"Nrn", "Cyc"})
+	for c := 0; c < nc; c++ {
+		if c%10 == 0 { // neurons 0, 1: regular and synchronous, every 10 cycles
+			sr.Set([]int{0, c}, 1)
+			sr.Set([]int{1, c}, 1)
+		}
+	}
+	// neuron 2 is silent
+	if err := st.RasterStats(0, 5, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	rates := st.F64Tensor("Hidden_Spike_Rates")
+	if rates.Values[0] != 100 || rates.Values[2] != 0 {
+		t.Errorf("bad rates: %v", rates.Values)
+	}
+	if v := st.Float("Hidden_Spike_ISICV"); v != 0 {
+		t.Errorf("ISICV = %g, expected 0 for regular firing", v)
+	}
+	if v := st.F64Tensor("Hidden_Spike_ISIHist").Values[10]; v != 2*19 {
+		t.Errorf("ISIHist[10] = %g, expected 38", v)
+	}
+	if v := st.F64Tensor("Hidden_Spike_Cors").Value([]int{0, 1}); math.Abs(v-1) > 1e-9 {
+		t.Errorf("Cor(0,1) = %g, expected 1", v)
+	}
+	if v := st.Float("Hidden_Spike_Fano"); math.Abs(v-0.5) > 1e-9 { // counts alternate 1, 0
+		t.Errorf("Fano = %g, expected .5", v)
+	}
+	sync := st.Float("Hidden_Spike_Sync")
+	// population of 2 synchronous + 1 silent neuron: pop var = (2/3)^2 .25, mean var = 2/3 .25
+	if math.Abs(sync-math.Sqrt(2.0/3.0)) > 1e-9 {
+		t.Errorf("Sync = %g", sync)
+	}
+}
+
+func TestDimStats(t *testing.T) {
+	if pr := ParticipationRatio([]float64{1, 1, 1, 0}); math.Abs(pr-3) > 1e-12 {
+		t.Errorf("PR = %g, expected 3", pr)
+	}
+	if n := NCompsVar([]float64{5, 3, 1, 1}, .8); n != 2 {
+		t.Errorf("NCompsVar = %d, expected 2", n)
+	}
+	// points on a 2D plane embedded in 10D
+	rnd := erand.NewSysRand(5)
+	np := 400
+	dt := &etable.Table{}
+	dt.SetFromSchema(etable.Schema{
+		{Name: "Hidden_Act", Type: etensor.FLOAT32, CellShape: []int{10}},
+	}, np)
+	col := dt.ColByName("Hidden_Act")
+	for i := 0; i < np; i++ {
+		x, y := rnd.Float64(-1), rnd.Float64(-1)
+		for u := 0; u < 10; u++ {
+			col.SetFloat1D(i*10+u, x*float64(u%3)+y*float64(u%2))
+		}
+	}
+	st := &Stats{}
+	st.Init()
+	if err := st.DimStats(etable.NewIdxView(dt), "Act", []string{"Hidden"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := st.Float("Hidden_Dim_NVar"); v != 2 {
+		t.Errorf("NVar = %g, expected 2", v)
+	}
+	if v := st.Float("Hidden_Dim_PR"); v < 1 || v > 2 {
+		t.Errorf("PR = %g, expected between 1 and 2", v)
+	}
+	if v := st.Float("Hidden_Dim_TwoNN"); math.Abs(v-2) > 0.3 {
+		t.Errorf("TwoNN = %g, expected ~2", v)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	st := &Stats{}
+	st.Init()
+	st.ThreadSafe = true
+	nw := 4
+	workers := make([]*Stats, nw)
+	done := make(chan bool)
+	for wi := range workers {
+		wst := &Stats{}
+		wst.Init()
+		workers[wi] = wst
+		go func(wi int) {
+			wst.SetFloat("Err", float64(wi))
+			wst.SetInt("N", 1)
+			tsr := wst.F64Tensor("Acts")
+			tsr.SetShape([]int{2, 3}, nil, nil)
+			tsr.Values[0] = float64(wi)
+			st.SetFloat("Shared", float64(wi)) // concurrent access to shared stats
+			st.F32Tensor("Shared")
+			done <- true
+		}(wi)
+	}
+	for range workers {
+		<-done
+	}
+	sum := &Stats{}
+	sum.Init()
+	mean := &Stats{}
+	mean.Init()
+	cat := &Stats{}
+	cat.Init()
+	for _, wst := range workers {
+		sum.Merge(wst, MergeSum)
+		mean.Merge(wst, MergeMean)
+		if err := cat.Merge(wst, MergeConcat); err != nil {
+			t.Error(err)
+		}
+	}
+	if v := sum.Float("Err"); v != 6 {
+		t.Errorf("sum Err = %g, expected 6", v)
+	}
+	if v := sum.Int("N"); v != nw {
+		t.Errorf("sum N = %d, expected %d", v, nw)
+	}
+	if v := mean.Float("Err"); math.Abs(v-1.5) > 1e-12 {
+		t.Errorf("mean Err = %g, expected 1.5", v)
+	}
+	if v := mean.F64Tensor("Acts").Values[0]; math.Abs(v-1.5) > 1e-12 {
+		t.Errorf("mean Acts[0] = %g, expected 1.5", v)
+	}
+	ct := cat.F64Tensor("Acts")
+	if ct.Dim(0) != 2*nw || ct.Value([]int{6, 0}) != 3 {
+		t.Errorf("bad concatenated tensor: %v", ct.Shp)
+	}
+
+	// key only in the last worker is averaged over just that worker
+	late := &Stats{}
+	late.Init()
+	late.SetFloat("Err", 2)
+	late.SetFloat("Late", 4)
+	mean.Merge(late, MergeMean)
+	if v := mean.Float("Late"); v != 4 {
+		t.Errorf("mean Late = %g, expected 4", v)
+	}
+	if v := mean.Float("Err"); math.Abs(v-1.6) > 1e-12 {
+		t.Errorf("mean Err = %g, expected 1.6", v)
+	}
+
+	// merging into itself does nothing
+	sum.Merge(sum, MergeSum)
+	if v := sum.Float("Err"); v != 6 {
+		t.Errorf("self-merged Err = %g, expected 6", v)
+	}
+
+	// a shape mismatch changes nothing
+	bad := &Stats{}
+	bad.Init()
+	bad.SetFloat("Err", 100)
+	bad.F64Tensor("Acts").SetShape([]int{5}, nil, nil)
+	if err := sum.Merge(bad, MergeSum); err == nil {
+		t.Errorf("expected error for tensor size mismatch")
+	}
+	if v := sum.Float("Err"); v != 6 {
+		t.Errorf("Err = %g after failed merge, expected 6", v)
+	}
+
+	// a worker with no rows is skipped, and an empty placeholder is a copy
+	idle := &Stats{}
+	idle.Init()
+	idle.F64Tensor("Acts").SetShape([]int{0, 3}, nil, nil)
+	if err := cat.Merge(idle, MergeConcat); err != nil || cat.F64Tensor("Acts").Dim(0) != 2*nw {
+		t.Errorf("merge of empty tensor: %v", err)
+	}
+	ph := &Stats{}
+	ph.Init()
+	ph.F64Tensor("Acts")
+	if err := ph.Merge(workers[3], MergeMean); err != nil || ph.F64Tensor("Acts").Values[0] != 3 {
+		t.Errorf("merge into empty placeholder: %v", err)
+	}
+
+	// workers merging into each other concurrently do not deadlock
+	wa, wb := workers[0], workers[1]
+	wa.ThreadSafe, wb.ThreadSafe = true, true
+	go func() {
+		wa.Merge(wb, MergeSum)
+		done <- true
+	}()
+	wb.Merge(wa, MergeSum)
+	<-done
+}
+
+func TestBootstrap(t *testing.T) {
+	rnd := erand.NewSysRand(1)
+	dt := &etable.Table{}
+	dt.SetFromSchema(etable.Schema{
+		{Name: "Run", Type: etensor.INT64},
+		{Name: "Cond", Type: etensor.STRING},
+		{Name: "Err", Type: etensor.FLOAT64},
+	}, 40)
+	for i := 0; i < 40; i++ {
+		run := i / 2
+		cond := i % 2
+		dt.SetCellFloat("Run", i, float64(run))
+		dt.SetCellString("Cond", i, []string{"A", "B"}[cond])
+		// B is 1 higher than A on each run, with run-level noise
+		dt.SetCellFloat("Err", i, float64(cond)+float64(run%5)+0.1*rnd.Float64(-1))
+	}
+	ix := etable.NewIdxView(dt)
+
+	bc, err := BootstrapCol(ix, "Err", 1000, 0.95, erand.NewSysRand(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(bc.Lo < bc.Stat && bc.Stat < bc.Hi) || !(bc.BCaLo < bc.Stat && bc.Stat < bc.BCaHi) {
+		t.Errorf("Bootstrap interval does not contain stat: %+v", bc)
+	}
+	bc2, _ := BootstrapCol(ix, "Err", 1000, 0.95, erand.NewSysRand(2))
+	if bc2 != bc {
+		t.Errorf("Bootstrap not reproducible with same seed: %+v vs. %+v", bc, bc2)
+	}
+
+	st := &Stats{}
+	st.Init()
+	if err := st.BootstrapStats("Err", ix, "Err", 200, 0.95, rnd); err != nil {
+		t.Fatal(err)
+	}
+	if st.Float("Err_CILo") >= st.Float("Err_CIHi") {
+		t.Errorf("Err_CILo %g >= Err_CIHi %g", st.Float("Err_CILo"), st.Float("Err_CIHi"))
+	}
+
+	spl := split.GroupBy(ix, []string{"Cond"})
+	bt := &etable.Table{}
+	if err := BootstrapSplits(bt, spl, "Err", 500, 0.95, rnd); err != nil {
+		t.Fatal(err)
+	}
+	if bt.Rows != 2 || bt.CellString("Cond", 1) != "B" || int(bt.CellFloat("N", 0)) != 20 {
+		t.Errorf("BootstrapSplits table wrong: rows: %d", bt.Rows)
+	}
+	if bt.CellFloat("Mean", 1)-bt.CellFloat("Mean", 0) < 0.9 {
+		t.Errorf("BootstrapSplits means: A: %g  B: %g", bt.CellFloat("Mean", 0), bt.CellFloat("Mean", 1))
+	}
+	if hw := bt.CellFloat("CIHalf", 0); math.Abs(hw-(bt.CellFloat("CIHi", 0)-bt.CellFloat("CILo", 0))/2) > 1e-12 || bt.MetaData["Mean:ErrCol"] != "CIHalf" {
+		t.Errorf("BootstrapSplits CIHalf: %g not half-width of CI, or not ErrCol", hw)
+	}
+
+	// intervals overlap due to run variance, but paired test finds the difference
+
+	diff, p, err := PairedPermTestCol(ix, "Err", "Cond", "B", "A", "Run", 999, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(diff-1) > 0.1 || p > 0.01 {
+		t.Errorf("PairedPermTest: diff = %g (expected 1), p = %g (expected < .01)", diff, p)
+	}
+	_, p = PairedPermTest([]float64{1, 2, 3, 4}, []float64{1, 2, 3, 4}, 100, rnd)
+	if p != 1 {
+		t.Errorf("PairedPermTest of equal values: p = %g, expected 1", p)
+	}
+}
+
+// testItemEnv is a minimal TestEnv presenting a list of item names
+type testItemEnv struct {
+	Nm    string
+	Items []string
+	Run   int
+}
+
+func (ev *testItemEnv) Name() string { return ev.Nm }
+func (ev *testItemEnv) Init(run int) { ev.Run = run }
+
+func TestTestBattery(t *testing.T) {
+	st := &Stats{}
+	st.Init()
+	tb := &TestBattery{ErrStats: []string{"TrlErr"}, TargetStat: "TrlName", ClosestStat: "TrlClosest", Labels: []string{"a", "b", "c"}}
+	tb.AddSet("Train", &testItemEnv{Nm: "Train", Items: []string{"a", "b", "c", "a"}})
+	tb.AddSet("Novel", &testItemEnv{Nm: "Novel", Items: []string{"a", "b", "c", "c"}})
+	tb.RunFunc = func(ev TestEnv) {
+		te := ev.(*testItemEnv)
+		for _, it := range te.Items {
+			// the simulated network always responds "a" for novel items
+			cls := it
+			if te.Nm == "Novel" {
+				cls = "a"
+			}
+			st.SetString("TrlName", it)
+			st.SetString("TrlClosest", cls)
+			if cls == it {
+				st.SetFloat("TrlErr", 0)
+			} else {
+				st.SetFloat("TrlErr", 1)
+			}
+			tb.RecordTrial(st)
+		}
+	}
+	tb.RecordTrial(st) // not running: ignored
+	if err := tb.Run(st, 2); err != nil {
+		t.Fatal(err)
+	}
+	dt := tb.Table
+	if dt.Rows != 2 || dt.CellString("Set", 1) != "Novel" || dt.CellFloat("N", 0) != 4 {
+		t.Errorf("TestBattery table wrong: rows: %d", dt.Rows)
+	}
+	if dt.CellFloat("PctCor", 0) != 1 || dt.CellFloat("PctCor", 1) != 0.25 {
+		t.Errorf("PctCor: Train: %g  Novel: %g", dt.CellFloat("PctCor", 0), dt.CellFloat("PctCor", 1))
+	}
+	if st.Float("Novel_TrlErr") != 0.75 || st.Float("Train_PctCor") != 1 {
+		t.Errorf("TestBattery stats: Novel_TrlErr: %g  Train_PctCor: %g", st.Float("Novel_TrlErr"), st.Float("Train_PctCor"))
+	}
+	nv := tb.SetByName("Novel")
+	if nv.Env.(*testItemEnv).Run != 2 {
+		t.Errorf("env not initialized with run")
+	}
+	// c items (row 2) all answered a (col 0)
+	if p := nv.Confusion.Prob.Value([]int{2, 0}); p != 1 {
+		t.Errorf("Novel confusion c -> a = %g, expected 1", p)
+	}
+}
+
+func TestSaveOpenJSON(t *testing.T) {
+	st := &Stats{}
+	st.Init()
+	st.SetFloat("Err", 0.25)
+	st.SetFloat("Cor", math.NaN())
+	st.SetString("TrlName", "a")
+	st.SetInt("Epoch", 3)
+	st.F64Tensor("Tsr").SetShape([]int{2, 3}, nil, []string{"Y", "X"})
+	st.F64Tensor("Tsr").Values[4] = math.Inf(1)
+	st.IntTensor("Cats").SetShape([]int{2}, nil, nil)
+	st.IntTensor("Cats").Values[1] = 7
+	st.Confusion.InitFromLabels([]string{"a", "b"}, 12)
+	st.Confusion.Incr(0, 1)
+	st.Confusion.Probs()
+	sm := st.SimMat("Hidden")
+	sm.Init()
+	sm.Mat.SetShape([]int{2, 2}, nil, nil)
+	sm.Mat.SetFloat1D(1, 0.5)
+	sm.Rows = []string{"a", "b"}
+	act := etensor.NewFloat32([]int{2}, nil, nil)
+	src := etensor.NewFloat32([]int{3}, nil, nil)
+	act.Values[0] = 1
+	src.Values[2] = 1
+	st.ActRFs.AddRF("Hidden", act, src)
+	st.ActRFs.Add("Hidden", act, src, 0.1)
+	dec := &decoder.Linear{}
+	dec.Init(2, 3, -1, nil)
+	dec.Weights.Values[5] = 0.7
+	st.LinDecoders["Out"] = dec
+
+	st.ThreadSafe = true
+
+	fnm := t.TempDir() + "/stats.json"
+	if err := st.SaveJSON(fnm); err != nil {
+		t.Fatal(err)
+	}
+	ns := &Stats{}
+	if err := ns.OpenJSON(fnm); err != nil {
+		t.Fatal(err)
+	}
+	if ns.ThreadSafe {
+		t.Errorf("ThreadSafe should not be restored")
+	}
+	ns.SetFloat("Extra", 1) // fails if OpenJSON changed the lock state
+	if ns.Float("Err") != 0.25 || !math.IsNaN(ns.Float("Cor")) || ns.String("TrlName") != "a" || ns.Int("Epoch") != 3 {
+		t.Errorf("scalar stats not restored: %v %v %v", ns.Floats, ns.Strings, ns.Ints)
+	}
+	tsr := ns.F64Tensor("Tsr")
+	if tsr.Dim(1) != 3 || tsr.DimNames()[1] != "X" || !math.IsInf(tsr.Values[4], 1) {
+		t.Errorf("F64Tensor not restored: %v", tsr)
+	}
+	if ns.IntTensor("Cats").Values[1] != 7 {
+		t.Errorf("IntTensor not restored")
+	}
+	if ns.Confusion.Sum.Value([]int{0, 1}) != 1 || ns.Confusion.Prob.Value([]int{0, 1}) != 1 || ns.Confusion.Vis.Rows[1] != "b" {
+		t.Errorf("Confusion not restored")
+	}
+	if nm := ns.SimMat("Hidden"); nm.Mat.FloatVal1D(1) != 0.5 || nm.Rows[1] != "b" {
+		t.Errorf("SimMat not restored")
+	}
+	rf := ns.ActRFs.RFByName("Hidden")
+	if rf == nil || rf.SumProd.Values[2] != 1 {
+		t.Errorf("ActRF not restored")
+	}
+	ld := ns.LinDecoders["Out"]
+	if ld == nil || ld.NInputs != 3 || ld.Weights.Values[5] != 0.7 || ld.ActivationFn == nil {
+		t.Errorf("LinDecoder not restored")
+	}
+
+	// existing decoder of wrong size is an error
+	bad := &decoder.Linear{}
+	bad.Init(2, 4, -1, nil)
+	ns.LinDecoders["Out"] = bad
+	if err := ns.OpenJSON(fnm); err == nil {
+		t.Errorf("expected error for decoder size mismatch")
+	}
+}
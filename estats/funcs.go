@@ -88,15 +88,23 @@ var PCAStrongThr = 0.01
 // layer_PCA_Next5: average strength of next 5 eigenvalues
 // layer_PCA_Rest: average strength of remaining eigenvalues (if more than 10 total eigens)
 // Uses SVD to compute much more efficiently than official PCA.
+// See PCAStatsThr to use a different threshold, and DimStats for
+// other measures of dimensionality.
 func (st *Stats) PCAStats(ix *etable.IdxView, varNm string, layers []string) {
+	st.PCAStatsThr(ix, varNm, layers, PCAStrongThr)
+}
+
+// PCAStatsThr computes PCAStats using given threshold for counting
+// eigenvalues as strong, instead of the global PCAStrongThr.
+func (st *Stats) PCAStatsThr(ix *etable.IdxView, varNm string, layers []string, strongThr float64) {
 	svd := &st.SVD
-	svd.Cond = PCAStrongThr
+	svd.Cond = strongThr
 	for _, lnm := range layers {
 		svd.TableCol(ix, lnm+"_"+varNm, metric.Covariance64)
 		ln := len(svd.Values)
 		var nstr float64 // nstr := float64(svd.Rank)  this didn't work..
 		for i, v := range svd.Values {
-			if v < PCAStrongThr {
+			if v < strongThr {
 				nstr = float64(i)
 				break
 			}
@@ -0,0 +1,405 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/emer/emergent/actrf"
+	"github.com/emer/emergent/decoder"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/simat"
+	"gonum.org/v1/gonum/mat"
+)
+
+//////////////////////////////////////////////
+//  Saving and loading Stats
+
+// SaveJSON saves the Stats to a JSON file, e.g., as part of a run
+// checkpoint, or for inspection offline.  All the data is saved except
+// the Plots and Timers, which are recreated as needed.  For the decoders,
+// only the learned weights and sizes are saved -- see OpenJSON.
+// NaN and infinite values are saved as the strings "NaN", "+Inf", "-Inf".
+func (st *Stats) SaveJSON(filename string) error {
+	b, err := st.marshalJSON()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+// OpenJSON opens Stats from a JSON file saved by SaveJSON, replacing
+// the current values (Plots and Timers are not affected, nor is
+// ThreadSafe, which is a runtime setting and is not saved).
+// Decoders already configured (with their Layers) under the same name
+// have their weights restored, and otherwise new decoders are created
+// with the saved weights, which need their Layers set before use
+// (new Linear decoders use the IdentityFunc activation function).
+func (st *Stats) OpenJSON(filename string) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return st.unmarshalJSON(b)
+}
+
+// marshalJSON returns the Stats in the JSON format used by SaveJSON.
+// This is not MarshalJSON, so that it does not change the encoding of
+// structs that contain Stats.
+func (st *Stats) marshalJSON() ([]byte, error) {
+	st.rlock()
+	defer st.runlock()
+	sj := &statsJSON{
+		Floats:          make(map[string]jsonFloat, len(st.Floats)),
+		Strings:         st.Strings,
+		Ints:            st.Ints,
+		F32Tensors:      make(map[string]*jsonTensor, len(st.F32Tensors)),
+		F64Tensors:      make(map[string]*jsonTensor, len(st.F64Tensors)),
+		IntTensors:      make(map[string]*jsonTensor, len(st.IntTensors)),
+		SimMats:         make(map[string]*simMatJSON, len(st.SimMats)),
+		Drifts:          make(map[string]*driftJSON, len(st.Drifts)),
+		Rasters:         st.Rasters,
+		LinDecoders:     make(map[string]*linearJSON, len(st.LinDecoders)),
+		SoftMaxDecoders: make(map[string]*softMaxJSON, len(st.SoftMaxDecoders)),
+	}
+	for k, v := range st.Floats {
+		sj.Floats[k] = jsonFloat(v)
+	}
+	for k, v := range st.F32Tensors {
+		sj.F32Tensors[k] = newJSONTensor(v)
+	}
+	for k, v := range st.F64Tensors {
+		sj.F64Tensors[k] = newJSONTensor(v)
+	}
+	for k, v := range st.IntTensors {
+		sj.IntTensors[k] = newJSONTensor(v)
+	}
+	cm := &st.Confusion
+	sj.Confusion = &confusionJSON{Prob: newJSONTensor(&cm.Prob), Sum: newJSONTensor(&cm.Sum), N: newJSONTensor(&cm.N), Labels: cm.Vis.Rows}
+	for k, v := range st.SimMats {
+		sj.SimMats[k] = &simMatJSON{Mat: newJSONTensor(v.Mat), Rows: v.Rows, Cols: v.Cols}
+	}
+	sj.PCA = &pcaJSON{Covar: newJSONTensor(st.PCA.Covar), Vectors: newJSONTensor(st.PCA.Vectors), Values: jsonFloats64(st.PCA.Values)}
+	sj.SVD = &pcaJSON{Kind: int(st.SVD.Kind), Cond: jsonFloat(st.SVD.Cond), Rank: st.SVD.Rank, Covar: newJSONTensor(st.SVD.Covar), Vectors: newJSONTensor(st.SVD.Vectors), Values: jsonFloats64(st.SVD.Values)}
+	for _, rf := range st.ActRFs.RFs {
+		sj.ActRFs = append(sj.ActRFs, &rfJSON{Name: rf.Name, RF: newJSONTensor(&rf.RF), NormRF: newJSONTensor(&rf.NormRF), NormSrc: newJSONTensor(&rf.NormSrc), SumProd: newJSONTensor(&rf.SumProd), SumSrc: newJSONTensor(&rf.SumSrc)})
+	}
+	for k, v := range st.Drifts {
+		sj.Drifts[k] = &driftJSON{First: newDriftSnapJSON(v.First), Prev: newDriftSnapJSON(v.Prev)}
+	}
+	for k, v := range st.LinDecoders {
+		sj.LinDecoders[k] = &linearJSON{LRate: jsonFloat(v.LRate), NOutputs: v.NOutputs, NInputs: v.NInputs, PoolIndex: v.PoolIndex, Weights: newJSONTensor(&v.Weights)}
+	}
+	for k, v := range st.SoftMaxDecoders {
+		sj.SoftMaxDecoders[k] = &softMaxJSON{Lrate: jsonFloat(v.Lrate), NCats: v.NCats, NInputs: v.NInputs, Weights: newJSONTensor(&v.Weights)}
+	}
+	return json.MarshalIndent(sj, "", "  ")
+}
+
+// unmarshalJSON sets the Stats from the JSON format used by SaveJSON
+// -- see OpenJSON for details.
+func (st *Stats) unmarshalJSON(b []byte) error {
+	sj := &statsJSON{}
+	if err := json.Unmarshal(b, sj); err != nil {
+		return err
+	}
+	if st.Floats == nil {
+		st.Init()
+	}
+	st.lock()
+	defer st.unlock()
+	// check configured decoders before changing anything
+	for k, v := range sj.LinDecoders {
+		if dec, has := st.LinDecoders[k]; has && (dec.NInputs != v.NInputs || dec.NOutputs != v.NOutputs) {
+			return fmt.Errorf("estats.Stats: LinDecoder %s has %d inputs, %d outputs, saved has %d, %d", k, dec.NInputs, dec.NOutputs, v.NInputs, v.NOutputs)
+		}
+	}
+	for k, v := range sj.SoftMaxDecoders {
+		if dec, has := st.SoftMaxDecoders[k]; has && (dec.NInputs != v.NInputs || dec.NCats != v.NCats) {
+			return fmt.Errorf("estats.Stats: SoftMaxDecoder %s has %d inputs, %d cats, saved has %d, %d", k, dec.NInputs, dec.NCats, v.NInputs, v.NCats)
+		}
+	}
+	st.mergeN = nil // loaded values count as one Stats for MergeMean
+	st.Floats = make(map[string]float64, len(sj.Floats))
+	for k, v := range sj.Floats {
+		st.Floats[k] = float64(v)
+	}
+	st.Strings = make(map[string]string, len(sj.Strings))
+	for k, v := range sj.Strings {
+		st.Strings[k] = v
+	}
+	st.Ints = make(map[string]int, len(sj.Ints))
+	for k, v := range sj.Ints {
+		st.Ints[k] = v
+	}
+	st.F32Tensors = make(map[string]*etensor.Float32, len(sj.F32Tensors))
+	for k, v := range sj.F32Tensors {
+		tsr := &etensor.Float32{}
+		v.setTensor(tsr)
+		st.F32Tensors[k] = tsr
+	}
+	st.F64Tensors = make(map[string]*etensor.Float64, len(sj.F64Tensors))
+	for k, v := range sj.F64Tensors {
+		tsr := &etensor.Float64{}
+		v.setTensor(tsr)
+		st.F64Tensors[k] = tsr
+	}
+	st.IntTensors = make(map[string]*etensor.Int, len(sj.IntTensors))
+	for k, v := range sj.IntTensors {
+		tsr := &etensor.Int{}
+		v.setTensor(tsr)
+		st.IntTensors[k] = tsr
+	}
+	if cj := sj.Confusion; cj != nil {
+		cm := &st.Confusion
+		cj.Prob.setTensor(&cm.Prob)
+		cj.Sum.setTensor(&cm.Sum)
+		cj.N.setTensor(&cm.N)
+		if n := cm.N.Len(); n > 0 {
+			cm.TFPN.SetShape([]int{n, 4}, nil, []string{"TP", "FP", "FN", "TN"})
+			cm.ClassScores.SetShape([]int{n, 3}, nil, []string{"Precision", "Recall", "F1"})
+			cm.MatrixScores.SetShape([]int{3}, nil, []string{"Precision", "Recall", "F1"})
+		}
+		cm.Vis.Mat = &cm.Prob
+		cm.SetLabels(cj.Labels)
+	}
+	st.SimMats = make(map[string]*simat.SimMat, len(sj.SimMats))
+	for k, v := range sj.SimMats {
+		tsr := &etensor.Float64{}
+		v.Mat.setTensor(tsr)
+		st.SimMats[k] = &simat.SimMat{Mat: tsr, Rows: v.Rows, Cols: v.Cols}
+	}
+	if pj := sj.PCA; pj != nil {
+		st.PCA.Init()
+		pj.Covar.setTensor(st.PCA.Covar)
+		pj.Vectors.setTensor(st.PCA.Vectors)
+		st.PCA.Values = pj.Values.floats()
+	}
+	if pj := sj.SVD; pj != nil {
+		st.SVD.Init()
+		st.SVD.Kind = mat.SVDKind(pj.Kind)
+		st.SVD.Cond = float64(pj.Cond)
+		st.SVD.Rank = pj.Rank
+		pj.Covar.setTensor(st.SVD.Covar)
+		pj.Vectors.setTensor(st.SVD.Vectors)
+		st.SVD.Values = pj.Values.floats()
+	}
+	st.ActRFs = actrf.RFs{NameMap: make(map[string]int, len(sj.ActRFs))}
+	for i, rj := range sj.ActRFs {
+		rf := &actrf.RF{Name: rj.Name}
+		rj.RF.setTensor(&rf.RF)
+		rj.NormRF.setTensor(&rf.NormRF)
+		rj.NormSrc.setTensor(&rf.NormSrc)
+		rj.SumProd.setTensor(&rf.SumProd)
+		rj.SumSrc.setTensor(&rf.SumSrc)
+		st.ActRFs.NameMap[rf.Name] = i
+		st.ActRFs.RFs = append(st.ActRFs.RFs, rf)
+	}
+	st.Drifts = make(map[string]*Drift, len(sj.Drifts))
+	for k, v := range sj.Drifts {
+		st.Drifts[k] = &Drift{First: v.First.snap(), Prev: v.Prev.snap()}
+	}
+	st.Rasters = sj.Rasters
+
+	lds := make(map[string]*decoder.Linear, len(sj.LinDecoders))
+	for k, v := range sj.LinDecoders {
+		dec, has := st.LinDecoders[k]
+		if !has {
+			dec = &decoder.Linear{}
+			dec.Init(v.NOutputs, v.NInputs, v.PoolIndex, decoder.IdentityFunc)
+		}
+		dec.LRate = float32(v.LRate)
+		v.Weights.setTensor(&dec.Weights)
+		lds[k] = dec
+	}
+	st.LinDecoders = lds
+	sds := make(map[string]*decoder.SoftMax, len(sj.SoftMaxDecoders))
+	for k, v := range sj.SoftMaxDecoders {
+		dec, has := st.SoftMaxDecoders[k]
+		if !has {
+			dec = &decoder.SoftMax{}
+			dec.Init(v.NCats, v.NInputs)
+		}
+		dec.Lrate = float32(v.Lrate)
+		v.Weights.setTensor(&dec.Weights)
+		sds[k] = dec
+	}
+	st.SoftMaxDecoders = sds
+	return nil
+}
+
+// statsJSON is the saved form of Stats
+type statsJSON struct {
+	Floats          map[string]jsonFloat
+	Strings         map[string]string
+	Ints            map[string]int
+	F32Tensors      map[string]*jsonTensor
+	F64Tensors      map[string]*jsonTensor
+	IntTensors      map[string]*jsonTensor
+	Confusion       *confusionJSON
+	SimMats         map[string]*simMatJSON
+	PCA             *pcaJSON
+	SVD             *pcaJSON
+	ActRFs          []*rfJSON
+	Drifts          map[string]*driftJSON
+	Rasters         []string
+	LinDecoders     map[string]*linearJSON
+	SoftMaxDecoders map[string]*softMaxJSON
+}
+
+type confusionJSON struct {
+	Prob, Sum, N *jsonTensor
+	Labels       []string
+}
+
+type simMatJSON struct {
+	Mat        *jsonTensor
+	Rows, Cols []string
+}
+
+type pcaJSON struct {
+	Kind           int       `json:",omitempty"`
+	Cond           jsonFloat `json:",omitempty"`
+	Rank           int       `json:",omitempty"`
+	Covar, Vectors *jsonTensor
+	Values         jsonFloats
+}
+
+type rfJSON struct {
+	Name                                 string
+	RF, NormRF, NormSrc, SumProd, SumSrc *jsonTensor
+}
+
+type driftSnapJSON struct {
+	Epoch int
+	Names []string
+	Pats  *jsonTensor
+}
+
+func newDriftSnapJSON(ds *DriftSnap) *driftSnapJSON {
+	if ds == nil {
+		return nil
+	}
+	return &driftSnapJSON{Epoch: ds.Epoch, Names: ds.Names, Pats: newJSONTensor(ds.Pats)}
+}
+
+func (dj *driftSnapJSON) snap() *DriftSnap {
+	if dj == nil {
+		return nil
+	}
+	ds := &DriftSnap{Epoch: dj.Epoch, Names: dj.Names, Pats: &etensor.Float64{}}
+	dj.Pats.setTensor(ds.Pats)
+	return ds
+}
+
+type driftJSON struct {
+	First, Prev *driftSnapJSON
+}
+
+type linearJSON struct {
+	LRate     jsonFloat
+	NOutputs  int
+	NInputs   int
+	PoolIndex int
+	Weights   *jsonTensor
+}
+
+type softMaxJSON struct {
+	Lrate   jsonFloat
+	NCats   int
+	NInputs int
+	Weights *jsonTensor
+}
+
+// jsonTensor is the saved form of a numeric tensor
+type jsonTensor struct {
+	Shape  []int
+	Names  []string `json:",omitempty"`
+	Values jsonFloats
+}
+
+// newJSONTensor returns the saved form of given tensor, nil if nil
+func newJSONTensor(tsr etensor.Tensor) *jsonTensor {
+	if tsr == nil {
+		return nil
+	}
+	if ptr, ok := tsr.(*etensor.Float64); ok && ptr == nil {
+		return nil
+	}
+	jt := &jsonTensor{Shape: tsr.Shapes(), Names: tsr.DimNames(), Values: make(jsonFloats, tsr.Len())}
+	for i := range jt.Values {
+		jt.Values[i] = jsonFloat(tsr.FloatVal1D(i))
+	}
+	return jt
+}
+
+// setTensor sets the shape and values of given tensor -- nothing if nil
+func (jt *jsonTensor) setTensor(tsr etensor.Tensor) {
+	if jt == nil {
+		return
+	}
+	tsr.SetShape(jt.Shape, nil, jt.Names)
+	for i, v := range jt.Values {
+		tsr.SetFloat1D(i, float64(v))
+	}
+}
+
+// jsonFloat is a float64 that is saved as a string if NaN or infinite,
+// which are not valid JSON numbers
+type jsonFloat float64
+
+func (jf jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(jf)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+func (jf *jsonFloat) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if len(s) > 1 && s[0] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*jf = jsonFloat(v)
+	return nil
+}
+
+type jsonFloats []jsonFloat
+
+func jsonFloats64(vals []float64) jsonFloats {
+	if vals == nil {
+		return nil
+	}
+	jf := make(jsonFloats, len(vals))
+	for i, v := range vals {
+		jf[i] = jsonFloat(v)
+	}
+	return jf
+}
+
+func (jf jsonFloats) floats() []float64 {
+	if jf == nil {
+		return nil
+	}
+	vals := make([]float64, len(jf))
+	for i, v := range jf {
+		vals[i] = float64(v)
+	}
+	return vals
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/actrf"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/ki/kit"
+)
+
+// MergeOps are the ways of combining stats values in Merge
+type MergeOps int
+
+//go:generate stringer -type=MergeOps
+
+var KiT_MergeOps = kit.Enums.AddEnum(MergeOpsN, kit.NotBitFlag, nil)
+
+func (ev MergeOps) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *MergeOps) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// The merge operations
+const (
+	// MergeSum adds the values of scalars and tensors
+	MergeSum MergeOps = iota
+
+	// MergeMean averages the values of scalars and tensors, over
+	// all the Stats merged with MergeMean so far
+	MergeMean
+
+	// MergeConcat concatenates tensors along their outer-most (row)
+	// dimension, and adds the values of scalars
+	MergeConcat
+
+	MergeOpsN
+)
+
+// Merge combines the stats in other into this one, using given operation,
+// e.g., to combine the stats computed by different worker goroutines,
+// each with its own Stats, analogous to actrf.RFs.MPISum for MPI.
+// Floats, Ints, F32Tensors, F64Tensors and IntTensors are combined
+// per the operation, and values that only exist in other are copied.
+// Strings only in other are copied.  Confusion and ActRFs sums are always
+// added, so the Probs or Avg methods must be called after merging.
+// Other fields (SimMats, Plots, PCA, decoders, Timers) are not merged.
+// For MergeMean, the number of Stats averaged into each value is kept per
+// key, so keys that only some workers have are averaged over just those
+// workers, and existing values not from a merge count as one worker.
+// A snapshot of other is taken first, so workers can merge into each
+// other concurrently, and all tensor shapes are checked before anything
+// is changed, so nothing is merged if an error is returned.
+// Merging a Stats into itself does nothing.
+func (st *Stats) Merge(other *Stats, how MergeOps) error {
+	if other == st {
+		return nil
+	}
+	snap := other.mergeSnapshot()
+	st.lock()
+	defer st.unlock()
+	if err := st.mergeCheck(snap, how); err != nil {
+		return err
+	}
+	if st.mergeN == nil {
+		st.mergeN = make(map[string]int)
+	}
+
+	// comb returns the function combining the values for given count key
+	comb := func(key string) func(a, b float64) float64 {
+		if how != MergeMean {
+			return func(a, b float64) float64 { return a + b }
+		}
+		n, on := float64(st.mergeCount(key)), float64(snap.mergeCount(key))
+		st.mergeN[key] = int(n + on)
+		return func(a, b float64) float64 { return (a*n + b*on) / (n + on) }
+	}
+	// copyCount records the count for a value copied from other
+	copyCount := func(key string) {
+		if how == MergeMean {
+			st.mergeN[key] = snap.mergeCount(key)
+		}
+	}
+
+	// mergeT merges tensor ot into ct, copying it if ct is an empty placeholder
+	mergeT := func(key string, ct, ot etensor.Tensor) {
+		switch {
+		case ot.Len() == 0:
+		case ct.Len() == 0:
+			mergeTensor(ct, ot, how, nil)
+			copyCount(key)
+		default:
+			mergeTensor(ct, ot, how, comb(key))
+		}
+	}
+
+	for k, v := range snap.Floats {
+		if cv, has := st.Floats[k]; has {
+			st.Floats[k] = comb("Floats:"+k)(cv, v)
+		} else {
+			st.Floats[k] = v
+			copyCount("Floats:" + k)
+		}
+	}
+	for k, v := range snap.Ints {
+		if cv, has := st.Ints[k]; has {
+			st.Ints[k] = int(comb("Ints:"+k)(float64(cv), float64(v)))
+		} else {
+			st.Ints[k] = v
+			copyCount("Ints:" + k)
+		}
+	}
+	for k, v := range snap.Strings {
+		if _, has := st.Strings[k]; !has {
+			st.Strings[k] = v
+		}
+	}
+	for k, ot := range snap.F32Tensors {
+		if ct, has := st.F32Tensors[k]; has {
+			mergeT("F32Tensors:"+k, ct, ot)
+		} else {
+			st.F32Tensors[k] = ot
+			copyCount("F32Tensors:" + k)
+		}
+	}
+	for k, ot := range snap.F64Tensors {
+		if ct, has := st.F64Tensors[k]; has {
+			mergeT("F64Tensors:"+k, ct, ot)
+		} else {
+			st.F64Tensors[k] = ot
+			copyCount("F64Tensors:" + k)
+		}
+	}
+	for k, ot := range snap.IntTensors {
+		if ct, has := st.IntTensors[k]; has {
+			mergeT("IntTensors:"+k, ct, ot)
+		} else {
+			st.IntTensors[k] = ot
+			copyCount("IntTensors:" + k)
+		}
+	}
+
+	// counts are always summed
+	sum := func(a, b float64) float64 { return a + b }
+	if snap.Confusion.Sum.Len() > 0 {
+		if st.Confusion.Sum.Len() == 0 {
+			st.Confusion.Init(snap.Confusion.N.Len())
+			st.Confusion.SetLabels(snap.Confusion.Vis.Rows)
+		}
+		mergeTensor(&st.Confusion.Sum, &snap.Confusion.Sum, MergeSum, sum)
+		mergeTensor(&st.Confusion.N, &snap.Confusion.N, MergeSum, sum)
+	}
+
+	for _, orf := range snap.ActRFs.RFs {
+		rf := st.ActRFs.RFByName(orf.Name)
+		if rf == nil {
+			rf = &actrf.RF{Name: orf.Name}
+			rf.RF.CopyShapeFrom(&orf.RF)
+			rf.NormRF.CopyShapeFrom(&orf.NormRF)
+			rf.NormSrc.CopyShapeFrom(&orf.NormSrc)
+			rf.SumProd.CopyShapeFrom(&orf.SumProd)
+			rf.SumSrc.CopyShapeFrom(&orf.SumSrc)
+			rf.Reset()
+			if st.ActRFs.NameMap == nil {
+				st.ActRFs.NameMap = make(map[string]int)
+			}
+			st.ActRFs.NameMap[orf.Name] = len(st.ActRFs.RFs)
+			st.ActRFs.RFs = append(st.ActRFs.RFs, rf)
+		}
+		mergeTensor(&rf.SumProd, &orf.SumProd, MergeSum, sum)
+		mergeTensor(&rf.SumSrc, &orf.SumSrc, MergeSum, sum)
+	}
+	return nil
+}
+
+// mergeCount returns the number of Stats averaged by MergeMean into
+// the value with given count key: 1 if not from a merge
+func (st *Stats) mergeCount(key string) int {
+	if n, has := st.mergeN[key]; has {
+		return n
+	}
+	return 1
+}
+
+// mergeSnapshot returns a copy of the values of the Stats used in Merge,
+// taken under the read lock
+func (st *Stats) mergeSnapshot() *Stats {
+	st.rlock()
+	defer st.runlock()
+	snap := &Stats{}
+	snap.Floats = make(map[string]float64, len(st.Floats))
+	for k, v := range st.Floats {
+		snap.Floats[k] = v
+	}
+	snap.Ints = make(map[string]int, len(st.Ints))
+	for k, v := range st.Ints {
+		snap.Ints[k] = v
+	}
+	snap.Strings = make(map[string]string, len(st.Strings))
+	for k, v := range st.Strings {
+		snap.Strings[k] = v
+	}
+	snap.F32Tensors = make(map[string]*etensor.Float32, len(st.F32Tensors))
+	for k, v := range st.F32Tensors {
+		snap.F32Tensors[k] = v.Clone().(*etensor.Float32)
+	}
+	snap.F64Tensors = make(map[string]*etensor.Float64, len(st.F64Tensors))
+	for k, v := range st.F64Tensors {
+		snap.F64Tensors[k] = v.Clone().(*etensor.Float64)
+	}
+	snap.IntTensors = make(map[string]*etensor.Int, len(st.IntTensors))
+	for k, v := range st.IntTensors {
+		snap.IntTensors[k] = v.Clone().(*etensor.Int)
+	}
+	snap.mergeN = make(map[string]int, len(st.mergeN))
+	for k, v := range st.mergeN {
+		snap.mergeN[k] = v
+	}
+	if st.Confusion.Sum.Len() > 0 {
+		snap.Confusion.Sum.CopyShapeFrom(&st.Confusion.Sum)
+		snap.Confusion.Sum.CopyFrom(&st.Confusion.Sum)
+		snap.Confusion.N.CopyShapeFrom(&st.Confusion.N)
+		snap.Confusion.N.CopyFrom(&st.Confusion.N)
+		snap.Confusion.Vis.Rows = append([]string(nil), st.Confusion.Vis.Rows...)
+	}
+	for _, rf := range st.ActRFs.RFs {
+		orf := &actrf.RF{Name: rf.Name}
+		orf.RF.CopyShapeFrom(&rf.RF)
+		orf.NormRF.CopyShapeFrom(&rf.NormRF)
+		orf.NormSrc.CopyShapeFrom(&rf.NormSrc)
+		orf.SumProd.CopyShapeFrom(&rf.SumProd)
+		orf.SumProd.CopyFrom(&rf.SumProd)
+		orf.SumSrc.CopyShapeFrom(&rf.SumSrc)
+		orf.SumSrc.CopyFrom(&rf.SumSrc)
+		snap.ActRFs.RFs = append(snap.ActRFs.RFs, orf)
+	}
+	return snap
+}
+
+// mergeCheck checks that the tensors in the snapshot snap of the other Stats
+// can be merged into this one, returning an error if not
+func (st *Stats) mergeCheck(snap *Stats, how MergeOps) error {
+	for k, ot := range snap.F32Tensors {
+		if ct, has := st.F32Tensors[k]; has {
+			if err := mergeTensorCheck(ct, ot, how); err != nil {
+				return fmt.Errorf("estats.Merge: F32Tensor %s: %w", k, err)
+			}
+		}
+	}
+	for k, ot := range snap.F64Tensors {
+		if ct, has := st.F64Tensors[k]; has {
+			if err := mergeTensorCheck(ct, ot, how); err != nil {
+				return fmt.Errorf("estats.Merge: F64Tensor %s: %w", k, err)
+			}
+		}
+	}
+	for k, ot := range snap.IntTensors {
+		if ct, has := st.IntTensors[k]; has {
+			if err := mergeTensorCheck(ct, ot, how); err != nil {
+				return fmt.Errorf("estats.Merge: IntTensor %s: %w", k, err)
+			}
+		}
+	}
+	if snap.Confusion.Sum.Len() > 0 && st.Confusion.Sum.Len() > 0 {
+		if err := mergeTensorCheck(&st.Confusion.Sum, &snap.Confusion.Sum, MergeSum); err != nil {
+			return fmt.Errorf("estats.Merge: Confusion: %w", err)
+		}
+	}
+	for _, orf := range snap.ActRFs.RFs {
+		rf := st.ActRFs.RFByName(orf.Name)
+		if rf == nil {
+			continue
+		}
+		if err := mergeTensorCheck(&rf.SumProd, &orf.SumProd, MergeSum); err != nil {
+			return fmt.Errorf("estats.Merge: ActRF %s: %w", orf.Name, err)
+		}
+		if err := mergeTensorCheck(&rf.SumSrc, &orf.SumSrc, MergeSum); err != nil {
+			return fmt.Errorf("estats.Merge: ActRF %s: %w", orf.Name, err)
+		}
+	}
+	return nil
+}
+
+// mergeTensorCheck returns an error if tensor b cannot be merged into a.
+// An empty a is replaced by b, and an empty b is skipped.
+func mergeTensorCheck(a, b etensor.Tensor, how MergeOps) error {
+	if a.Len() == 0 || b.Len() == 0 {
+		return nil
+	}
+	if how == MergeConcat {
+		if a.NumDims() != b.NumDims() || a.Len()/a.Dim(0) != b.Len()/b.Dim(0) {
+			return fmt.Errorf("cannot concatenate tensors of shapes: %v and %v", a.Shapes(), b.Shapes())
+		}
+		return nil
+	}
+	if a.Len() != b.Len() {
+		return fmt.Errorf("tensors not the same size: %d vs. %d", a.Len(), b.Len())
+	}
+	return nil
+}
+
+// mergeTensor combines the values of tensor b into a, which must be of the
+// same type, either using comb function on each value, or concatenating
+// the rows of b onto a, for MergeConcat -- see mergeTensorCheck.
+// An empty b is skipped, and b is copied into an empty a.
+func mergeTensor(a, b etensor.Tensor, how MergeOps, comb func(a, b float64) float64) {
+	if b.Len() == 0 {
+		return
+	}
+	if a.Len() == 0 {
+		a.CopyShapeFrom(b)
+		a.CopyFrom(b)
+		return
+	}
+	if how == MergeConcat {
+		st := a.Len()
+		a.SetNumRows(a.Dim(0) + b.Dim(0))
+		for i := 0; i < b.Len(); i++ {
+			a.SetFloat1D(st+i, b.FloatVal1D(i))
+		}
+		return
+	}
+	for i := 0; i < a.Len(); i++ {
+		a.SetFloat1D(i, comb(a.FloatVal1D(i), b.FloatVal1D(i)))
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/emer/emergent/erand"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/metric"
+	"github.com/emer/etable/simat"
+	"github.com/goki/ki/kit"
+)
+
+//////////////////////////////////////////////
+//  RSA: Representational Similarity Analysis
+
+// RSAMetrics are the correlation metrics used for comparing
+// representational dissimilarity matrices (RDMs) in RSA.
+type RSAMetrics int
+
+//go:generate stringer -type=RSAMetrics
+
+var KiT_RSAMetrics = kit.Enums.AddEnum(RSAMetricsN, kit.NotBitFlag, nil)
+
+func (ev RSAMetrics) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *RSAMetrics) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// The RSA metrics
+const (
+	// RSASpearman is the Spearman rank correlation -- the standard for RSA
+	RSASpearman RSAMetrics = iota
+
+	// RSAKendall is the Kendall tau-b rank correlation, which handles ties
+	// better than Spearman, e.g., for categorical model RDMs
+	RSAKendall
+
+	// RSAPearson is the standard Pearson correlation
+	RSAPearson
+
+	RSAMetricsN
+)
+
+// RSARDM computes a representational dissimilarity matrix (RDM)
+// for the patterns in given column of given log table (IdxView), with
+// labels from lblNm column (if non-empty), storing it in SimMats
+// under given name.  Dissimilarity is 1 - correlation, the RSA standard.
+func (st *Stats) RSARDM(name string, ix *etable.IdxView, colNm, lblNm string) (*simat.SimMat, error) {
+	sm := st.SimMat(name)
+	err := sm.TableCol(ix, colNm, lblNm, false, metric.InvCorrelation64)
+	return sm, err
+}
+
+// RSALayerRDMs computes RDMs for each of given layers, from columns
+// named "layer_var" in given log table (IdxView), as in PCAStats,
+// with labels from lblNm column (if non-empty).
+// The RDMs are stored in SimMats named "layer_RDM" (see RSARDMName).
+func (st *Stats) RSALayerRDMs(ix *etable.IdxView, varNm string, layers []string, lblNm string) error {
+	for _, lnm := range layers {
+		if _, err := st.RSARDM(RSARDMName(lnm), ix, lnm+"_"+varNm, lblNm); err != nil {
+			return fmt.Errorf("estats.RSALayerRDMs: layer %s: %w", lnm, err)
+		}
+	}
+	return nil
+}
+
+// RSARDMName returns the SimMats name for the RDM of given layer:
+// layer_RDM
+func RSARDMName(lnm string) string {
+	return lnm + "_RDM"
+}
+
+// RSACategoryRDM computes a model RDM from a categorical column
+// in given log table (IdxView): 0 for rows with the same category
+// and 1 for different categories, with labels from lblNm column
+// (if non-empty), storing it in SimMats under given name.
+// Useful as a target model matrix for RSACompare.
+func (st *Stats) RSACategoryRDM(name string, ix *etable.IdxView, catNm, lblNm string) (*simat.SimMat, error) {
+	cc, err := ix.Table.ColByNameTry(catNm)
+	if err != nil {
+		return nil, err
+	}
+	sm := st.SimMat(name)
+	sm.Init()
+	n := ix.Len()
+	sm.Mat.SetShape([]int{n, n}, nil, nil)
+	for ai := 0; ai < n; ai++ {
+		ac := cc.StringVal1D(ix.Idxs[ai])
+		for bi := 0; bi < n; bi++ {
+			if ac != cc.StringVal1D(ix.Idxs[bi]) {
+				sm.Mat.SetFloat([]int{ai, bi}, 1)
+			}
+		}
+	}
+	sm.Mat.SetMetaData("name", catNm+"_RDM")
+	if lblNm != "" {
+		lc, err := ix.Table.ColByNameTry(lblNm)
+		if err != nil {
+			return sm, err
+		}
+		sm.Rows = make([]string, n)
+		for r := 0; r < n; r++ {
+			sm.Rows[r] = lc.StringVal1D(ix.Idxs[r])
+		}
+		sm.Cols = sm.Rows
+	}
+	return sm, nil
+}
+
+// RDMUpper returns the values in the upper triangle of given RDM,
+// excluding the diagonal, which are the values compared in RSA.
+func RDMUpper(sm *simat.SimMat) []float64 {
+	n := sm.Mat.Dim(0)
+	vals := make([]float64, 0, n*(n-1)/2)
+	for ai := 0; ai < n; ai++ {
+		for bi := ai + 1; bi < n; bi++ {
+			vals = append(vals, sm.Mat.FloatVal([]int{ai, bi}))
+		}
+	}
+	return vals
+}
+
+// RSACorrel returns the correlation between the upper triangles
+// of two RDMs, using given metric.  The RDMs must have the same size,
+// with rows in the same order (e.g., from the same log table).
+func RSACorrel(a, b *simat.SimMat, met RSAMetrics) (float64, error) {
+	if err := rsaSameSize(a, b); err != nil {
+		return 0, err
+	}
+	return RSACorrelVals(RDMUpper(a), RDMUpper(b), met), nil
+}
+
+// RSACorrelVals returns the correlation between two lists of values
+// using given metric.
+func RSACorrelVals(a, b []float64, met RSAMetrics) float64 {
+	switch met {
+	case RSAKendall:
+		return KendallCorrel(a, b)
+	case RSAPearson:
+		return metric.Correlation64(a, b)
+	default:
+		return SpearmanCorrel(a, b)
+	}
+}
+
+// RSAPermTest computes the correlation between two RDMs using given
+// metric, and its significance using a permutation test with nperm
+// random permutations of the rows and columns (condition labels) of b,
+// using given random number source (nil = global).  The one-tailed
+// p value is the proportion of permutations (including the
+// observed one) with a correlation at least as large as observed.
+func RSAPermTest(a, b *simat.SimMat, met RSAMetrics, nperm int, rnd erand.Rand) (r, p float64, err error) {
+	if err = rsaSameSize(a, b); err != nil {
+		return
+	}
+	if rnd == nil {
+		rnd = erand.NewGlobalRand()
+	}
+	av := RDMUpper(a)
+	r = RSACorrelVals(av, RDMUpper(b), met)
+	n := b.Mat.Dim(0)
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	bv := make([]float64, len(av))
+	nge := 1
+	for pi := 0; pi < nperm; pi++ {
+		erand.PermuteInts(perm, rnd)
+		k := 0
+		for ai := 0; ai < n; ai++ {
+			for bi := ai + 1; bi < n; bi++ {
+				bv[k] = b.Mat.FloatVal([]int{perm[ai], perm[bi]})
+				k++
+			}
+		}
+		if RSACorrelVals(av, bv, met) >= r {
+			nge++
+		}
+	}
+	p = float64(nge) / float64(nperm+1)
+	return
+}
+
+// RSACompare compares the RDMs stored in SimMats under names aNm and bNm
+// (e.g., a layer RDM from RSALayerRDMs and a target model RDM, or two layers),
+// using given metric, recording Float stats as:
+// name_RSA: correlation between the RDMs
+// name_RSA_P: permutation test p value (only if nperm > 0)
+// rnd is the random number source for the permutations (nil = global).
+func (st *Stats) RSACompare(name, aNm, bNm string, met RSAMetrics, nperm int, rnd erand.Rand) (float64, error) {
+	a, has := st.SimMats[aNm]
+	if !has {
+		return 0, fmt.Errorf("estats.RSACompare: SimMat named: %s not found", aNm)
+	}
+	b, has := st.SimMats[bNm]
+	if !has {
+		return 0, fmt.Errorf("estats.RSACompare: SimMat named: %s not found", bNm)
+	}
+	if nperm <= 0 {
+		r, err := RSACorrel(a, b, met)
+		if err != nil {
+			return 0, err
+		}
+		st.SetFloat(name+"_RSA", r)
+		return r, nil
+	}
+	r, p, err := RSAPermTest(a, b, met, nperm, rnd)
+	if err != nil {
+		return 0, err
+	}
+	st.SetFloat(name+"_RSA", r)
+	st.SetFloat(name+"_RSA_P", p)
+	return r, nil
+}
+
+// RSACompareSimMat stores the full matrix of RSA correlations among
+// the RDMs stored in SimMats under given names (e.g., layer RDMs and
+// model RDMs), as a second-order SimMat under given name,
+// using given metric.
+func (st *Stats) RSACompareSimMat(name string, rdms []string, met RSAMetrics) (*simat.SimMat, error) {
+	n := len(rdms)
+	vals := make([][]float64, n)
+	for i, nm := range rdms {
+		sm, has := st.SimMats[nm]
+		if !has {
+			return nil, fmt.Errorf("estats.RSACompareSimMat: SimMat named: %s not found", nm)
+		}
+		if i > 0 {
+			if err := rsaSameSize(st.SimMats[rdms[0]], sm); err != nil {
+				return nil, err
+			}
+		}
+		vals[i] = RDMUpper(sm)
+	}
+	cm := st.SimMat(name)
+	cm.Init()
+	cm.Mat.SetShape([]int{n, n}, nil, nil)
+	cm.Mat.SetMetaData("name", name)
+	for ai := 0; ai < n; ai++ {
+		for bi := 0; bi <= ai; bi++ {
+			r := RSACorrelVals(vals[ai], vals[bi], met)
+			cm.Mat.SetFloat([]int{ai, bi}, r)
+			cm.Mat.SetFloat([]int{bi, ai}, r)
+		}
+	}
+	cm.Rows = append([]string{}, rdms...)
+	cm.Cols = cm.Rows
+	return cm, nil
+}
+
+// rsaSameSize returns an error if the two RDMs are not the same size
+func rsaSameSize(a, b *simat.SimMat) error {
+	if a.Mat == nil || b.Mat == nil {
+		return fmt.Errorf("estats.RSA: nil SimMat matrix")
+	}
+	if a.Mat.Dim(0) != b.Mat.Dim(0) {
+		return fmt.Errorf("estats.RSA: RDMs not the same size: %d vs. %d", a.Mat.Dim(0), b.Mat.Dim(0))
+	}
+	return nil
+}
+
+//////////////////////////////////////////////
+//  Rank correlations
+
+// Ranks returns the ranks (starting at 1) of given values,
+// with ties given the average of their ranks.
+func Ranks(vals []float64) []float64 {
+	n := len(vals)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		return vals[idx[i]] < vals[idx[j]]
+	})
+	rks := make([]float64, n)
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && vals[idx[j]] == vals[idx[i]] {
+			j++
+		}
+		rk := float64(i+j+1) / 2 // average of ranks i+1..j
+		for k := i; k < j; k++ {
+			rks[idx[k]] = rk
+		}
+		i = j
+	}
+	return rks
+}
+
+// SpearmanCorrel returns the Spearman rank correlation between
+// two lists of values, which is the Pearson correlation of their Ranks.
+func SpearmanCorrel(a, b []float64) float64 {
+	return metric.Correlation64(Ranks(a), Ranks(b))
+}
+
+// KendallCorrel returns the Kendall tau-b rank correlation between
+// two lists of values, which corrects for ties.
+// Returns NaN if either list is all ties.
+func KendallCorrel(a, b []float64) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	var conc, disc, tieA, tieB float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			da := a[i] - a[j]
+			db := b[i] - b[j]
+			switch {
+			case da == 0 && db == 0:
+			case da == 0:
+				tieA++
+			case db == 0:
+				tieB++
+			case (da > 0) == (db > 0):
+				conc++
+			default:
+				disc++
+			}
+		}
+	}
+	den := math.Sqrt((conc + disc + tieA) * (conc + disc + tieB))
+	if den == 0 {
+		return math.NaN()
+	}
+	return (conc - disc) / den
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/emer/etable/etable"
+)
+
+//////////////////////////////////////////////
+//  Unit selectivity
+
+// Selectivity computes the stimulus-category selectivity of each unit,
+// from given tensor column (e.g., "layer_var" from elog.AddLayerTensorItems)
+// in given log table (IdxView), with categories in catCol.
+// Categories are sorted by name, and returned.
+// Records tensors, with the same cell shape as the column for display
+// in a TensorGrid, as:
+// F64Tensors name_Tuning: [Cat][cell shape] mean activity per category (tuning curves)
+// F64Tensors name_DPrime: d′ between the preferred category and all others,
+// using the pooled standard deviation (NaN if there is no variance)
+// F64Tensors name_Sparse: sparseness of the tuning curve across categories
+// (Vinje & Gallant, 2000), from 0 (equal response) to 1 (one category only)
+// F64Tensors name_LifeSparse: lifetime sparseness across all trials
+// IntTensors name_PrefCat: index of the preferred category (max mean activity)
+func (st *Stats) Selectivity(name string, ix *etable.IdxView, colNm, catCol string) ([]string, error) {
+	col, err := ix.Table.ColByNameTry(colNm)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := ix.Table.ColByNameTry(catCol)
+	if err != nil {
+		return nil, err
+	}
+	if col.Dim(0) == 0 || ix.Len() == 0 {
+		return nil, fmt.Errorf("estats.Selectivity: no rows in column: %s", colNm)
+	}
+	cshp := col.Shapes()[1:]
+	var cnms []string
+	if dn := col.DimNames(); len(dn) > 1 {
+		cnms = dn[1:]
+	}
+	nu := col.Len() / col.Dim(0)
+
+	cidx := make(map[string]int)
+	for _, ri := range ix.Idxs {
+		cidx[cc.StringVal1D(ri)] = 0
+	}
+	cats := make([]string, 0, len(cidx))
+	for c := range cidx {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	for i, c := range cats {
+		cidx[c] = i
+	}
+	nc := len(cats)
+
+	// per category sums and sums of squares, and overall sums for all trials
+	sum := make([]float64, nc*nu)
+	ssq := make([]float64, nc*nu)
+	cnt := make([]int, nc)
+	lsum := make([]float64, nu)
+	lssq := make([]float64, nu)
+	for _, ri := range ix.Idxs {
+		ci := cidx[cc.StringVal1D(ri)]
+		cnt[ci]++
+		for u := 0; u < nu; u++ {
+			v := col.FloatVal1D(ri*nu + u)
+			sum[ci*nu+u] += v
+			ssq[ci*nu+u] += v * v
+			lsum[u] += v
+			lssq[u] += v * v
+		}
+	}
+
+	tune := st.F64Tensor(name + "_Tuning")
+	tune.SetShape(append([]int{nc}, cshp...), nil, append([]string{"Cat"}, cnms...))
+	dp := st.F64Tensor(name + "_DPrime")
+	dp.SetShape(cshp, nil, cnms)
+	sp := st.F64Tensor(name + "_Sparse")
+	sp.SetShape(cshp, nil, cnms)
+	lsp := st.F64Tensor(name + "_LifeSparse")
+	lsp.SetShape(cshp, nil, cnms)
+	pc := st.IntTensor(name + "_PrefCat")
+	pc.SetShape(cshp, nil, cnms)
+
+	ntot := ix.Len()
+	crv := make([]float64, nc)
+	for u := 0; u < nu; u++ {
+		pi := 0
+		for ci := 0; ci < nc; ci++ {
+			crv[ci] = sum[ci*nu+u] / float64(cnt[ci])
+			tune.Values[ci*nu+u] = crv[ci]
+			if crv[ci] > crv[pi] {
+				pi = ci
+			}
+		}
+		pc.Values[u] = pi
+		sp.Values[u] = Sparseness(crv)
+
+		// lifetime sparseness from sums over all trials
+		lsp.Values[u] = sparsenessSums(lsum[u], lssq[u], ntot)
+
+		// d' of preferred vs. rest
+		np := float64(cnt[pi])
+		nr := float64(ntot - cnt[pi])
+		if nr == 0 {
+			dp.Values[u] = math.NaN()
+			continue
+		}
+		mp := sum[pi*nu+u] / np
+		vp := ssq[pi*nu+u]/np - mp*mp
+		mr := (lsum[u] - sum[pi*nu+u]) / nr
+		vr := (lssq[u]-ssq[pi*nu+u])/nr - mr*mr
+		sd := math.Sqrt(math.Max(vp+vr, 0) / 2)
+		if sd == 0 {
+			dp.Values[u] = math.NaN()
+			continue
+		}
+		dp.Values[u] = (mp - mr) / sd
+	}
+	return cats, nil
+}
+
+// LayerSelectivity computes Selectivity for each of given layers, from
+// columns named "layer_var" in given log table (IdxView), with categories
+// in catCol, recording tensors named layer_Tuning etc.
+// Returns the sorted list of category names.
+func (st *Stats) LayerSelectivity(ix *etable.IdxView, varNm, catCol string, layers []string) ([]string, error) {
+	var cats []string
+	for _, lnm := range layers {
+		var err error
+		cats, err = st.Selectivity(lnm, ix, lnm+"_"+varNm, catCol)
+		if err != nil {
+			return nil, fmt.Errorf("estats.LayerSelectivity: layer %s: %w", lnm, err)
+		}
+	}
+	return cats, nil
+}
+
+// Sparseness returns the sparseness of given (non-negative) responses,
+// per Vinje & Gallant (2000): (1 - (Σr/n)² / (Σr²/n)) / (1 - 1/n),
+// which is 0 when all responses are equal, and 1 when only one is active.
+// Returns 0 if all responses are 0 or there are fewer than 2.
+func Sparseness(vals []float64) float64 {
+	var sum, ssq float64
+	for _, v := range vals {
+		sum += v
+		ssq += v * v
+	}
+	return sparsenessSums(sum, ssq, len(vals))
+}
+
+// sparsenessSums returns Sparseness from the sum and sum of squares of n values
+func sparsenessSums(sum, ssq float64, n int) float64 {
+	if n < 2 || ssq == 0 {
+		return 0
+	}
+	fn := float64(n)
+	a := (sum / fn) * (sum / fn) / (ssq / fn)
+	return (1 - a) / (1 - 1/fn)
+}
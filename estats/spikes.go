@@ -0,0 +1,204 @@
+// Copyright (c) 2022, The Emergent Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package estats
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/emer/etable/metric"
+)
+
+//////////////////////////////////////////////
+//  Spike train statistics from Rasters
+
+// RasterStats computes spike train statistics for all the layers
+// configured with ConfigRasters -- see LayerRasterStats.
+func (st *Stats) RasterStats(ncyc, win int, thr float32) error {
+	for _, lnm := range st.Rasters {
+		if err := st.LayerRasterStats(lnm, ncyc, win, thr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LayerRasterStats computes spike train statistics from the Raster_layer
+// tensor recorded by RasterRec, for the first ncyc cycles (all if <= 0),
+// counting values > thr as spikes (e.g., .5 for a 0/1 Spike variable).
+// Count-based stats use spike counts in consecutive windows of win cycles.
+// Rates are in spikes per 1000 cycles, i.e., Hz for 1 msec cycles.
+// Records F64Tensors per neuron as:
+// layer_Spike_Rates: [Nrn] firing rates
+// layer_Spike_ISICVs: [Nrn] coefficient of variation of inter-spike intervals
+// (NaN if fewer than 3 spikes)
+// layer_Spike_Fanos: [Nrn] Fano factor (variance / mean) of window spike counts
+// (NaN if no spikes)
+// layer_Spike_ISIHist: [Cyc] number of inter-spike intervals of each length in cycles,
+// pooled over neurons
+// layer_Spike_Cors: [Nrn][Nrn] pairwise correlations of window spike counts
+// and Float stats with the averages over neurons (ignoring NaNs) as:
+// layer_Spike_Rate, layer_Spike_ISICV, layer_Spike_Fano, layer_Spike_Cor
+// (over distinct pairs), and layer_Spike_Sync: population synchrony χ
+// (Golomb, 2007): the standard deviation over windows of the population
+// mean count, relative to the root mean of the individual variances,
+// which is 1 for full synchrony and near 0 for asynchronous firing.
+func (st *Stats) LayerRasterStats(lnm string, ncyc, win int, thr float32) error {
+	sr, has := st.F32Tensors["Raster_"+lnm]
+	if !has || sr.NumDims() != 2 {
+		return fmt.Errorf("estats.LayerRasterStats: Raster for layer: %s not found -- see ConfigRasters", lnm)
+	}
+	nn := sr.Dim(0)
+	mc := sr.Dim(1)
+	if ncyc <= 0 || ncyc > mc {
+		ncyc = mc
+	}
+	if win < 1 {
+		win = 1
+	}
+	nw := ncyc / win
+	pfx := lnm + "_Spike_"
+
+	rates := st.F64Tensor(pfx + "Rates")
+	rates.SetShape([]int{nn}, nil, []string{"Nrn"})
+	cvs := st.F64Tensor(pfx + "ISICVs")
+	cvs.SetShape([]int{nn}, nil, []string{"Nrn"})
+	fanos := st.F64Tensor(pfx + "Fanos")
+	fanos.SetShape([]int{nn}, nil, []string{"Nrn"})
+	hist := st.F64Tensor(pfx + "ISIHist")
+	hist.SetShape([]int{mc}, nil, []string{"Cyc"})
+	for i := range hist.Values {
+		hist.Values[i] = 0
+	}
+	cors := st.F64Tensor(pfx + "Cors")
+	cors.SetShape([]int{nn, nn}, nil, []string{"Nrn", "Nrn"})
+
+	counts := make([][]float64, nn) // window counts per neuron
+	isis := make([]float64, 0, ncyc)
+	for ni := 0; ni < nn; ni++ {
+		counts[ni] = make([]float64, nw)
+		isis = isis[:0]
+		nspk := 0
+		last := -1
+		for c := 0; c < ncyc; c++ {
+			if sr.Values[ni*mc+c] <= thr {
+				continue
+			}
+			nspk++
+			if wi := c / win; wi < nw {
+				counts[ni][wi]++
+			}
+			if last >= 0 {
+				isi := c - last
+				isis = append(isis, float64(isi))
+				hist.Values[isi]++
+			}
+			last = c
+		}
+		rates.Values[ni] = 1000 * float64(nspk) / float64(ncyc)
+		if len(isis) >= 2 {
+			mean, sd := meanStd(isis)
+			cvs.Values[ni] = sd / mean
+		} else {
+			cvs.Values[ni] = math.NaN()
+		}
+		mean, sd := meanStd(counts[ni])
+		if mean > 0 {
+			fanos.Values[ni] = sd * sd / mean
+		} else {
+			fanos.Values[ni] = math.NaN()
+		}
+	}
+
+	var csum float64
+	ncor := 0
+	for ai := 0; ai < nn; ai++ {
+		cors.Values[ai*nn+ai] = 1
+		for bi := 0; bi < ai; bi++ {
+			cor := metric.Correlation64(counts[ai], counts[bi])
+			cors.Values[ai*nn+bi] = cor
+			cors.Values[bi*nn+ai] = cor
+			if !math.IsNaN(cor) {
+				csum += cor
+				ncor++
+			}
+		}
+	}
+
+	st.SetFloat(pfx+"Rate", nanMean(rates.Values))
+	st.SetFloat(pfx+"ISICV", nanMean(cvs.Values))
+	st.SetFloat(pfx+"Fano", nanMean(fanos.Values))
+	if ncor > 0 {
+		st.SetFloat(pfx+"Cor", csum/float64(ncor))
+	} else {
+		st.SetFloat(pfx+"Cor", math.NaN())
+	}
+	st.SetFloat(pfx+"Sync", SpikeSynchrony(counts))
+	return nil
+}
+
+// SpikeSynchrony returns the population synchrony measure χ (Golomb, 2007)
+// for given spike counts (or other activity) per neuron over time windows:
+// the variance over time of the population average, divided by the average
+// over neurons of their variance over time, square-rooted.  It is 1 when all
+// neurons are fully synchronized, and approaches 0 for independent neurons.
+// Returns NaN if there is no variance.
+func SpikeSynchrony(counts [][]float64) float64 {
+	nn := len(counts)
+	if nn == 0 {
+		return math.NaN()
+	}
+	nw := len(counts[0])
+	pop := make([]float64, nw)
+	var ivar float64
+	for _, cn := range counts {
+		_, sd := meanStd(cn)
+		ivar += sd * sd
+		for wi, v := range cn {
+			pop[wi] += v / float64(nn)
+		}
+	}
+	ivar /= float64(nn)
+	if ivar == 0 {
+		return math.NaN()
+	}
+	_, psd := meanStd(pop)
+	return math.Sqrt(psd * psd / ivar)
+}
+
+// meanStd returns the mean and population standard deviation of given values
+func meanStd(vals []float64) (mean, sd float64) {
+	n := float64(len(vals))
+	if n == 0 {
+		return 0, 0
+	}
+	for _, v := range vals {
+		mean += v
+	}
+	mean /= n
+	for _, v := range vals {
+		d := v - mean
+		sd += d * d
+	}
+	sd = math.Sqrt(sd / n)
+	return
+}
+
+// nanMean returns the mean of the non-NaN values, NaN if none
+func nanMean(vals []float64) float64 {
+	var sum float64
+	n := 0
+	for _, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v
+		n++
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
@@ -6,6 +6,7 @@ package estats
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/emer/emergent/actrf"
 	"github.com/emer/emergent/confusion"
@@ -19,6 +20,7 @@ import (
 
 // Stats provides maps for storing statistics as named scalar and tensor values.
 // These stats are available in the elog.Context for use during logging.
+// Set ThreadSafe to access the maps from multiple goroutines.
 type Stats struct {
 	Floats          map[string]float64
 	Strings         map[string]string
@@ -32,10 +34,15 @@ type Stats struct {
 	PCA             pca.PCA                     `desc:"one PCA object can be reused for all PCA computations"`
 	SVD             pca.SVD                     `desc:"one SVD object can be reused for all SVD computations"`
 	ActRFs          actrf.RFs                   `view:"no-inline" desc:"activation-based receptive fields"`
+	Drifts          map[string]*Drift           `desc:"representational drift snapshots by layer name -- see DriftStats"`
 	Rasters         []string                    `desc:"list of layer names configured for recording raster plots"`
 	LinDecoders     map[string]*decoder.Linear  `desc:"linear decoders"`
 	SoftMaxDecoders map[string]*decoder.SoftMax `desc:"softmax decoders"`
 	Timers          map[string]*timer.Time      `desc:"named timers available for timing how long different computations take (wall-clock time)"`
+	ThreadSafe      bool                        `desc:"if true, access to the maps through the Set, Get and tensor accessor methods is protected by a lock, so stats can be computed from multiple goroutines -- the contents of tensors and other objects are not protected"`
+
+	mu     sync.RWMutex   // protects the maps when ThreadSafe
+	mergeN map[string]int // number of Stats averaged by MergeMean into each value, by kind:name
 }
 
 // Init must be called before use to create all the maps
@@ -50,16 +57,48 @@ func (st *Stats) Init() {
 	st.Plots = make(map[string]*eplot.Plot2D)
 	st.LinDecoders = make(map[string]*decoder.Linear)
 	st.SoftMaxDecoders = make(map[string]*decoder.SoftMax)
+	st.Drifts = make(map[string]*Drift)
 	st.Timers = make(map[string]*timer.Time)
 	st.PCA.Init()
 	st.SVD.Init()
 	st.SVD.Cond = PCAStrongThr
+	st.mergeN = nil
+}
+
+// lock locks the maps for writing if ThreadSafe
+func (st *Stats) lock() {
+	if st.ThreadSafe {
+		st.mu.Lock()
+	}
+}
+
+// unlock unlocks the maps for writing if ThreadSafe
+func (st *Stats) unlock() {
+	if st.ThreadSafe {
+		st.mu.Unlock()
+	}
+}
+
+// rlock locks the maps for reading if ThreadSafe
+func (st *Stats) rlock() {
+	if st.ThreadSafe {
+		st.mu.RLock()
+	}
+}
+
+// runlock unlocks the maps for reading if ThreadSafe
+func (st *Stats) runlock() {
+	if st.ThreadSafe {
+		st.mu.RUnlock()
+	}
 }
 
 // Print returns a formatted Name: Value string of stat values,
 // suitable for displaying at the bottom of the NetView or otherwise printing.
 // Looks for names of stats in order of fields in Stats object (Floats, Strings, Ints)
 func (st *Stats) Print(stats []string) string {
+	st.rlock()
+	defer st.runlock()
 	var str string
 	for _, nm := range stats {
 		if str != "" {
@@ -86,6 +125,8 @@ func (st *Stats) Print(stats []string) string {
 // PrintVals returns values of given stats with given formats,
 // and delimiter
 func (st *Stats) PrintVals(stats, fmts []string, delim string) string {
+	st.rlock()
+	defer st.runlock()
 	var str string
 	for i, nm := range stats {
 		fm := fmts[i]
@@ -111,27 +152,37 @@ func (st *Stats) PrintVals(stats, fmts []string, delim string) string {
 
 // SetFloat sets Floats stat value
 func (st *Stats) SetFloat(name string, value float64) {
+	st.lock()
 	st.Floats[name] = value
+	st.unlock()
 }
 
 // SetFloat32 sets Floats stat value using a float32 value
 func (st *Stats) SetFloat32(name string, value float32) {
+	st.lock()
 	st.Floats[name] = float64(value)
+	st.unlock()
 }
 
 // SetString sets Strings stat value
 func (st *Stats) SetString(name string, value string) {
+	st.lock()
 	st.Strings[name] = value
+	st.unlock()
 }
 
 // SetInt sets Ints stat value
 func (st *Stats) SetInt(name string, value int) {
+	st.lock()
 	st.Ints[name] = value
+	st.unlock()
 }
 
 // Float returns Floats stat value -- prints error message and returns 0 if not found
 func (st *Stats) Float(name string) float64 {
+	st.rlock()
 	val, has := st.Floats[name]
+	st.runlock()
 	if has {
 		return val
 	}
@@ -147,7 +198,9 @@ func (st *Stats) Float32(name string) float32 {
 
 // String returns Strings stat value -- prints error message and returns "" if not found
 func (st *Stats) String(name string) string {
+	st.rlock()
 	val, has := st.Strings[name]
+	st.runlock()
 	if has {
 		return val
 	}
@@ -157,7 +210,9 @@ func (st *Stats) String(name string) string {
 
 // Int returns Ints stat value -- prints error message and returns 0 if not found
 func (st *Stats) Int(name string) int {
+	st.rlock()
 	val, has := st.Ints[name]
+	st.runlock()
 	if has {
 		return val
 	}
@@ -167,6 +222,8 @@ func (st *Stats) Int(name string) int {
 
 // F32Tensor returns a float32 tensor of given name, creating if not yet made
 func (st *Stats) F32Tensor(name string) *etensor.Float32 {
+	st.lock()
+	defer st.unlock()
 	tsr, has := st.F32Tensors[name]
 	if !has {
 		tsr = &etensor.Float32{}
@@ -177,6 +234,8 @@ func (st *Stats) F32Tensor(name string) *etensor.Float32 {
 
 // F64Tensor returns a float64 tensor of given name, creating if not yet made
 func (st *Stats) F64Tensor(name string) *etensor.Float64 {
+	st.lock()
+	defer st.unlock()
 	tsr, has := st.F64Tensors[name]
 	if !has {
 		tsr = &etensor.Float64{}
@@ -187,6 +246,8 @@ func (st *Stats) F64Tensor(name string) *etensor.Float64 {
 
 // IntTensor returns a int tensor of given name, creating if not yet made
 func (st *Stats) IntTensor(name string) *etensor.Int {
+	st.lock()
+	defer st.unlock()
 	tsr, has := st.IntTensors[name]
 	if !has {
 		tsr = &etensor.Int{}
@@ -198,23 +259,31 @@ func (st *Stats) IntTensor(name string) *etensor.Int {
 // SetF32Tensor sets a float32 tensor of given name.
 // Just does: st.F32Tensors[name] = tsr
 func (st *Stats) SetF32Tensor(name string, tsr *etensor.Float32) {
+	st.lock()
 	st.F32Tensors[name] = tsr
+	st.unlock()
 }
 
 // SetF64Tensor sets a float64 tensor of given name.
 // Just does: st.F64Tensors[name] = tsr
 func (st *Stats) SetF64Tensor(name string, tsr *etensor.Float64) {
+	st.lock()
 	st.F64Tensors[name] = tsr
+	st.unlock()
 }
 
 // SetIntTensor sets a int tensor of given name.
 // Just does: st.IntTensors[name] = tsr
 func (st *Stats) SetIntTensor(name string, tsr *etensor.Int) {
+	st.lock()
 	st.IntTensors[name] = tsr
+	st.unlock()
 }
 
 // SimMat returns a SimMat similarity matrix of given name, creating if not yet made
 func (st *Stats) SimMat(name string) *simat.SimMat {
+	st.lock()
+	defer st.unlock()
 	sm, has := st.SimMats[name]
 	if !has {
 		sm = &simat.SimMat{}
@@ -225,6 +294,8 @@ func (st *Stats) SimMat(name string) *simat.SimMat {
 
 // Plot returns an eplot.Plot2D of given name, creating if not yet made
 func (st *Stats) Plot(name string) *eplot.Plot2D {
+	st.lock()
+	defer st.unlock()
 	pl, has := st.Plots[name]
 	if !has {
 		pl = &eplot.Plot2D{}
@@ -236,6 +307,8 @@ func (st *Stats) Plot(name string) *eplot.Plot2D {
 
 // Timer returns timer of given name, creating if not yet made
 func (st *Stats) Timer(name string) *timer.Time {
+	st.lock()
+	defer st.unlock()
 	tmr, has := st.Timers[name]
 	if !has {
 		tmr = &timer.Time{}
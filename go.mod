@@ -12,6 +12,7 @@ require (
 	github.com/goki/mat32 v1.0.14
 	github.com/goki/vgpu v1.0.22
 	github.com/stretchr/testify v1.8.0
+	gonum.org/v1/gonum v0.12.0
 )
 
 require (
@@ -64,7 +65,6 @@ require (
 	golang.org/x/text v0.8.0 // indirect
 	golang.org/x/tools v0.7.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
-	gonum.org/v1/gonum v0.12.0 // indirect
 	gonum.org/v1/plot v0.12.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )